@@ -0,0 +1,284 @@
+package echo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// CBOR (RFC 8949) building blocks for the "cbor" file format. Only what the
+// format needs is implemented: the encoder emits a fixed subset, and the
+// decoder accepts any well-formed data item but maps it onto slog values.
+
+// CBOR major types, pre-shifted into the high three bits of the initial byte.
+const (
+	cborUint   byte = 0 << 5
+	cborNeg    byte = 1 << 5
+	cborBytes  byte = 2 << 5
+	cborText   byte = 3 << 5
+	cborArray  byte = 4 << 5
+	cborMap    byte = 5 << 5
+	cborTag    byte = 6 << 5
+	cborSimple byte = 7 << 5
+)
+
+// Special initial bytes and additional-information values.
+const (
+	cborFalse      byte = cborSimple | 20
+	cborTrue       byte = cborSimple | 21
+	cborNull       byte = cborSimple | 22
+	cborFloat16    byte = cborSimple | 25
+	cborFloat32    byte = cborSimple | 26
+	cborFloat64    byte = cborSimple | 27
+	cborBreak      byte = 0xff
+	cborIndefinite byte = 31
+)
+
+// CBOR tags used by the format.
+const (
+	cborTagSelfDescribe = 55799 // Prefixes every record; marks the stream as CBOR
+	cborTagEpochTime    = 1     // Standard epoch time, accepted when decoding
+	cborTagRFC3339      = 0     // Standard text time, accepted when decoding
+	cborTagExtTime      = 1001  // RFC 9581 extended time: {1: seconds, -9: nanoseconds}
+	cborTagDuration     = 1002  // RFC 9581 duration, same map layout as 1001
+	cborTagJSON         = 262   // Embedded JSON text, used for arbitrary Go values
+)
+
+// Limits protecting the decoder from corrupt input.
+const (
+	cborMaxDepth  = 64
+	cborMaxLength = 16 << 20
+)
+
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major|27), n)
+	}
+}
+
+func appendCBORText(b []byte, s string) []byte {
+	return append(appendCBORHead(b, cborText, uint64(len(s))), s...)
+}
+
+func appendCBORBytes(b []byte, p []byte) []byte {
+	return append(appendCBORHead(b, cborBytes, uint64(len(p))), p...)
+}
+
+func appendCBORInt(b []byte, n int64) []byte {
+	if n >= 0 {
+		return appendCBORHead(b, cborUint, uint64(n))
+	}
+	return appendCBORHead(b, cborNeg, uint64(-1-n))
+}
+
+func appendCBORFloat(b []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, cborFloat64), math.Float64bits(f))
+}
+
+func appendCBORBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, cborTrue)
+	}
+	return append(b, cborFalse)
+}
+
+// appendCBORSplitNanos appends the RFC 9581 map shared by extended times and
+// durations: whole seconds under key 1 and the remaining nanoseconds under -9.
+func appendCBORSplitNanos(b []byte, tag uint64, secs, nanos int64) []byte {
+	b = appendCBORHead(b, cborTag, tag)
+	b = appendCBORHead(b, cborMap, 2)
+	b = appendCBORInt(b, 1)
+	b = appendCBORInt(b, secs)
+	b = appendCBORInt(b, -9)
+	return appendCBORInt(b, nanos)
+}
+
+func appendCBORTime(b []byte, t time.Time) []byte {
+	return appendCBORSplitNanos(b, cborTagExtTime, t.Unix(), int64(t.Nanosecond()))
+}
+
+func appendCBORDuration(b []byte, d time.Duration) []byte {
+	return appendCBORSplitNanos(b, cborTagDuration, int64(d/time.Second), int64(d%time.Second))
+}
+
+// cborItem is a decoded CBOR data item.
+type cborItem struct {
+	major byte
+	arg   uint64     // Integer value, tag number, simple value or float bits
+	bytes []byte     // Byte or text string content
+	items []cborItem // Array elements, map keys and values interleaved, or the tagged item
+	float bool       // Set for floating point simple values
+}
+
+// cborDecoder reads a sequence of CBOR data items.
+type cborDecoder struct {
+	r *bufio.Reader
+}
+
+// next decodes the next data item. A clean end of input yields io.EOF, input
+// ending inside an item ErrTruncated.
+func (d *cborDecoder) next() (cborItem, error) {
+	if _, err := d.r.Peek(1); err != nil {
+		return cborItem{}, err
+	}
+	item, err := d.item(0)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return cborItem{}, ErrTruncated
+	}
+	return item, err
+}
+
+func (d *cborDecoder) item(depth int) (cborItem, error) {
+	if depth > cborMaxDepth {
+		return cborItem{}, fmt.Errorf("echo: CBOR nesting too deep")
+	}
+	ib, err := d.r.ReadByte()
+	if err != nil {
+		return cborItem{}, err
+	}
+	it := cborItem{major: ib & 0xe0}
+	info := ib & 0x1f
+
+	if info == cborIndefinite {
+		return d.indefinite(it, depth)
+	}
+	if it.major == cborSimple {
+		switch ib {
+		case cborFloat16, cborFloat32, cborFloat64:
+			it.float = true
+		}
+	}
+	if it.arg, err = d.arg(info); err != nil {
+		return cborItem{}, err
+	}
+	if it.float {
+		switch ib {
+		case cborFloat16:
+			it.arg = math.Float64bits(float16ToFloat64(uint16(it.arg)))
+		case cborFloat32:
+			it.arg = math.Float64bits(float64(math.Float32frombits(uint32(it.arg))))
+		}
+	}
+
+	switch it.major {
+	case cborBytes, cborText:
+		if it.arg > cborMaxLength {
+			return cborItem{}, fmt.Errorf("echo: CBOR string of %d bytes exceeds limit", it.arg)
+		}
+		it.bytes = make([]byte, it.arg)
+		_, err = io.ReadFull(d.r, it.bytes)
+	case cborArray, cborMap:
+		n := it.arg
+		if it.major == cborMap {
+			n *= 2
+		}
+		if n > cborMaxLength {
+			return cborItem{}, fmt.Errorf("echo: CBOR container of %d items exceeds limit", n)
+		}
+		for i := uint64(0); i < n && err == nil; i++ {
+			var child cborItem
+			if child, err = d.item(depth + 1); err == nil {
+				it.items = append(it.items, child)
+			}
+		}
+	case cborTag:
+		var child cborItem
+		if child, err = d.item(depth + 1); err == nil {
+			it.items = []cborItem{child}
+		}
+	}
+	return it, err
+}
+
+// indefinite decodes an indefinite-length string, array or map.
+func (d *cborDecoder) indefinite(it cborItem, depth int) (cborItem, error) {
+	switch it.major {
+	case cborBytes, cborText, cborArray, cborMap:
+	default:
+		return cborItem{}, fmt.Errorf("echo: invalid indefinite-length CBOR item")
+	}
+	for {
+		b, err := d.r.Peek(1)
+		if err != nil {
+			return cborItem{}, err
+		}
+		if b[0] == cborBreak {
+			_, _ = d.r.ReadByte()
+			break
+		}
+		child, err := d.item(depth + 1)
+		if err != nil {
+			return cborItem{}, err
+		}
+		if it.major == cborBytes || it.major == cborText {
+			if child.major != it.major {
+				return cborItem{}, fmt.Errorf("echo: invalid chunk in indefinite-length CBOR string")
+			}
+			it.bytes = append(it.bytes, child.bytes...)
+			continue
+		}
+		it.items = append(it.items, child)
+	}
+	if it.major == cborMap && len(it.items)%2 != 0 {
+		return cborItem{}, fmt.Errorf("echo: CBOR map with odd number of items")
+	}
+	return it, nil
+}
+
+// arg reads the argument encoded by the additional information of a head.
+func (d *cborDecoder) arg(info byte) (uint64, error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, fmt.Errorf("echo: invalid CBOR additional information %d", info)
+	}
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// float16ToFloat64 converts an IEEE 754 half-precision value.
+func float16ToFloat64(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	default:
+		return sign * math.Ldexp(frac+1024, exp-25)
+	}
+}
@@ -0,0 +1,262 @@
+package echo
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// cborHandler writes records in the "cbor" file format: a sequence of CBOR
+// maps, each prefixed with the self-describe tag. The built-in keys are the
+// same as slog's JSONHandler ("time", "level", "msg", "source"), but values
+// keep their slog types: times and durations use RFC 9581 tags, levels are
+// integers and groups are nested maps. Read the format with NewCBORReader.
+// Kept unexported; select it with FileFormat "cbor". ReplaceAttr is not
+// supported, and NewFormatHandler rejects it.
+type cborHandler struct {
+	opts       slog.HandlerOptions
+	w          io.Writer
+	mu         *sync.Mutex // Shared with derived handlers so records don't interleave
+	preformat  []byte      // Encoded WithAttrs attributes, inside groups[:openGroups]
+	groups     []string    // Groups from WithGroup
+	openGroups int         // Groups already opened in preformat
+	bufPool    *sync.Pool
+}
+
+// newCBORHandler creates a cborHandler writing to w.
+func newCBORHandler(w io.Writer, opts *slog.HandlerOptions) *cborHandler {
+	h := &cborHandler{
+		w:       w,
+		mu:      &sync.Mutex{},
+		bufPool: &sync.Pool{New: func() any { b := make([]byte, 0, 1024); return &b }},
+	}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+func (h *cborHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *cborHandler) minLevel() int64 { return staticMinLevel(h.opts.Level) }
+
+func (h *cborHandler) Handle(_ context.Context, r slog.Record) error {
+	bp := h.bufPool.Get().(*[]byte)
+	buf := (*bp)[:0]
+	defer func() {
+		*bp = buf
+		h.bufPool.Put(bp)
+	}()
+
+	buf = appendCBORHead(buf, cborTag, cborTagSelfDescribe)
+	buf = append(buf, cborMap|cborIndefinite)
+	if !r.Time.IsZero() {
+		buf = appendCBORText(buf, slog.TimeKey)
+		buf = appendCBORTime(buf, r.Time)
+	}
+	buf = appendCBORText(buf, slog.LevelKey)
+	buf = appendCBORInt(buf, int64(r.Level))
+	if h.opts.AddSource && r.PC != 0 {
+		buf = appendCBORText(buf, slog.SourceKey)
+		buf = appendCBORSource(buf, r.PC)
+	}
+	buf = appendCBORText(buf, slog.MessageKey)
+	buf = appendCBORText(buf, r.Message)
+
+	buf = append(buf, h.preformat...)
+	if r.NumAttrs() > 0 {
+		// Groups from WithGroup are only opened if the record has attributes,
+		// matching slog's handlers, which omit empty groups.
+		start := len(buf)
+		for _, g := range h.groups[h.openGroups:] {
+			buf = appendCBORText(buf, g)
+			buf = append(buf, cborMap|cborIndefinite)
+		}
+		wrote := false
+		r.Attrs(func(a slog.Attr) bool {
+			var ok bool
+			buf, ok = appendCBORAttr(buf, a)
+			wrote = wrote || ok
+			return true
+		})
+		if wrote {
+			for range h.groups[h.openGroups:] {
+				buf = append(buf, cborBreak)
+			}
+		} else {
+			buf = buf[:start]
+		}
+	}
+	for range h.openGroups {
+		buf = append(buf, cborBreak)
+	}
+	buf = append(buf, cborBreak)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf)
+	return err
+}
+
+func (h *cborHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := h.clone()
+	start := len(h2.preformat)
+	for _, g := range h2.groups[h2.openGroups:] {
+		h2.preformat = appendCBORText(h2.preformat, g)
+		h2.preformat = append(h2.preformat, cborMap|cborIndefinite)
+	}
+	wrote := false
+	for _, a := range attrs {
+		var ok bool
+		h2.preformat, ok = appendCBORAttr(h2.preformat, a)
+		wrote = wrote || ok
+	}
+	if !wrote {
+		// Nothing but empty attributes: leave the groups unopened.
+		h2.preformat = h2.preformat[:start]
+		return h2
+	}
+	h2.openGroups = len(h2.groups)
+	return h2
+}
+
+func (h *cborHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := h.clone()
+	h2.groups = append(h2.groups, name)
+	return h2
+}
+
+func (h *cborHandler) clone() *cborHandler {
+	h2 := *h
+	h2.preformat = append([]byte(nil), h.preformat...)
+	h2.groups = append([]string(nil), h.groups...)
+	return &h2
+}
+
+// appendCBORAttr appends a key/value pair for a, following slog's rules:
+// values are resolved, empty attributes and empty groups are dropped, and
+// groups with an empty key are inlined. It reports whether anything was
+// appended.
+func appendCBORAttr(b []byte, a slog.Attr) ([]byte, bool) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return b, false
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return b, false
+		}
+		start := len(b)
+		if a.Key != "" {
+			b = appendCBORText(b, a.Key)
+			b = append(b, cborMap|cborIndefinite)
+		}
+		wrote := false
+		for _, ga := range attrs {
+			var ok bool
+			b, ok = appendCBORAttr(b, ga)
+			wrote = wrote || ok
+		}
+		if !wrote {
+			return b[:start], false
+		}
+		if a.Key != "" {
+			b = append(b, cborBreak)
+		}
+		return b, true
+	}
+	b = appendCBORText(b, a.Key)
+	return appendCBORValue(b, a.Value), true
+}
+
+// appendCBORValue appends a resolved, non-group slog value.
+func appendCBORValue(b []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindString:
+		return appendCBORText(b, v.String())
+	case slog.KindInt64:
+		return appendCBORInt(b, v.Int64())
+	case slog.KindUint64:
+		return appendCBORHead(b, cborUint, v.Uint64())
+	case slog.KindFloat64:
+		return appendCBORFloat(b, v.Float64())
+	case slog.KindBool:
+		return appendCBORBool(b, v.Bool())
+	case slog.KindDuration:
+		return appendCBORDuration(b, v.Duration())
+	case slog.KindTime:
+		return appendCBORTime(b, v.Time())
+	default:
+		return appendCBORAny(b, v.Any())
+	}
+}
+
+// appendCBORAny encodes arbitrary values the way JSONHandler would render
+// them, but keeps byte slices binary. Values JSON can't encode fall back to
+// their error text, as in JSONHandler.
+func appendCBORAny(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, cborNull)
+	case error:
+		if _, isJSON := v.(json.Marshaler); !isJSON {
+			return appendCBORText(b, v.Error())
+		}
+	case []byte:
+		return appendCBORBytes(b, v)
+	case time.Time:
+		return appendCBORTime(b, v)
+	case time.Duration:
+		return appendCBORDuration(b, v)
+	case *slog.Source: // From Entry.Record, when converting logs
+		return appendCBORSourceMap(b, v.Function, v.File, v.Line)
+	case encoding.TextMarshaler:
+		if _, isJSON := v.(json.Marshaler); !isJSON {
+			if text, err := v.MarshalText(); err == nil {
+				return appendCBORText(b, string(text))
+			}
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return appendCBORText(b, "!ERROR:"+err.Error())
+	}
+	b = appendCBORHead(b, cborTag, cborTagJSON)
+	return appendCBORBytes(b, data)
+}
+
+// appendCBORSource appends the caller location of pc as a map with the same
+// keys as slog.Source.
+func appendCBORSource(b []byte, pc uintptr) []byte {
+	fs := runtime.CallersFrames([]uintptr{pc})
+	f, _ := fs.Next()
+	return appendCBORSourceMap(b, f.Function, f.File, f.Line)
+}
+
+func appendCBORSourceMap(b []byte, function, file string, line int) []byte {
+	b = appendCBORHead(b, cborMap, 3)
+	b = appendCBORText(b, "function")
+	b = appendCBORText(b, function)
+	b = appendCBORText(b, "file")
+	b = appendCBORText(b, file)
+	b = appendCBORText(b, "line")
+	return appendCBORInt(b, int64(line))
+}
@@ -0,0 +1,227 @@
+package echo
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// CBORReader decodes records written with FileFormat "cbor" back into
+// slog.Records, for replay through any slog.Handler or for conversion.
+type CBORReader struct {
+	dec cborDecoder
+}
+
+// NewCBORReader returns a reader for a stream of "cbor" format records.
+func NewCBORReader(r io.Reader) *CBORReader {
+	return &CBORReader{dec: cborDecoder{r: bufio.NewReader(r)}}
+}
+
+// Next returns the next record. It returns io.EOF at the end of the stream
+// and ErrTruncated if the stream ends inside a record, as it may after a
+// crash. Records have no PC; if the writer had AddSource enabled, the
+// location is carried as a *slog.Source under slog.SourceKey, which
+// slog's handlers render the same way as a real source.
+func (cr *CBORReader) Next() (slog.Record, error) {
+	item, err := cr.dec.next()
+	if err != nil {
+		return slog.Record{}, err
+	}
+	if item.major == cborTag && item.arg == cborTagSelfDescribe {
+		item = item.items[0]
+	}
+	if item.major != cborMap {
+		return slog.Record{}, fmt.Errorf("echo: CBOR record is not a map")
+	}
+
+	var rec slog.Record
+	var attrs []slog.Attr
+	for i := 0; i < len(item.items); i += 2 {
+		key, val := item.items[i], item.items[i+1]
+		if key.major != cborText {
+			return slog.Record{}, fmt.Errorf("echo: CBOR record has non-text key")
+		}
+		v, err := cborValue(val)
+		if err != nil {
+			return slog.Record{}, err
+		}
+		switch k := string(key.bytes); {
+		case k == slog.TimeKey && v.Kind() == slog.KindTime:
+			rec.Time = v.Time()
+		case k == slog.LevelKey && v.Kind() == slog.KindInt64:
+			rec.Level = slog.Level(v.Int64())
+		case k == slog.MessageKey && v.Kind() == slog.KindString:
+			rec.Message = v.String()
+		case k == slog.SourceKey && v.Kind() == slog.KindGroup:
+			attrs = append(attrs, slog.Any(slog.SourceKey, sourceFromGroup(v.Group())))
+		default:
+			attrs = append(attrs, slog.Attr{Key: k, Value: v})
+		}
+	}
+	out := slog.NewRecord(rec.Time, rec.Level, rec.Message, 0)
+	out.AddAttrs(attrs...)
+	return out, nil
+}
+
+// cborValue converts a decoded item into the slog value it was encoded from.
+func cborValue(it cborItem) (slog.Value, error) {
+	switch it.major {
+	case cborUint:
+		if it.arg > math.MaxInt64 {
+			return slog.Uint64Value(it.arg), nil
+		}
+		return slog.Int64Value(int64(it.arg)), nil
+	case cborNeg:
+		if it.arg > math.MaxInt64 {
+			return slog.Value{}, fmt.Errorf("echo: CBOR integer out of range")
+		}
+		return slog.Int64Value(-1 - int64(it.arg)), nil
+	case cborBytes:
+		return slog.AnyValue(it.bytes), nil
+	case cborText:
+		return slog.StringValue(string(it.bytes)), nil
+	case cborArray:
+		elems := make([]any, len(it.items))
+		for i, e := range it.items {
+			v, err := cborValue(e)
+			if err != nil {
+				return slog.Value{}, err
+			}
+			elems[i] = v.Any()
+		}
+		return slog.AnyValue(elems), nil
+	case cborMap:
+		attrs := make([]slog.Attr, 0, len(it.items)/2)
+		for i := 0; i < len(it.items); i += 2 {
+			k, err := cborValue(it.items[i])
+			if err != nil {
+				return slog.Value{}, err
+			}
+			v, err := cborValue(it.items[i+1])
+			if err != nil {
+				return slog.Value{}, err
+			}
+			attrs = append(attrs, slog.Attr{Key: k.String(), Value: v})
+		}
+		return slog.GroupValue(attrs...), nil
+	case cborTag:
+		return cborTaggedValue(it.arg, it.items[0])
+	default: // cborSimple
+		switch {
+		case it.float:
+			return slog.Float64Value(math.Float64frombits(it.arg)), nil
+		case it.arg == uint64(cborTrue&0x1f):
+			return slog.BoolValue(true), nil
+		case it.arg == uint64(cborFalse&0x1f):
+			return slog.BoolValue(false), nil
+		default:
+			return slog.AnyValue(nil), nil
+		}
+	}
+}
+
+// cborTaggedValue interprets the tags the format uses. Unknown tags are
+// ignored and the tagged item is returned as is.
+func cborTaggedValue(tag uint64, it cborItem) (slog.Value, error) {
+	switch tag {
+	case cborTagExtTime, cborTagDuration:
+		secs, nanos, ok := cborSplitNanos(it)
+		if !ok {
+			return slog.Value{}, fmt.Errorf("echo: malformed CBOR tag %d", tag)
+		}
+		if tag == cborTagDuration {
+			return slog.DurationValue(time.Duration(secs)*time.Second + time.Duration(nanos)), nil
+		}
+		return slog.TimeValue(time.Unix(secs, nanos)), nil
+	case cborTagEpochTime:
+		v, err := cborValue(it)
+		if err != nil {
+			return slog.Value{}, err
+		}
+		switch v.Kind() {
+		case slog.KindInt64:
+			return slog.TimeValue(time.Unix(v.Int64(), 0)), nil
+		case slog.KindFloat64:
+			sec, frac := math.Modf(v.Float64())
+			return slog.TimeValue(time.Unix(int64(sec), int64(frac*1e9))), nil
+		}
+	case cborTagRFC3339:
+		if it.major == cborText {
+			if t, err := time.Parse(time.RFC3339Nano, string(it.bytes)); err == nil {
+				return slog.TimeValue(t), nil
+			}
+		}
+	case cborTagJSON:
+		if it.major == cborBytes || it.major == cborText {
+			return slog.AnyValue(json.RawMessage(it.bytes)), nil
+		}
+	case cborTagSelfDescribe:
+	}
+	return cborValue(it)
+}
+
+// cborSplitNanos reads the {1: seconds, -9: nanoseconds} map of RFC 9581.
+func cborSplitNanos(it cborItem) (secs, nanos int64, ok bool) {
+	if it.major != cborMap {
+		return 0, 0, false
+	}
+	for i := 0; i < len(it.items); i += 2 {
+		k, err := cborValue(it.items[i])
+		if err != nil || k.Kind() != slog.KindInt64 {
+			return 0, 0, false
+		}
+		v, err := cborValue(it.items[i+1])
+		if err != nil || v.Kind() != slog.KindInt64 {
+			return 0, 0, false
+		}
+		switch k.Int64() {
+		case 1:
+			secs = v.Int64()
+		case -9:
+			nanos = v.Int64()
+		}
+	}
+	return secs, nanos, true
+}
+
+// sourceFromGroup rebuilds a slog.Source from its encoded form.
+func sourceFromGroup(attrs []slog.Attr) *slog.Source {
+	src := &slog.Source{}
+	for _, a := range attrs {
+		switch a.Key {
+		case "function":
+			src.Function = a.Value.String()
+		case "file":
+			src.File = a.Value.String()
+		case "line":
+			src.Line = int(a.Value.Int64())
+		}
+	}
+	return src
+}
+
+// trimPartialCBOR returns the size the "cbor" format file r of the given
+// size should be truncated to so that it does not end in a partial record,
+// as a crash may leave it. Input that does not decode as CBOR is left whole.
+func trimPartialCBOR(r io.Reader, size int64) (int64, error) {
+	in := &countingReader{r: r}
+	dec := cborDecoder{r: bufio.NewReader(in)}
+	var off int64
+	for {
+		_, err := dec.next()
+		switch {
+		case err == io.EOF:
+			return size, nil
+		case errors.Is(err, ErrTruncated):
+			return off, nil
+		case err != nil:
+			return size, nil
+		}
+		off = in.n - int64(dec.r.Buffered())
+	}
+}
@@ -0,0 +1,238 @@
+package echo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAllCBOR decodes every record in data.
+func readAllCBOR(t *testing.T, data []byte) []slog.Record {
+	t.Helper()
+	var records []slog.Record
+	cr := NewCBORReader(bytes.NewReader(data))
+	for {
+		r, err := cr.Next()
+		if errors.Is(err, io.EOF) {
+			return records
+		}
+		require.NoError(t, err)
+		records = append(records, r)
+	}
+}
+
+// recordAttrs flattens the top-level attributes of r into a map.
+func recordAttrs(r slog.Record) map[string]slog.Value {
+	attrs := map[string]slog.Value{}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	return attrs
+}
+
+func TestCBORHandlerPreservesTypes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newCBORHandler(&buf, &slog.HandlerOptions{Level: LevelDebug}))
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+
+	logger.Debug("typed",
+		slog.String("s", "text"),
+		slog.Int64("neg", -42),
+		slog.Int64("big", math.MaxInt64),
+		slog.Uint64("huge", math.MaxUint64),
+		slog.Float64("f", 3.25),
+		slog.Bool("b", true),
+		slog.Duration("d", -1500*time.Millisecond),
+		slog.Time("t", ts),
+		slog.Any("raw", []byte{0, 1, 2}),
+		slog.Any("err", errors.New("boom")),
+		slog.Any("obj", map[string]int{"a": 1}),
+	)
+
+	records := readAllCBOR(t, buf.Bytes())
+	require.Len(t, records, 1)
+	r := records[0]
+	assert.Equal(t, LevelDebug, r.Level)
+	assert.Equal(t, "typed", r.Message)
+	assert.WithinDuration(t, time.Now(), r.Time, time.Minute)
+
+	attrs := recordAttrs(r)
+	assert.Equal(t, "text", attrs["s"].String())
+	assert.Equal(t, int64(-42), attrs["neg"].Int64())
+	assert.Equal(t, int64(math.MaxInt64), attrs["big"].Int64())
+	assert.Equal(t, uint64(math.MaxUint64), attrs["huge"].Uint64())
+	assert.Equal(t, 3.25, attrs["f"].Float64())
+	assert.True(t, attrs["b"].Bool())
+	assert.Equal(t, -1500*time.Millisecond, attrs["d"].Duration())
+	assert.True(t, ts.Equal(attrs["t"].Time()), "Time should round-trip to the nanosecond")
+	assert.Equal(t, []byte{0, 1, 2}, attrs["raw"].Any())
+	assert.Equal(t, "boom", attrs["err"].String())
+	assert.JSONEq(t, `{"a":1}`, string(attrs["obj"].Any().(json.RawMessage)))
+}
+
+func TestCBORHandlerGroups(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newCBORHandler(&buf, nil)).
+		With("service", "api").
+		WithGroup("req").
+		With("id", 7).
+		WithGroup("http")
+
+	logger.Info("grouped", "status", 200, slog.Group("client", "ip", "10.0.0.1"), slog.Group("empty"))
+	logger.Info("no attrs")
+
+	records := readAllCBOR(t, buf.Bytes())
+	require.Len(t, records, 2)
+
+	attrs := recordAttrs(records[0])
+	assert.Equal(t, "api", attrs["service"].String())
+	req := slog.GroupValue(attrs["req"].Group()...)
+	assert.Equal(t, `[id=7 http=[status=200 client=[ip=10.0.0.1]]]`, req.String())
+
+	// The "http" group is dropped when the record has no attributes of its own.
+	attrs = recordAttrs(records[1])
+	assert.Equal(t, `[id=7]`, slog.GroupValue(attrs["req"].Group()...).String())
+}
+
+// TestCBORReplayMatchesJSON checks that decoded records replayed through a
+// JSONHandler produce the same output as logging to the JSONHandler directly.
+func TestCBORReplayMatchesJSON(t *testing.T) {
+	opts := &slog.HandlerOptions{AddSource: true, Level: LevelDebug}
+	var direct, encoded bytes.Buffer
+	logAll := func(h slog.Handler) {
+		logger := slog.New(h).With("app", "echo").WithGroup("g")
+		logger.Info("first", "n", 1, "ok", true, "took", 250*time.Millisecond)
+		logger.Warn("second", slog.Group("nested", "f", 1.5, "s", "x"))
+	}
+	logAll(slog.NewJSONHandler(&direct, opts))
+	logAll(newCBORHandler(&encoded, opts))
+
+	var replayed bytes.Buffer
+	jh := slog.NewJSONHandler(&replayed, &slog.HandlerOptions{Level: LevelDebug})
+	for _, r := range readAllCBOR(t, encoded.Bytes()) {
+		require.NoError(t, jh.Handle(context.Background(), r))
+	}
+
+	want := bytes.Split(bytes.TrimSpace(direct.Bytes()), []byte("\n"))
+	got := bytes.Split(bytes.TrimSpace(replayed.Bytes()), []byte("\n"))
+	require.Len(t, got, len(want))
+	for i := range want {
+		var w, g map[string]any
+		require.NoError(t, json.Unmarshal(want[i], &w))
+		require.NoError(t, json.Unmarshal(got[i], &g))
+		// Both records come from the same logAll line, but not the same call.
+		delete(w, "time")
+		delete(g, "time")
+		w["source"].(map[string]any)["line"] = nil
+		g["source"].(map[string]any)["line"] = nil
+		assert.Equal(t, w, g)
+	}
+}
+
+func TestCBORReaderTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newCBORHandler(&buf, nil))
+	logger.Info("complete")
+	logger.Info("cut short", "key", "value")
+
+	data := buf.Bytes()[:buf.Len()-4]
+	cr := NewCBORReader(bytes.NewReader(data))
+	r, err := cr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "complete", r.Message)
+	_, err = cr.Next()
+	assert.True(t, errors.Is(err, ErrTruncated), "Expected ErrTruncated, got %v", err)
+}
+
+func TestCBORFileReopenedAfterCrash(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "app.cbor")
+	opts := fileWriterOptions{trimTail: trimPartialCBOR}
+
+	w, err := newFileWriter(logPath, opts)
+	require.NoError(t, err)
+	logger := slog.New(newCBORHandler(w, nil))
+	logger.Info("before the crash")
+	logger.Info("cut short by the crash", "key", "value")
+	require.NoError(t, w.Close())
+
+	fi, err := os.Stat(logPath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(logPath, fi.Size()-4))
+
+	w, err = newFileWriter(logPath, opts)
+	require.NoError(t, err)
+	logger = slog.New(newCBORHandler(w, nil))
+	logger.Info("after the restart")
+	logger.Info("and another")
+	require.NoError(t, w.Close())
+
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	var msgs []string
+	for _, r := range readAllCBOR(t, data) {
+		msgs = append(msgs, r.Message)
+	}
+	assert.Equal(t, []string{"before the crash", "after the restart", "and another"}, msgs)
+}
+
+func TestTrimPartialCBOR(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newCBORHandler(&buf, nil))
+	logger.Info("first")
+	first := buf.Len()
+	logger.Info("second", "key", "value")
+	full := buf.Bytes()
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  int
+	}{
+		{"complete", full, len(full)},
+		{"partial record", full[:len(full)-3], first},
+		{"partial head", full[:first+1], first},
+		{"garbage", []byte{0xff, 0xff}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := trimPartialCBOR(bytes.NewReader(tt.input), int64(len(tt.input)))
+			require.NoError(t, err)
+			assert.Equal(t, int64(tt.want), got)
+		})
+	}
+}
+
+func TestCBORReaderRejectsGarbage(t *testing.T) {
+	_, err := NewCBORReader(bytes.NewReader([]byte{0x01})).Next()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a map")
+}
+
+func BenchmarkCBORHandler(b *testing.B) {
+	benchmarkHandler(b, newCBORHandler(io.Discard, nil))
+}
+
+func BenchmarkJSONHandler(b *testing.B) {
+	benchmarkHandler(b, slog.NewJSONHandler(io.Discard, nil))
+}
+
+func benchmarkHandler(b *testing.B, h slog.Handler) {
+	logger := slog.New(h).With("service", "api")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("request handled", "status", 200, "path", "/v1/items", "took", 3*time.Millisecond, "bytes", 5120)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendLines(t *testing.T, path string, msgs ...string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	defer f.Close()
+	for _, msg := range msgs {
+		_, err := f.WriteString(`{"time":"2024-01-01T00:00:00Z","level":"INFO","msg":"` + msg + `"}` + "\n")
+		require.NoError(t, err)
+	}
+}
+
+// listen accepts connections and passes on the messages of the JSON lines
+// received.
+func listen(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	msgs := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				lines := bufio.NewScanner(conn)
+				for lines.Scan() {
+					var rec struct{ Msg string }
+					if json.Unmarshal(lines.Bytes(), &rec) == nil {
+						msgs <- rec.Msg
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), msgs
+}
+
+func receive(t *testing.T, msgs <-chan string, n int) []string {
+	t.Helper()
+	var got []string
+	for len(got) < n {
+		select {
+		case msg := <-msgs:
+			got = append(got, msg)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %v, want %d messages", got, n)
+		}
+	}
+	return got
+}
+
+// start runs the agent until the returned function is called.
+func start(t *testing.T, cfg config, paths ...string) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- run(ctx, cfg, paths) }()
+	return func() {
+		cancel()
+		require.NoError(t, <-done)
+	}
+}
+
+func TestAgentResumesAcrossRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	addr, msgs := listen(t)
+	cfg := config{to: addr, format: "json", statePath: filepath.Join(dir, "state.json"),
+		batch: 10, flush: 10 * time.Millisecond, checkpoint: time.Hour}
+
+	appendLines(t, path, "a", "b")
+	stop := start(t, cfg, path)
+	assert.Equal(t, []string{"a", "b"}, receive(t, msgs, 2))
+
+	// Rotated while running.
+	appendLines(t, path, "c")
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "app-20240101T000000.000000000.log")))
+	appendLines(t, path, "d")
+	assert.Equal(t, []string{"c", "d"}, receive(t, msgs, 2))
+	stop()
+
+	// Rotated twice while stopped: the rest of the checkpointed file and the
+	// file after it come before the current one.
+	appendLines(t, path, "e")
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "app-20240101T000001.000000000.log")))
+	appendLines(t, path, "f")
+	time.Sleep(10 * time.Millisecond) // Distinct modification times
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "app-20240101T000002.000000000.log")))
+	appendLines(t, path, "g")
+	stop = start(t, cfg, path)
+	assert.Equal(t, []string{"e", "f", "g"}, receive(t, msgs, 3))
+	stop()
+
+	select {
+	case msg := <-msgs:
+		t.Fatalf("unexpected message %q", msg)
+	default:
+	}
+	data, err := os.ReadFile(cfg.statePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), path)
+}
+
+func TestAgentShipsEverythingAcrossRotations(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	addr, msgs := listen(t)
+	cfg := config{to: addr, format: "json", statePath: filepath.Join(dir, "state.json"),
+		batch: 10, flush: 10 * time.Millisecond, checkpoint: time.Hour}
+
+	appendLines(t, path, "start")
+	stop := start(t, cfg, path)
+	defer stop()
+	assert.Equal(t, []string{"start"}, receive(t, msgs, 1))
+
+	// Records are appended right up to each rotation, and several rotations
+	// may happen while the agent waits to poll the file again.
+	const rotations, perFile = 20, 10
+	var want []string
+	for r := range rotations {
+		for i := range perFile {
+			msg := fmt.Sprintf("file %02d line %d", r, i)
+			appendLines(t, path, msg)
+			want = append(want, msg)
+		}
+		require.NoError(t, os.Rename(path, filepath.Join(dir, fmt.Sprintf("app-20240101T0000%02d.000000000.log", r))))
+		time.Sleep(time.Duration(r%4) * time.Millisecond)
+	}
+	appendLines(t, path, "end")
+	want = append(want, "end")
+	assert.Equal(t, want, receive(t, msgs, len(want)))
+}
+
+func TestAgentSymlinkedLog(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "current")
+	addr, msgs := listen(t)
+	cfg := config{to: addr, format: "json", statePath: filepath.Join(dir, "state.json"), originKey: "origin",
+		batch: 10, flush: 10 * time.Millisecond, checkpoint: time.Hour}
+
+	appendLines(t, filepath.Join(dir, "1.log"), "a")
+	require.NoError(t, os.Symlink("1.log", link))
+	stop := start(t, cfg, link)
+	assert.Equal(t, []string{"a"}, receive(t, msgs, 1))
+	stop()
+
+	appendLines(t, filepath.Join(dir, "1.log"), "b")
+	appendLines(t, filepath.Join(dir, "2.log"), "c")
+	require.NoError(t, os.Remove(link))
+	require.NoError(t, os.Symlink("2.log", link))
+	stop = start(t, cfg, link)
+	assert.Equal(t, []string{"b", "c"}, receive(t, msgs, 2))
+
+	// Moving the link while running switches to the new target.
+	appendLines(t, filepath.Join(dir, "3.log"), "d")
+	require.NoError(t, os.Symlink("3.log", link+".new"))
+	require.NoError(t, os.Rename(link+".new", link))
+	assert.Equal(t, []string{"d"}, receive(t, msgs, 1))
+	stop()
+}
+
+func TestAgentRetriesUnsentEntries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close() // Nothing listening yet
+	cfg := config{to: addr, format: "json", statePath: filepath.Join(dir, "state.json"),
+		batch: 10, flush: 10 * time.Millisecond, checkpoint: time.Hour}
+
+	appendLines(t, path, "a")
+	stop := start(t, cfg, path)
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	st, err := loadState(cfg.statePath)
+	require.NoError(t, err)
+	_, ok := st.get(path)
+	assert.False(t, ok, "Nothing sent, nothing checkpointed")
+
+	ln, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+	defer ln.Close()
+	stop = start(t, cfg, path)
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(line, `"msg":"a"`), line)
+	stop()
+}
+
+func TestCheckpointFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLines(t, path, "a")
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var cp checkpoint
+	require.NoError(t, cp.advance(f, 10))
+	assert.Equal(t, int64(10), cp.FPLen, "Only bytes before the offset are hashed")
+	appendLines(t, path, strings.Repeat("x", 2000))
+	require.NoError(t, cp.advance(f, 2100))
+	assert.Equal(t, int64(fingerprintSize), cp.FPLen)
+	assert.True(t, cp.matches(f))
+
+	other := filepath.Join(dir, "other.log")
+	appendLines(t, other, "b")
+	g, err := os.Open(other)
+	require.NoError(t, err)
+	defer g.Close()
+	assert.False(t, cp.matches(g))
+
+	st, err := loadState(filepath.Join(dir, "state.json"))
+	require.NoError(t, err)
+	st.set(path, cp)
+	require.NoError(t, st.save())
+	st, err = loadState(filepath.Join(dir, "state.json"))
+	require.NoError(t, err)
+	got, ok := st.get(path)
+	require.True(t, ok)
+	assert.Equal(t, cp, got)
+}
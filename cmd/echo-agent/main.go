@@ -0,0 +1,162 @@
+// Command echo-agent tails log files written by echo and forwards their
+// entries over TCP, resuming where it left off after a restart.
+//
+// Usage:
+//
+//	echo-agent -to host:port -state file [flags] log ...
+//
+// Each log is followed across rotations, whether echo renames the file
+// (FileMaxSize) or a symbolic link is moved to a new file. Entries are
+// re-encoded in -format (json, text/logfmt or cbor, one record after the
+// other as echo writes them to files) and written to the destination in
+// batches, tagged with the log they came from (-origin).
+//
+// Delivery is at least once. The position reached in each log is saved to
+// the -state file only after the entries up to it have been written to the
+// connection, and a batch whose write fails is sent again, from the start,
+// on a new connection. After a crash or a failed write the destination may
+// thus see entries twice, and a record cut short at the end of the broken
+// connection. A write that succeeded has only reached the peer's socket
+// buffer; TCP gives no stronger acknowledgement.
+//
+// Positions are tied to the file they were taken in by a fingerprint of its
+// first bytes, not its name. If a log was rotated while the agent was down,
+// or more than once while it was finishing the old file, the rest of the old
+// file and any files rotated after it are shipped before the current one. With no saved position a log is shipped from its
+// start, or from its end with -from-end.
+//
+// Only plain log files can be shipped: compressed and encrypted output has
+// no position to resume from. Echo has no network outputs of its own, so
+// TCP is the only destination; anything that reads echo's formats from a
+// socket can receive it.
+//
+// Examples:
+//
+//	echo-agent -to collector:5170 -state /var/lib/echo-agent.json /var/log/app/app.log
+//	echo-agent -to 10.0.0.5:9000 -format cbor -state agent.json -from-end a.log b.log
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/tail"
+)
+
+// config holds the flag values.
+type config struct {
+	to, format, statePath, originKey string
+	fromEnd                          bool
+	batch                            int
+	flush, checkpoint                time.Duration
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.to, "to", "", "destination host:port (required)")
+	flag.StringVar(&cfg.format, "format", "json", "format sent: json, text, logfmt or cbor")
+	flag.StringVar(&cfg.statePath, "state", "", "file keeping the positions reached in each log (required)")
+	flag.StringVar(&cfg.originKey, "origin", "origin", "attribute holding the log file name; empty to omit")
+	flag.BoolVar(&cfg.fromEnd, "from-end", false, "start logs with no saved position at their end instead of their start")
+	flag.IntVar(&cfg.batch, "batch", 500, "most entries per write")
+	flag.DurationVar(&cfg.flush, "flush", time.Second, "longest time an entry waits to be sent")
+	flag.DurationVar(&cfg.checkpoint, "checkpoint", 5*time.Second, "how often positions are saved")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -to host:port -state file [flags] log ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if cfg.to == "" || cfg.statePath == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, cfg, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "echo-agent: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func warn(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "warning: "+format+"\n", args...)
+}
+
+// run ships the logs at paths until ctx is done or one of them fails.
+func run(ctx context.Context, cfg config, paths []string) (err error) {
+	if cfg.batch < 1 || cfg.flush <= 0 || cfg.checkpoint <= 0 {
+		return fmt.Errorf("-batch, -flush and -checkpoint must be positive")
+	}
+	st, err := loadState(cfg.statePath)
+	if err != nil {
+		return err
+	}
+	s, err := newSender(cfg.to, cfg.format, st)
+	if err != nil {
+		return err
+	}
+	s.warn = warn
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	a := &agent{
+		state:     st,
+		opts:      &echo.ReaderOptions{},
+		items:     make(chan item, cfg.batch),
+		originKey: cfg.originKey,
+		fromEnd:   cfg.fromEnd,
+		poll:      tail.DefaultPoll,
+		warn:      warn,
+	}
+	var wg sync.WaitGroup
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.follow(ctx, abs); err != nil {
+				cancel(err)
+			}
+		}()
+	}
+	sent := make(chan struct{})
+	go func() {
+		s.run(ctx, a.items, cfg.batch, cfg.flush)
+		close(sent)
+	}()
+
+	ticker := time.NewTicker(cfg.checkpoint)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			done = true
+		}
+		if err := st.save(); err != nil {
+			warn("%v", err)
+		}
+	}
+	wg.Wait()
+	close(a.items)
+	<-sent
+	if err := st.save(); err != nil {
+		return err
+	}
+	if err := context.Cause(ctx); err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
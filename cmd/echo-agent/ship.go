@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/tail"
+)
+
+// item is an entry on its way to the network, with the checkpoint to
+// record for its log once it has been sent.
+type item struct {
+	log   string
+	entry echo.Entry
+	cp    checkpoint
+}
+
+// agent ships logs to one destination.
+type agent struct {
+	state     *state
+	opts      *echo.ReaderOptions
+	items     chan item
+	originKey string
+	fromEnd   bool
+	poll      time.Duration
+	warn      func(format string, args ...any)
+}
+
+// follow ships the log at path until ctx is done: first whatever was left
+// since its checkpoint, then each file that appears at path, from its start.
+// Files rotated away before the agent got to them, while it was down or
+// finishing the file before, are shipped in between.
+func (a *agent) follow(ctx context.Context, path string) error {
+	resume, ok := a.state.get(path)
+	if !ok && a.fromEnd {
+		if fi, err := os.Stat(path); err == nil {
+			resume.Offset = fi.Size()
+		}
+	}
+	for ctx.Err() == nil {
+		fl, err := a.open(ctx, path, resume.Offset)
+		if err != nil {
+			return err
+		}
+		if ok && !resume.matches(fl.File()) {
+			// Rotated since the checkpoint: finish the old file first.
+			fl.Close()
+			if err := a.catchUp(ctx, path, resume); err != nil {
+				return err
+			}
+			resume = checkpoint{}
+			if fl, err = a.open(ctx, path, 0); err != nil {
+				return err
+			}
+		}
+		resume, err = a.ship(ctx, path, fl, fl.Offset(), fl.File, resume)
+		fl.Close()
+		if err != nil {
+			return err
+		}
+		// The file has been rotated away and read to its end. Its final
+		// checkpoint leads to any file rotated after it before the one
+		// now at path, unless nothing in it was shipped.
+		ok = resume.FPLen > 0
+	}
+	return nil
+}
+
+// open follows the file at path from offset until it is rotated away.
+func (a *agent) open(ctx context.Context, path string, offset int64) (*tail.Follower, error) {
+	fl, err := tail.Open(ctx, path, offset)
+	if err != nil {
+		return nil, err
+	}
+	fl.SetPoll(a.poll)
+	fl.SetSingleFile(true)
+	return fl, nil
+}
+
+// catchUp looks for the file cp was taken in among the older files of the
+// log at path, and ships the rest of it and of every file after it.
+func (a *agent) catchUp(ctx context.Context, path string, cp checkpoint) error {
+	files, err := olderFiles(path)
+	if err != nil {
+		return err
+	}
+	for i, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		match := cp.matches(f)
+		f.Close()
+		if !match {
+			continue
+		}
+		for j, name := range files[i:] {
+			start := checkpoint{}
+			if j == 0 {
+				start = cp
+			}
+			if err := a.shipFile(ctx, path, name, start); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	a.warn("%s: the checkpointed file is gone; starting over with the current file", path)
+	return nil
+}
+
+// olderFiles lists the files that may hold earlier parts of the log at path,
+// oldest first: its rotated segments as named by echo and, when path is a
+// symbolic link, the files beside its target with the target's extension,
+// as left by tools that rotate by moving the link. The current file at path
+// is left out.
+func olderFiles(path string) ([]string, error) {
+	files, err := echo.Segments(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil, err
+		}
+		siblings, _ := filepath.Glob(filepath.Join(filepath.Dir(target), "*"+filepath.Ext(target)))
+		files = append(files, siblings...)
+	}
+
+	cur, _ := os.Stat(path)
+	type file struct {
+		name string
+		mod  time.Time
+	}
+	var older []file
+	for _, name := range files {
+		fi, err := os.Stat(name)
+		if err != nil || !fi.Mode().IsRegular() || (cur != nil && os.SameFile(fi, cur)) ||
+			slices.ContainsFunc(older, func(f file) bool { return f.name == name }) {
+			continue
+		}
+		older = append(older, file{name, fi.ModTime()})
+	}
+	slices.SortStableFunc(older, func(x, y file) int {
+		if c := x.mod.Compare(y.mod); c != 0 {
+			return c
+		}
+		return strings.Compare(x.name, y.name)
+	})
+	names := make([]string, len(older))
+	for i, f := range older {
+		names[i] = f.name
+	}
+	return names, nil
+}
+
+// shipFile ships the file name from the checkpoint start, as part of log.
+func (a *agent) shipFile(ctx context.Context, log, name string, start checkpoint) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(start.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = a.ship(ctx, log, f, start.Offset, func() *os.File { return f }, start)
+	return err
+}
+
+// ship reads entries from r, which starts at offset base in the file
+// returned by file, and queues them with their checkpoints until r ends or
+// ctx is done. It returns the checkpoint of the last entry queued, or cp if
+// there was none.
+func (a *agent) ship(ctx context.Context, log string, r io.Reader, base int64, file func() *os.File, cp checkpoint) (checkpoint, error) {
+	rd, err := echo.NewReader(r, a.opts)
+	if err != nil {
+		return cp, fmt.Errorf("%s: %w", log, err)
+	}
+	defer rd.Close()
+	if _, ok := rd.Offset(); !ok {
+		return cp, fmt.Errorf("%s: compressed and encrypted logs cannot be shipped", log)
+	}
+	for {
+		e, err := rd.Next()
+		var perr *echo.ParseError
+		switch {
+		case errors.Is(err, io.EOF):
+			return cp, nil
+		case errors.As(err, &perr):
+			a.warn("%v", perr)
+			continue
+		case err != nil:
+			return cp, fmt.Errorf("%s: %w", log, err)
+		}
+		next := cp
+		offset, _ := rd.Offset()
+		if err := next.advance(file(), base+offset); err != nil {
+			return cp, fmt.Errorf("%s: %w", log, err)
+		}
+		if a.originKey != "" {
+			e.Attrs = append([]slog.Attr{slog.String(a.originKey, log)}, e.Attrs...)
+		}
+		select {
+		case a.items <- item{log, e, next}:
+			cp = next
+		case <-ctx.Done():
+			return cp, nil
+		}
+	}
+}
+
+// sender writes batches of items to a TCP destination, reconnecting as
+// needed, and advances the checkpoints of the items it has written.
+type sender struct {
+	addr    string
+	state   *state
+	h       slog.Handler
+	buf     bytes.Buffer
+	conn    net.Conn
+	timeout time.Duration
+	backoff time.Duration // Longest wait between connection attempts
+	warn    func(format string, args ...any)
+}
+
+func newSender(addr, format string, st *state) (*sender, error) {
+	s := &sender{addr: addr, state: st, timeout: 10 * time.Second, backoff: 30 * time.Second}
+	h, err := echo.NewFormatHandler(format, &s.buf, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.h = h
+	return s, nil
+}
+
+// run sends items until the channel is closed, in batches of up to size
+// items or whatever arrived within flush. Once ctx is done, a batch gets
+// a single attempt.
+func (s *sender) run(ctx context.Context, items <-chan item, size int, flush time.Duration) {
+	defer s.close()
+	var batch []item
+	timer := time.NewTimer(flush)
+	defer timer.Stop()
+	for {
+		select {
+		case it, ok := <-items:
+			if !ok {
+				s.send(ctx, batch)
+				return
+			}
+			batch = append(batch, it)
+			if len(batch) < size {
+				continue
+			}
+		case <-timer.C:
+		}
+		if !s.send(ctx, batch) {
+			// Shutting down with the destination unreachable: the batch is
+			// sent again from the checkpoints on the next start.
+			for range items {
+			}
+			return
+		}
+		batch = batch[:0]
+		timer.Reset(flush)
+	}
+}
+
+// send writes batch, retrying with backoff until it succeeds or ctx is
+// done, and reports whether it was written.
+func (s *sender) send(ctx context.Context, batch []item) bool {
+	if len(batch) == 0 {
+		return true
+	}
+	s.buf.Reset()
+	for _, it := range batch {
+		if err := s.h.Handle(ctx, it.entry.Record()); err != nil {
+			s.warn("%s: %v", it.log, err)
+		}
+	}
+	wait := 100 * time.Millisecond
+	for {
+		err := s.write(s.buf.Bytes())
+		if err == nil {
+			break
+		}
+		s.warn("%s: %v", s.addr, err)
+		s.close()
+		if ctx.Err() != nil {
+			return false
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return false
+		}
+		wait = min(2*wait, s.backoff)
+	}
+	for _, it := range batch {
+		s.state.set(it.log, it.cp)
+	}
+	return true
+}
+
+func (s *sender) write(p []byte) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.addr, s.timeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	_, err := s.conn.Write(p)
+	return err
+}
+
+func (s *sender) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
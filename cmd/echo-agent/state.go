@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fingerprintSize is how much of the start of a file identifies it. Inodes
+// are reused and names move on rotation, but the first line of a log file,
+// with its timestamp, is as good as unique.
+const fingerprintSize = 1024
+
+// checkpoint records how far a log has been shipped: up to Offset in the
+// file whose first FPLen bytes hash to FP.
+type checkpoint struct {
+	Offset int64  `json:"offset"`
+	FPLen  int64  `json:"fp_len"`
+	FP     string `json:"fp"`
+}
+
+// fingerprint hashes the first n bytes of f.
+func fingerprint(f *os.File, n int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, n)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// advance moves cp to offset in f, extending the fingerprint while it is
+// shorter than fingerprintSize. Only bytes before offset are hashed, so
+// they have been written already and will not change.
+func (cp *checkpoint) advance(f *os.File, offset int64) error {
+	cp.Offset = offset
+	if n := min(offset, fingerprintSize); n > cp.FPLen {
+		fp, err := fingerprint(f, n)
+		if err != nil {
+			return err
+		}
+		cp.FP, cp.FPLen = fp, n
+	}
+	return nil
+}
+
+// matches reports whether f is the file cp was taken in.
+func (cp checkpoint) matches(f *os.File) bool {
+	if f == nil || cp.FPLen == 0 {
+		return false
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() < cp.FPLen {
+		return false
+	}
+	fp, err := fingerprint(f, cp.FPLen)
+	return err == nil && fp == cp.FP
+}
+
+// state holds the checkpoints of all logs, keyed by absolute path, and
+// persists them to a JSON file.
+type state struct {
+	path  string
+	mu    sync.Mutex
+	logs  map[string]checkpoint
+	dirty bool
+}
+
+// loadState reads the state file at path. A missing file is an empty state.
+func loadState(path string) (*state, error) {
+	s := &state{path: path, logs: map[string]checkpoint{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.logs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *state) get(log string) (checkpoint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.logs[log]
+	return cp, ok
+}
+
+func (s *state) set(log string, cp checkpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs[log] = cp
+	s.dirty = true
+}
+
+// save writes the state if it changed, atomically: to a temporary file that
+// is synced and then renamed over the old one, so a crash leaves either the
+// old or the new checkpoints, never a mix.
+func (s *state) save() error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(s.logs, "", "  ")
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+	// Make the rename itself durable.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
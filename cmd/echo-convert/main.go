@@ -0,0 +1,97 @@
+// Command echo-convert converts log files between echo's formats.
+//
+// Usage:
+//
+//	echo-convert -to format [flags] [file|glob ...]
+//
+// Input is read as echo-view reads it: any echo format, compressed or
+// encrypted, globs in name order, stdin when no file is given. Entries are
+// written with the same handlers Init uses for log files, so the output is
+// what echo would have written in that format. Formats are json, text,
+// logfmt (the same as text) and cbor, and for output to other backends also
+// ecs (Elastic Common Schema JSON) and otlp (OpenTelemetry OTLP JSON, one
+// request per line).
+//
+// Text output has millisecond time precision, and text input does not keep
+// the types of quoted values; other conversions keep entries as they are.
+//
+//	echo-convert -to json -o app.json 'logs/app*.cbor'
+//	echo-convert -from logfmt -to cbor < legacy.log > legacy.cbor
+//	echo-convert -to otlp -o app.otlp.jsonl logs/app.log
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+func main() {
+	var (
+		to   = flag.String("to", "", "output format: json, text, logfmt, cbor, ecs or otlp (required)")
+		from = flag.String("from", "", "input format, if it cannot be detected: json, text, logfmt or cbor")
+		out  = flag.String("o", "", "output file (default stdout)")
+		key  = flag.String("key", "", "PEM-encoded RSA private key for encrypted files")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -to format [flags] [file|glob ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *to == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*to, *from, *out, *key, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "echo-convert: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(to, from, out, key string, args []string) (err error) {
+	opts := &echo.ReaderOptions{Format: from}
+	if key != "" {
+		if opts.KeyUnwrapper, err = cli.LoadKeyUnwrapper(key); err != nil {
+			return err
+		}
+	}
+	paths, err := cli.ExpandArgs(args)
+	if err != nil {
+		return err
+	}
+
+	f := os.Stdout
+	if out != "" {
+		if f, err = os.Create(out); err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+	} else if to == "cbor" && cli.IsTerminal(f) {
+		return fmt.Errorf("not writing binary output to a terminal; use -o or redirect stdout")
+	}
+	w := bufio.NewWriter(f)
+	defer func() {
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+
+	h, err := echo.NewFormatHandler(to, w, nil)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	return cli.ReadEntries(paths, opts, os.Stderr, func(_ string, e echo.Entry) error {
+		return h.Handle(ctx, e.Record())
+	})
+}
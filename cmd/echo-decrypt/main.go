@@ -0,0 +1,77 @@
+// Command echo-decrypt decrypts log files written by echo with
+// Config.FileEncryptionKey set to an RSA key wrapper.
+//
+// Usage:
+//
+//	echo-decrypt -key private.pem [file ...]
+//
+// Plaintext records are written to stdout. With no files, stdin is read.
+// Files cut short by a crash are decrypted up to their last complete record
+// and reported on stderr.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+func main() {
+	keyPath := flag.String("key", "", "PEM-encoded RSA private key (PKCS#1 or PKCS#8)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -key private.pem [file ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *keyPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*keyPath, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "echo-decrypt: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(keyPath string, files []string) error {
+	ku, err := cli.LoadKeyUnwrapper(keyPath)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return decrypt(os.Stdout, os.Stdin, "<stdin>", ku)
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = decrypt(os.Stdout, f, name, ku)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decrypt copies the plaintext of src to dst. A truncated input is reported
+// but not treated as a failure, as everything readable has been written.
+func decrypt(dst io.Writer, src io.Reader, name string, ku echo.KeyUnwrapper) error {
+	_, err := io.Copy(dst, echo.NewDecryptReader(src, ku))
+	if errors.Is(err, echo.ErrTruncated) {
+		fmt.Fprintf(os.Stderr, "echo-decrypt: %s: truncated, decrypted up to the last complete record\n", name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Command echo-merge merges log files written by echo into one stream in
+// time order, tagging each entry with the file it came from.
+//
+// Usage:
+//
+//	echo-merge [flags] file|glob ...
+//
+// Files may be in any echo format, compressed or encrypted, and formats may
+// be mixed. Each file is read in order and only one entry per file is held
+// in memory, so files of any size can be merged. Every file stays open, with
+// its decompressor if any, until its last entry has been merged, so the
+// number of files is bounded by the open file limit (ulimit -n). Entries
+// without a time stay after the entry that preceded them in their file.
+//
+// Clocks of different hosts rarely agree. -offset shifts the times of the
+// files whose path or base name matches a pattern, before merging; the
+// shifted times are the ones written out:
+//
+//	echo-merge -offset 'db-*.log=-1.5s' -offset api.log=200ms api.log db-*.log
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+// offset shifts the times of the inputs matching pattern.
+type offset struct {
+	pattern string
+	d       time.Duration
+	used    bool
+}
+
+// offsetFlag collects repeated -offset pattern=duration flags.
+type offsetFlag []*offset
+
+func (f *offsetFlag) String() string { return "" }
+
+func (f *offsetFlag) Set(s string) error {
+	pattern, d, ok := strings.Cut(s, "=")
+	if !ok || pattern == "" {
+		return fmt.Errorf("want pattern=duration")
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return err
+	}
+	dur, err := time.ParseDuration(d)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, &offset{pattern: pattern, d: dur})
+	return nil
+}
+
+// lookup returns the offset for path: that of the last matching flag.
+func (f offsetFlag) lookup(path string) time.Duration {
+	var d time.Duration
+	for _, o := range f {
+		if matchPath(o.pattern, path) {
+			d, o.used = o.d, true
+		}
+	}
+	return d
+}
+
+func matchPath(pattern, path string) bool {
+	if ok, _ := filepath.Match(pattern, path); ok {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, filepath.Base(path))
+	return ok
+}
+
+func main() {
+	var offsets offsetFlag
+	var (
+		format    = flag.String("o", "pretty", "output format: pretty, text or json")
+		color     = flag.String("color", "auto", "colourise pretty output: auto, always or never")
+		originKey = flag.String("origin", "origin", "attribute holding the source file name; empty to omit")
+		key       = flag.String("key", "", "PEM-encoded RSA private key for encrypted files")
+	)
+	flag.Var(&offsets, "offset", "shift times of files matching `pattern=duration`, e.g. 'db-*.log=-1.5s' (repeatable)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] file|glob ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*format, *color, *originKey, *key, offsets, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "echo-merge: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(format, color, originKey, key string, offsets offsetFlag, args []string) (err error) {
+	opts := &echo.ReaderOptions{}
+	if key != "" {
+		if opts.KeyUnwrapper, err = cli.LoadKeyUnwrapper(key); err != nil {
+			return err
+		}
+	}
+	paths, err := cli.ExpandArgs(args)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+	write, err := newWriter(format, color, w)
+	if err != nil {
+		return err
+	}
+
+	// Inputs close themselves at their end; this covers leaving early.
+	inputs := make([]*input, 0, len(paths))
+	defer func() {
+		for _, in := range inputs {
+			if in.rd != nil {
+				in.rd.Close()
+			}
+		}
+	}()
+	for i, path := range paths {
+		rd, err := cli.Open(path, opts)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, &input{name: path, rd: rd, offset: offsets.lookup(path), index: i})
+	}
+	for _, o := range offsets {
+		if !o.used {
+			return fmt.Errorf("-offset %s matches no file", o.pattern)
+		}
+	}
+
+	m, err := newMerger(inputs, os.Stderr)
+	if err != nil {
+		return err
+	}
+	for {
+		in, e, err := m.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if originKey != "" {
+			e.Attrs = append([]slog.Attr{slog.String(originKey, in.name)}, e.Attrs...)
+		}
+		if err := write(e); err != nil {
+			return err
+		}
+	}
+}
+
+// newWriter returns a function writing entries in the given format.
+func newWriter(format, color string, w io.Writer) (func(echo.Entry) error, error) {
+	var h slog.Handler
+	switch format {
+	case "pretty":
+		useColor, err := cli.ParseColor(color, os.Stdout)
+		if err != nil {
+			return nil, err
+		}
+		return (&cli.Printer{W: w, Color: useColor}).Print, nil
+	case "text":
+		h = slog.NewTextHandler(w, nil)
+	case "json":
+		h = slog.NewJSONHandler(w, nil)
+	default:
+		return nil, fmt.Errorf("invalid -o %q: want pretty, text or json", format)
+	}
+	return func(e echo.Entry) error {
+		return h.Handle(context.Background(), e.Record())
+	}, nil
+}
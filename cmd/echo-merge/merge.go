@@ -0,0 +1,120 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+)
+
+// input is one file being merged. It holds its next entry, so the merge
+// keeps a single entry in memory per input.
+type input struct {
+	name   string
+	rd     *echo.Reader // Nil once closed at the end of the input
+	offset time.Duration
+	index  int // Position on the command line, to break ties
+
+	cur  echo.Entry
+	at   time.Time // Merge time of cur
+	last time.Time // Merge time of the previous entry
+}
+
+// advance reads the next entry, skipping unparseable lines. It reports
+// false at the end of the input, where it closes the reader, so that a file
+// is only open while it has entries left to merge. Entries without a time
+// keep the position of the entry before them.
+func (in *input) advance(warn io.Writer) (bool, error) {
+	for {
+		e, err := in.rd.Next()
+		var perr *echo.ParseError
+		switch {
+		case errors.Is(err, io.EOF):
+			err = in.rd.Close()
+			in.rd = nil
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", in.name, err)
+			}
+			return false, nil
+		case errors.As(err, &perr):
+			fmt.Fprintf(warn, "warning: %v\n", perr)
+			continue
+		case err != nil:
+			return false, fmt.Errorf("%s: %w", in.name, err)
+		}
+		if !e.Time.IsZero() {
+			e.Time = e.Time.Add(in.offset)
+			in.last = e.Time
+		}
+		in.cur, in.at = e, in.last
+		return true, nil
+	}
+}
+
+// merger merges inputs by time. Each input is expected to be in time order
+// already, as a log file is; entries of an input never overtake each other.
+type merger struct {
+	h    inputHeap
+	warn io.Writer
+}
+
+func newMerger(inputs []*input, warn io.Writer) (*merger, error) {
+	m := &merger{warn: warn}
+	for _, in := range inputs {
+		ok, err := in.advance(warn)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			m.h = append(m.h, in)
+		}
+	}
+	heap.Init(&m.h)
+	return m, nil
+}
+
+// next returns the earliest pending entry and the input it came from, or
+// io.EOF once all inputs are done.
+func (m *merger) next() (*input, echo.Entry, error) {
+	if len(m.h) == 0 {
+		return nil, echo.Entry{}, io.EOF
+	}
+	in := m.h[0]
+	e := in.cur
+	ok, err := in.advance(m.warn)
+	if err != nil {
+		return nil, echo.Entry{}, err
+	}
+	if ok {
+		heap.Fix(&m.h, 0)
+	} else {
+		heap.Pop(&m.h)
+	}
+	return in, e, nil
+}
+
+// inputHeap orders inputs by the time of their pending entry.
+type inputHeap []*input
+
+func (h inputHeap) Len() int { return len(h) }
+
+func (h inputHeap) Less(i, j int) bool {
+	if !h[i].at.Equal(h[j].at) {
+		return h[i].at.Before(h[j].at)
+	}
+	return h[i].index < h[j].index
+}
+
+func (h inputHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *inputHeap) Push(x any) { *h = append(*h, x.(*input)) }
+
+func (h *inputHeap) Pop() any {
+	old := *h
+	in := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return in
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newInput(t *testing.T, index int, name, data string, offset time.Duration) *input {
+	t.Helper()
+	rd, err := echo.NewReader(strings.NewReader(data), nil)
+	require.NoError(t, err)
+	return &input{name: name, rd: rd, offset: offset, index: index}
+}
+
+func TestMergeOrder(t *testing.T) {
+	api := `{"time":"2024-01-01T00:00:01Z","level":"INFO","msg":"api 1"}
+{"time":"2024-01-01T00:00:03Z","level":"INFO","msg":"api 3"}
+{"level":"INFO","msg":"api no time"}
+{"time":"2024-01-01T00:00:05Z","level":"INFO","msg":"api 5"}
+`
+	db := `time=2024-01-01T00:00:02.000Z level=WARN msg="db 2"
+not a record
+time=2024-01-01T00:00:03.000Z level=WARN msg="db 3"
+`
+	// The worker's clock runs 10s ahead.
+	worker := `{"time":"2024-01-01T00:00:14Z","level":"INFO","msg":"worker 4"}
+`
+	var warn bytes.Buffer
+	inputs := []*input{
+		newInput(t, 0, "api.log", api, 0),
+		newInput(t, 1, "db.log", db, 0),
+		newInput(t, 2, "worker.log", worker, -10*time.Second),
+	}
+	m, err := newMerger(inputs, &warn)
+	require.NoError(t, err)
+
+	var got []string
+	for {
+		in, e, err := m.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, in.name+": "+e.Message)
+		if e.Message == "worker 4" {
+			assert.Equal(t, 4, e.Time.Second(), "The offset should be applied to the entry")
+			assert.Nil(t, inputs[2].rd, "An input should be closed once it is done")
+			assert.NotNil(t, inputs[0].rd)
+		}
+	}
+	assert.Equal(t, []string{
+		"api.log: api 1",
+		"db.log: db 2",
+		"api.log: api 3", // Ties go to the earlier input
+		"api.log: api no time",
+		"db.log: db 3",
+		"worker.log: worker 4",
+		"api.log: api 5",
+	}, got)
+	assert.Contains(t, warn.String(), "line 2", "Unparseable lines should be reported")
+}
+
+func TestOffsetFlag(t *testing.T) {
+	var f offsetFlag
+	require.NoError(t, f.Set("db-*.log=-1.5s"))
+	require.NoError(t, f.Set("logs/db-2.log=1s"))
+	assert.Error(t, f.Set("api.log"))
+	assert.Error(t, f.Set("api.log=soon"))
+
+	assert.Equal(t, -1500*time.Millisecond, f.lookup("other/db-1.log"), "Base names should match")
+	assert.Equal(t, time.Second, f.lookup("logs/db-2.log"), "The last match should win")
+	assert.Zero(t, f.lookup("api.log"))
+}
@@ -0,0 +1,98 @@
+// Command echo-parquet exports log files written by echo to Parquet, for
+// analysis with columnar tools.
+//
+// Usage:
+//
+//	echo-parquet -o dir [flags] file|glob ...
+//
+// Files may be in any echo format, compressed (.gz, .zst) or encrypted (with
+// -key). They are read twice, once to infer the schema and once to write,
+// so stdin cannot be read. Frequent attributes become columns and the
+// others are kept in a JSON column; see the parquet package for the
+// layout. A file is written per day under dir, in date=YYYY-MM-DD
+// directories, replacing the files of earlier exports of the same days.
+//
+//	echo-parquet -o archive 'logs/app*.log.gz'
+//	echo-parquet -o archive -min-frequency 0.2 -tz Europe/Paris app.log
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+	"github.com/altitude-analytics/echo/parquet"
+)
+
+func main() {
+	var (
+		out      = flag.String("o", "", "output directory (required unless -schema)")
+		minFreq  = flag.Float64("min-frequency", parquet.DefaultMinFrequency, "share of entries an attribute must be found in to get a column")
+		maxCols  = flag.Int("max-columns", parquet.DefaultMaxColumns, "maximum number of attribute columns")
+		rowGroup = flag.Int("row-group", parquet.DefaultRowGroupSize, "rows per row group")
+		tz       = flag.String("tz", "UTC", "time zone of partition dates, e.g. Local or Europe/Paris")
+		schema   = flag.Bool("schema", false, "print the inferred schema instead of exporting")
+		key      = flag.String("key", "", "PEM-encoded RSA private key for encrypted files")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -o dir [flags] file|glob ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if (*out == "" && !*schema) || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := &parquet.Options{MinFrequency: *minFreq, MaxColumns: *maxCols, RowGroupSize: *rowGroup}
+	if err := run(*out, *tz, *key, *schema, opts, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "echo-parquet: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(out, tz, key string, schema bool, opts *parquet.Options, args []string) error {
+	var err error
+	if opts.Location, err = time.LoadLocation(tz); err != nil {
+		return err
+	}
+	opts.ReaderOptions = &echo.ReaderOptions{}
+	if key != "" {
+		if opts.ReaderOptions.KeyUnwrapper, err = cli.LoadKeyUnwrapper(key); err != nil {
+			return err
+		}
+	}
+	paths, err := cli.ExpandArgs(args)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(paths, cli.Stdin) {
+		return fmt.Errorf("cannot read stdin: files are read twice")
+	}
+	opts.OnParseError = func(perr *echo.ParseError) {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", perr)
+	}
+
+	if schema {
+		s, err := parquet.InferSchema(paths, opts)
+		if err != nil {
+			return err
+		}
+		for _, c := range s.Columns() {
+			fmt.Printf("%s\t%s\n", c.Name, c.Type)
+		}
+		return nil
+	}
+	parts, err := parquet.Export(out, paths, opts)
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		fmt.Printf("%s\t%d rows\n", p.Path, p.Rows)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Command echo-query filters and aggregates log files written by echo.
+//
+// Usage:
+//
+//	echo-query [flags] query [file|glob ...]
+//
+// A query is a filter expression and/or stages separated by '|'. Files are
+// read as echo-view reads them: any echo format, compressed or encrypted,
+// globs in name order, stdin when no file is given. Entries are streamed, so
+// only aggregations and sorting hold results in memory.
+//
+// Filter expressions compare fields with values and combine them with and,
+// or, not and parentheses:
+//
+//	level>=warn and (http.status>=500 or msg ~ "timeout")
+//
+// Fields are time, level, msg, source and attributes by dotted path. The
+// operators are = (or ==), !=, <, <=, >, >=, ~ and !~ (regular expression
+// match). Values are interpreted by the field's type: level names for level,
+// times or durations ago (15m) for time, numbers or durations (5ms, compared
+// as nanoseconds in JSON logs) for numeric attributes. Ordering a number
+// against a non-number never matches. A bare field matches entries that have
+// it; comparisons on missing fields never match. Values with spaces or
+// operator characters need quotes.
+//
+// Stages:
+//
+//	where <expr>                        filter (a bare expression means the same)
+//	fields f1, f2 ...                   output only these fields
+//	count, sum f, avg f, min f, max f   aggregate, optionally "by f1, f2 ..."
+//	sort <column> [asc|desc]            sort the results
+//	top <n> [column]                    sort descending and keep n; the column
+//	                                    defaults to the first aggregate
+//	head <n>, limit <n>                 keep the first n results
+//
+// Aggregate columns are named count, avg(f) and so on, and can be used by
+// later stages:
+//
+//	echo-query 'level>=warn and http.status>=500 | count by route | top 10' app*.log*
+//	echo-query -o csv 'avg took, max took by route | where avg(took) > 0.5' app.log
+//	echo-query -o json 'msg ~ "^panic" | fields time, msg, request_id' app.log
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+	"github.com/altitude-analytics/echo/internal/query"
+)
+
+func main() {
+	var (
+		format = flag.String("o", "table", "output format: table, json or csv")
+		color  = flag.String("color", "auto", "colourise table output of entries: auto, always or never")
+		key    = flag.String("key", "", "PEM-encoded RSA private key for encrypted files")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] query [file|glob ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*format, *color, *key, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "echo-query: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(format, color, key, q string, args []string) (err error) {
+	parsed, err := query.Parse(q)
+	if err != nil {
+		return err
+	}
+
+	useColor, err := cli.ParseColor(color, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	opts := &echo.ReaderOptions{}
+	if key != "" {
+		if opts.KeyUnwrapper, err = cli.LoadKeyUnwrapper(key); err != nil {
+			return err
+		}
+	}
+	paths, err := cli.ExpandArgs(args)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+	out, err := newOutput(format, w, parsed.Columns(), useColor)
+	if err != nil {
+		return err
+	}
+
+	x := query.NewExec(parsed, out)
+	err = cli.ReadEntries(paths, opts, os.Stderr, func(_ string, e echo.Entry) error {
+		return x.Push(e)
+	})
+	if err != nil && !errors.Is(err, cli.ErrStop) {
+		return err
+	}
+	if err := x.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+// output writes query results in one of the -o formats.
+type output interface {
+	Entry(e echo.Entry) error
+	Row(values []slog.Value) error
+	Close() error
+}
+
+func newOutput(format string, w io.Writer, columns []string, color bool) (output, error) {
+	switch format {
+	case "table":
+		return newTableOutput(w, columns, color), nil
+	case "json":
+		return &jsonOutput{w: w, columns: columns, entries: slog.NewJSONHandler(w, nil)}, nil
+	case "csv":
+		return newCSVOutput(w, columns)
+	}
+	return nil, fmt.Errorf("invalid -o %q: want table, json or csv", format)
+}
+
+// tableOutput prints entries like echo-view and rows as aligned columns.
+// Columns are aligned over the whole result, so rows are written on Close.
+type tableOutput struct {
+	printer *cli.Printer
+	tw      *tabwriter.Writer
+}
+
+func newTableOutput(w io.Writer, columns []string, color bool) *tableOutput {
+	t := &tableOutput{printer: &cli.Printer{W: w, Color: color}}
+	if columns != nil {
+		t.tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(t.tw, strings.ToUpper(strings.Join(columns, "\t")))
+	}
+	return t
+}
+
+func (t *tableOutput) Entry(e echo.Entry) error { return t.printer.Print(e) }
+
+func (t *tableOutput) Row(values []slog.Value) error {
+	for i, v := range values {
+		if i > 0 {
+			t.tw.Write([]byte{'\t'})
+		}
+		t.tw.Write([]byte(cellString(v)))
+	}
+	_, err := t.tw.Write([]byte{'\n'})
+	return err
+}
+
+func (t *tableOutput) Close() error {
+	if t.tw == nil {
+		return nil
+	}
+	return t.tw.Flush()
+}
+
+// jsonOutput writes one JSON object per line: entries as slog's JSONHandler
+// writes them, rows keyed by column name.
+type jsonOutput struct {
+	w       io.Writer
+	columns []string
+	entries slog.Handler
+	buf     bytes.Buffer
+}
+
+func (j *jsonOutput) Entry(e echo.Entry) error {
+	return j.entries.Handle(context.Background(), e.Record())
+}
+
+func (j *jsonOutput) Row(values []slog.Value) error {
+	j.buf.Reset()
+	j.buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			j.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(j.columns[i])
+		val, err := json.Marshal(jsonValue(v))
+		if err != nil {
+			return err
+		}
+		j.buf.Write(key)
+		j.buf.WriteByte(':')
+		j.buf.Write(val)
+	}
+	j.buf.WriteString("}\n")
+	_, err := j.w.Write(j.buf.Bytes())
+	return err
+}
+
+func (j *jsonOutput) Close() error { return nil }
+
+// jsonValue converts v for encoding/json; groups become objects.
+func jsonValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindGroup:
+		m := map[string]any{}
+		for _, a := range v.Group() {
+			m[a.Key] = jsonValue(a.Value)
+		}
+		return m
+	case slog.KindAny:
+		if l, ok := v.Any().(slog.Level); ok {
+			return l.String()
+		}
+		if err, ok := v.Any().(error); ok {
+			return err.Error()
+		}
+	}
+	return v.Any()
+}
+
+// csvOutput writes a header line and one record per result. Entries are
+// written as time, level, msg, source and their attributes in text form.
+type csvOutput struct {
+	w *csv.Writer
+}
+
+var entryColumns = []string{slog.TimeKey, slog.LevelKey, slog.MessageKey, slog.SourceKey, "attrs"}
+
+func newCSVOutput(w io.Writer, columns []string) (*csvOutput, error) {
+	c := &csvOutput{w: csv.NewWriter(w)}
+	if columns == nil {
+		columns = entryColumns
+	}
+	return c, c.w.Write(columns)
+}
+
+func (c *csvOutput) Entry(e echo.Entry) error {
+	var t, source string
+	if !e.Time.IsZero() {
+		t = e.Time.Format(cli.TimeFormat)
+	}
+	if e.Source != nil {
+		source = fmt.Sprintf("%s:%d", e.Source.File, e.Source.Line)
+	}
+	var attrs bytes.Buffer
+	(&cli.Printer{}).FormatAttrs(&attrs, e.Attrs)
+	return c.w.Write([]string{t, e.Level.String(), e.Message, source, strings.TrimPrefix(attrs.String(), " ")})
+}
+
+func (c *csvOutput) Row(values []slog.Value) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = cellString(v)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvOutput) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// cellString renders a row value for table and CSV output; missing values
+// are empty.
+func cellString(v slog.Value) string {
+	if v.Kind() == slog.KindAny && v.Any() == nil {
+		return ""
+	}
+	return cli.ValueString(v)
+}
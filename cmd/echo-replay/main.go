@@ -0,0 +1,106 @@
+// Command echo-replay sends the entries of log files through an echo
+// handler stack, keeping their original timestamps, to reproduce incidents
+// or try new formats, levels and outputs on real data.
+//
+// Usage:
+//
+//	echo-replay [flags] [file|glob ...]
+//
+// The handler stack is built from the flags as Init would build it from a
+// Config. By default entries are replayed as fast as possible; -speed 1
+// keeps their original pace and -speed 60 plays an hour in a minute.
+//
+// Files are read as echo-view reads them: any echo format, compressed or
+// encrypted, globs in name order, stdin when no file is given.
+//
+//	echo-replay -level warn -console-format json app.log
+//	echo-replay -speed 10 -max-wait 1s -no-console -file out/app.log -file-format cbor 'logs/app*.log*'
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+func main() {
+	var (
+		cfg       echo.Config
+		replay    echo.ReplayOptions
+		level     = flag.String("level", "debug", "minimum level to replay")
+		noConsole = flag.Bool("no-console", false, "do not write to stdout")
+		key       = flag.String("key", "", "PEM-encoded RSA private key for encrypted input files")
+	)
+	flag.Float64Var(&replay.Speed, "speed", 0, "replay at the original pace times this factor; 0 for no waiting")
+	flag.DurationVar(&replay.MaxWait, "max-wait", 0, "cap on the wait before any entry when pacing; 0 for none")
+	flag.StringVar(&cfg.ConsoleFormat, "console-format", "text", "stdout format: text or json")
+	flag.StringVar(&cfg.FilePath, "file", "", "also write to this log file")
+	flag.StringVar(&cfg.FileFormat, "file-format", "json", "log file format: json, text, logfmt or cbor")
+	flag.Int64Var(&cfg.FileMaxSize, "file-max-size", 0, "rotate the log file at this many bytes; 0 for never")
+	flag.StringVar(&cfg.FileCompression, "file-compression", "", "compress the log file: gzip or zstd")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file|glob ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var err error
+	if cfg.Level, err = cli.ParseLevel(*level); err == nil {
+		console := !*noConsole
+		cfg.ConsoleOutput = &console
+		cfg.FileOutput = cfg.FilePath != ""
+		err = run(cfg, &replay, *key, flag.Args())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "echo-replay: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(cfg echo.Config, replay *echo.ReplayOptions, key string, args []string) (err error) {
+	opts := &echo.ReaderOptions{}
+	if key != "" {
+		if opts.KeyUnwrapper, err = cli.LoadKeyUnwrapper(key); err != nil {
+			return err
+		}
+	}
+	paths, err := cli.ExpandArgs(args)
+	if err != nil {
+		return err
+	}
+
+	h, closer, err := echo.NewHandler(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	replay.OnParseError = func(perr *echo.ParseError) {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", perr)
+	}
+	total := 0
+	for _, path := range paths {
+		rd, err := cli.Open(path, opts)
+		if err != nil {
+			return err
+		}
+		n, err := echo.Replay(ctx, rd, h, replay)
+		rd.Close()
+		total += n
+		if err != nil {
+			return fmt.Errorf("%s: %w (after %d records)", path, err, total)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+// Command echo-stats reports what log files are made of, to find noisy call
+// sites before they cost ingestion money.
+//
+// Usage:
+//
+//	echo-stats [flags] [file|glob ...]
+//
+// The report has entry counts and sizes by level, the top messages and
+// source locations (when the logs were written with AddSource), the bytes
+// taken by each attribute key, and a histogram of entries over time. Sizes
+// are those of entries rendered as text, so they compare across formats.
+//
+// With -templates, messages are grouped into templates with wildcards for
+// the values interpolated into them (see package drain), so that "user 42
+// logged in" and "user 7 logged in" count as "user <*> logged in".
+//
+// Files are read as echo-view reads them: any echo format, compressed or
+// encrypted, globs in name order, stdin when no file is given.
+//
+//	echo-stats -top 20 -sort bytes 'logs/app*.log*'
+//	echo-stats -bucket 1m -o json app.log
+//	echo-stats -templates -sort bytes app.log
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/drain"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+func main() {
+	var (
+		top    = flag.Int("top", 10, "number of messages, sources and attributes to list; 0 for all")
+		sortBy = flag.String("sort", "count", "order top lists by count or bytes")
+		bucket = flag.Duration("bucket", time.Hour, "histogram bucket width (at least 1s)")
+		format = flag.String("o", "text", "output format: text or json")
+		tmpl   = flag.Bool("templates", false, "group messages into templates with wildcards for interpolated values")
+		key    = flag.String("key", "", "PEM-encoded RSA private key for encrypted files")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file|glob ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*top, *sortBy, *bucket, *format, *tmpl, *key, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "echo-stats: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(top int, sortBy string, bucket time.Duration, format string, templates bool, key string, args []string) (err error) {
+	if sortBy != "count" && sortBy != "bytes" {
+		return fmt.Errorf("invalid -sort %q: want count or bytes", sortBy)
+	}
+	if bucket < time.Second {
+		return fmt.Errorf("-bucket must be at least 1s")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid -o %q: want text or json", format)
+	}
+	opts := &echo.ReaderOptions{}
+	if key != "" {
+		if opts.KeyUnwrapper, err = cli.LoadKeyUnwrapper(key); err != nil {
+			return err
+		}
+	}
+	paths, err := cli.ExpandArgs(args)
+	if err != nil {
+		return err
+	}
+
+	s := newStats(bucket)
+	if templates {
+		s.miner = drain.New(drain.Config{})
+	}
+	err = cli.ReadEntries(paths, opts, os.Stderr, func(_ string, e echo.Entry) error {
+		s.add(e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r := s.report(top, sortBy == "bytes")
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	return r.writeText(w)
+}
+
+// report is the result of a run, as written with -o json.
+type report struct {
+	Entries   int64         `json:"entries"`
+	Bytes     int64         `json:"bytes"`
+	First     *time.Time    `json:"first,omitempty"`
+	Last      *time.Time    `json:"last,omitempty"`
+	Levels    []counter     `json:"levels"`
+	Messages  []counter     `json:"messages"`
+	Sources   []counter     `json:"sources"`
+	Attrs     []counter     `json:"attrs"`
+	Templates bool          `json:"templates,omitempty"` // Messages are templates
+	Bucket    string        `json:"bucket"`
+	Histogram []bucketCount `json:"histogram"`
+}
+
+func (s *stats) report(top int, byBytes bool) report {
+	r := report{
+		Entries:   s.entries,
+		Bytes:     s.bytes,
+		Levels:    s.levels.top(0, false),
+		Messages:  s.topMessages(top, byBytes),
+		Sources:   s.sources.top(top, byBytes),
+		Attrs:     s.attrs.top(top, true),
+		Templates: s.miner != nil,
+		Bucket:    s.bucket.String(),
+		Histogram: s.buckets(),
+	}
+	if !s.first.IsZero() {
+		r.First, r.Last = &s.first, &s.last
+	}
+	return r
+}
+
+func (r report) writeText(w io.Writer) error {
+	fmt.Fprintf(w, "Entries: %d  Bytes: %s", r.Entries, formatBytes(r.Bytes))
+	if r.First != nil {
+		fmt.Fprintf(w, "  From: %s  To: %s", r.First.Format(cli.TimeFormat), r.Last.Format(cli.TimeFormat))
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	section := func(title string, counters []counter) {
+		if len(counters) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "\n%s\tCOUNT\t%%\tBYTES\t%%\n", title)
+		for _, c := range counters {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n",
+				firstLine(c.Key), c.Count, percent(c.Count, r.Entries), formatBytes(c.Bytes), percent(c.Bytes, r.Bytes))
+		}
+		tw.Flush()
+	}
+	section("LEVEL", r.Levels)
+	section(r.messageTitle(), r.Messages)
+	section("SOURCE", r.Sources)
+	section("ATTRIBUTE", r.Attrs)
+
+	if len(r.Histogram) > 0 {
+		var peak int64
+		for _, b := range r.Histogram {
+			peak = max(peak, b.Count)
+		}
+		fmt.Fprintf(w, "\nHISTOGRAM (per %s)\n", r.Bucket)
+		for _, b := range r.Histogram {
+			bar := 0
+			if peak > 0 {
+				bar = int(b.Count * 50 / peak)
+			}
+			fmt.Fprintf(w, "%s %8d %s\n", b.Start.Format("2006-01-02T15:04Z07:00"), b.Count, strings.Repeat("#", bar))
+		}
+	}
+	return nil
+}
+
+func (r report) messageTitle() string {
+	if r.Templates {
+		return "TEMPLATE"
+	}
+	return "MESSAGE"
+}
+
+// firstLine shortens multi-line messages to their first line.
+func firstLine(s string) string {
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		return s[:i] + "..."
+	}
+	return s
+}
+
+func percent(n, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", float64(n)*100/float64(total))
+}
+
+// formatBytes renders n in binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/drain"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+// maxKeys bounds the distinct messages, sources and attribute keys tracked;
+// further ones are counted under otherKey.
+const maxKeys = 100_000
+
+const otherKey = "(other)"
+
+// counter counts the entries of one level, message, source or attribute key
+// and their size.
+type counter struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// counters is a set of counters by key.
+type counters map[string]*counter
+
+func (c counters) add(key string, n int64) {
+	ct := c[key]
+	if ct == nil {
+		if len(c) >= maxKeys {
+			key = otherKey
+			ct = c[key]
+		}
+		if ct == nil {
+			ct = &counter{Key: key}
+			c[key] = ct
+		}
+	}
+	ct.Count++
+	ct.Bytes += n
+}
+
+// top returns the n largest counters by count, or by bytes if byBytes is
+// set; n <= 0 means all.
+func (c counters) top(n int, byBytes bool) []counter {
+	all := make([]counter, 0, len(c))
+	for _, ct := range c {
+		all = append(all, *ct)
+	}
+	slices.SortFunc(all, func(a, b counter) int {
+		if byBytes && a.Bytes != b.Bytes {
+			return cmp.Compare(b.Bytes, a.Bytes)
+		}
+		if a.Count != b.Count {
+			return cmp.Compare(b.Count, a.Count)
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	if n > 0 && len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// stats accumulates the report over a stream of entries. Sizes are those of
+// entries rendered as text, a format-independent estimate of what they cost
+// to ship and store.
+type stats struct {
+	entries     int64
+	bytes       int64
+	first, last time.Time
+
+	levels   counters
+	messages counters // By message, or by template ID if miner is set
+	sources  counters
+	attrs    counters // By dotted key, leaves only
+
+	bucket    time.Duration
+	histogram map[int64]int64 // Entries by bucket start, in Unix seconds
+
+	miner *drain.Miner // Groups messages into templates, if set
+
+	printer cli.Printer
+	buf     bytes.Buffer
+}
+
+func newStats(bucket time.Duration) *stats {
+	return &stats{
+		levels:    counters{},
+		messages:  counters{},
+		sources:   counters{},
+		attrs:     counters{},
+		bucket:    bucket,
+		histogram: map[int64]int64{},
+	}
+}
+
+func (s *stats) add(e echo.Entry) {
+	s.buf.Reset()
+	s.printer.Format(&s.buf, e)
+	size := int64(s.buf.Len() + 1) // With the newline
+
+	s.entries++
+	s.bytes += size
+	s.levels.add(e.Level.String(), size)
+	if s.miner == nil {
+		s.messages.add(e.Message, size)
+	} else if t, ok := s.miner.Add(e.Message); ok {
+		s.messages.add(strconv.FormatInt(t.ID, 10), size)
+	} else {
+		s.messages.add(otherKey, size)
+	}
+	if e.Source != nil {
+		s.sources.add(fmt.Sprintf("%s:%d", e.Source.File, e.Source.Line), size)
+	}
+	s.addAttrs("", e.Attrs)
+
+	if !e.Time.IsZero() {
+		if s.first.IsZero() || e.Time.Before(s.first) {
+			s.first = e.Time
+		}
+		if e.Time.After(s.last) {
+			s.last = e.Time
+		}
+		s.histogram[e.Time.Truncate(s.bucket).Unix()]++
+	}
+}
+
+// addAttrs counts each leaf attribute under its dotted key, sized as
+// " key=value".
+func (s *stats) addAttrs(prefix string, attrs []slog.Attr) {
+	for _, a := range attrs {
+		key := prefix + a.Key
+		if a.Value.Kind() == slog.KindGroup {
+			s.addAttrs(key+".", a.Value.Group())
+			continue
+		}
+		n := 2 + len(cli.QuoteIfNeeded(key)) + len(cli.QuoteIfNeeded(cli.ValueString(a.Value)))
+		s.attrs.add(key, int64(n))
+	}
+}
+
+// topMessages returns the top messages, or templates if a miner is set.
+// Template counters are keyed by ID until the end, as templates change
+// while they are learned.
+func (s *stats) topMessages(n int, byBytes bool) []counter {
+	top := s.messages.top(n, byBytes)
+	if s.miner != nil {
+		for i, c := range top {
+			id, _ := strconv.ParseInt(c.Key, 10, 64)
+			if t, ok := s.miner.Template(id); ok {
+				top[i].Key = t.String()
+			}
+		}
+	}
+	return top
+}
+
+// bucketCount is one bar of the time histogram.
+type bucketCount struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+// maxEmptyBuckets bounds the histogram length when filling in gaps.
+const maxEmptyBuckets = 1000
+
+// buckets returns the histogram in time order. Empty buckets between the
+// first and last entry are included unless there would be too many.
+func (s *stats) buckets() []bucketCount {
+	if len(s.histogram) == 0 {
+		return nil
+	}
+	start := s.first.Truncate(s.bucket)
+	end := s.last.Truncate(s.bucket)
+	var out []bucketCount
+	if int(end.Sub(start)/s.bucket) < len(s.histogram)+maxEmptyBuckets {
+		for t := start; !t.After(end); t = t.Add(s.bucket) {
+			out = append(out, bucketCount{Start: t, Count: s.histogram[t.Unix()]})
+		}
+		return out
+	}
+	for sec, n := range s.histogram {
+		out = append(out, bucketCount{Start: time.Unix(sec, 0).In(s.first.Location()), Count: n})
+	}
+	slices.SortFunc(out, func(a, b bucketCount) int { return a.Start.Compare(b.Start) })
+	return out
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/drain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	s := newStats(time.Hour)
+	for i := 0; i < 4; i++ {
+		s.add(echo.Entry{
+			Time:    start.Add(time.Duration(i) * 90 * time.Minute),
+			Level:   slog.LevelInfo,
+			Message: "request handled",
+			Source:  &slog.Source{File: "api.go", Line: 10},
+			Attrs:   []slog.Attr{slog.Group("http", slog.Int("status", 200))},
+		})
+	}
+	s.add(echo.Entry{Level: slog.LevelError, Message: "failed", Attrs: []slog.Attr{slog.String("err", "a much longer error text")}})
+
+	r := s.report(1, false)
+	assert.Equal(t, int64(5), r.Entries)
+	require.Len(t, r.Levels, 2)
+	assert.Equal(t, counter{Key: "INFO", Count: 4, Bytes: r.Levels[0].Bytes}, r.Levels[0])
+
+	require.Len(t, r.Messages, 1, "-top should limit the lists")
+	assert.Equal(t, "request handled", r.Messages[0].Key)
+	require.Len(t, r.Sources, 1)
+	assert.Equal(t, "api.go:10", r.Sources[0].Key)
+
+	// Attributes are ranked by bytes, sized as they are written in text.
+	require.Len(t, r.Attrs, 1)
+	assert.Equal(t, "http.status", r.Attrs[0].Key)
+	assert.Equal(t, int64(4*len(` http.status=200`)), r.Attrs[0].Bytes)
+
+	assert.Equal(t, []bucketCount{
+		{Start: start, Count: 1},
+		{Start: start.Add(time.Hour), Count: 1},
+		{Start: start.Add(2 * time.Hour), Count: 0},
+		{Start: start.Add(3 * time.Hour), Count: 1},
+		{Start: start.Add(4 * time.Hour), Count: 1},
+	}, r.Histogram, "Empty buckets should be filled in")
+
+	byBytes := s.report(0, true)
+	assert.Equal(t, "request handled", byBytes.Messages[0].Key)
+}
+
+func TestCountersBounded(t *testing.T) {
+	c := counters{}
+	for i := 0; i < maxKeys+10; i++ {
+		c.add(time.Duration(i).String(), 1)
+	}
+	assert.Len(t, c, maxKeys+1)
+	assert.Equal(t, int64(10), c[otherKey].Count)
+}
+
+func TestStatsTemplates(t *testing.T) {
+	s := newStats(time.Hour)
+	s.miner = drain.New(drain.Config{})
+	for i := 0; i < 3; i++ {
+		s.add(echo.Entry{Level: slog.LevelInfo, Message: fmt.Sprintf("user %d logged in", i)})
+	}
+	s.add(echo.Entry{Level: slog.LevelInfo, Message: "cache warmed up"})
+
+	r := s.report(0, false)
+	assert.True(t, r.Templates)
+	require.Len(t, r.Messages, 2)
+	assert.Equal(t, "user <*> logged in", r.Messages[0].Key, "The final template should be shown")
+	assert.Equal(t, int64(3), r.Messages[0].Count)
+}
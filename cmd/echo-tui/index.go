@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+// cacheSize bounds the number of decoded entries kept by a logIndex.
+const cacheSize = 4096
+
+// logFile is one input, readable at the offsets of its entries.
+type logFile struct {
+	name string // As given on the command line
+	f    *os.File
+	size int64
+	temp bool // f is a decoded copy, removed on close
+}
+
+// logIndex locates every entry of the inputs without holding them: an
+// offset and a level per entry. Entries are decoded again when needed.
+type logIndex struct {
+	files   []*logFile
+	first   []int // Number of the first entry of each file
+	offsets []int64
+	levels  []slog.Level
+	opts    *echo.ReaderOptions
+	cache   map[int]echo.Entry
+}
+
+// buildIndex reads the files at paths, or stdin for cli.Stdin, once to index
+// them, calling progress with the number of entries so far. Files that
+// cannot be read at an offset, because they are compressed or encrypted,
+// and stdin are decoded into temporary files first.
+func buildIndex(paths []string, opts *echo.ReaderOptions, progress func(int)) (*logIndex, error) {
+	x := &logIndex{opts: opts, cache: map[int]echo.Entry{}}
+	for _, path := range paths {
+		if err := x.add(path, progress); err != nil {
+			x.Close()
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+func (x *logIndex) add(path string, progress func(int)) error {
+	lf := &logFile{name: path}
+	if path == cli.Stdin {
+		lf.name = "stdin"
+		lf.f = os.Stdin
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		lf.f = f
+	}
+	rd, err := echo.NewReader(lf.f, x.opts)
+	if err != nil {
+		lf.close()
+		return fmt.Errorf("%s: %w", lf.name, err)
+	}
+	if _, ok := rd.Offset(); !ok || path == cli.Stdin {
+		err := lf.decode(rd)
+		rd.Close()
+		if err != nil {
+			lf.close()
+			return fmt.Errorf("%s: %w", lf.name, err)
+		}
+		if rd, err = echo.NewReader(lf.f, x.opts); err != nil {
+			lf.close()
+			return fmt.Errorf("%s: %w", lf.name, err)
+		}
+	}
+	defer rd.Close()
+	x.files = append(x.files, lf)
+	x.first = append(x.first, len(x.offsets))
+
+	var start int64
+	for {
+		e, err := rd.Next()
+		var perr *echo.ParseError
+		switch {
+		case errors.Is(err, io.EOF):
+			lf.size = start
+			return nil
+		case errors.As(err, &perr):
+			start, _ = rd.Offset() // The next entry starts after the bad line
+			continue
+		case err != nil:
+			return fmt.Errorf("%s: %w", lf.name, err)
+		}
+		end, _ := rd.Offset()
+		x.offsets = append(x.offsets, start)
+		x.levels = append(x.levels, e.Level)
+		start = end
+		if progress != nil && len(x.offsets)%100000 == 0 {
+			progress(len(x.offsets))
+		}
+	}
+}
+
+// decode copies the entries of rd into a temporary file in echo's CBOR
+// format, which keeps their types, and makes it the file of lf.
+func (lf *logFile) decode(rd *echo.Reader) error {
+	tmp, err := os.CreateTemp("", "echo-tui-*.cbor")
+	if err != nil {
+		return err
+	}
+	if lf.f != os.Stdin {
+		lf.f.Close()
+	}
+	lf.f, lf.temp = tmp, true
+	h, err := echo.NewFormatHandler("cbor", tmp, nil)
+	if err != nil {
+		return err
+	}
+	err = cli.Drain(rd, io.Discard, func(e echo.Entry) error {
+		return h.Handle(context.Background(), e.Record())
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	return err
+}
+
+func (lf *logFile) close() error {
+	if lf.f == os.Stdin {
+		return nil
+	}
+	err := lf.f.Close()
+	if lf.temp {
+		os.Remove(lf.f.Name())
+	}
+	return err
+}
+
+// Len returns the number of entries.
+func (x *logIndex) Len() int { return len(x.offsets) }
+
+// fileOf returns the number of the file holding entry i.
+func (x *logIndex) fileOf(i int) int {
+	return sort.Search(len(x.first), func(f int) bool { return x.first[f] > i }) - 1
+}
+
+// entry returns entry i.
+func (x *logIndex) entry(i int) (echo.Entry, error) {
+	if e, ok := x.cache[i]; ok {
+		return e, nil
+	}
+	lf := x.files[x.fileOf(i)]
+	end := lf.size
+	if i+1 < len(x.offsets) && x.fileOf(i+1) == x.fileOf(i) {
+		end = x.offsets[i+1]
+	}
+	rd, err := echo.NewReader(io.NewSectionReader(lf.f, x.offsets[i], end-x.offsets[i]), x.opts)
+	if err != nil {
+		return echo.Entry{}, err
+	}
+	e, err := rd.Next()
+	if err != nil {
+		return echo.Entry{}, fmt.Errorf("%s: entry at offset %d: %w", lf.name, x.offsets[i], err)
+	}
+	if len(x.cache) >= cacheSize {
+		clear(x.cache)
+	}
+	x.cache[i] = e
+	return e, nil
+}
+
+// scan passes the entries from i on to fn, in order, reading sequentially,
+// until fn returns false.
+func (x *logIndex) scan(i int, fn func(int, echo.Entry) bool) error {
+	for i < len(x.offsets) {
+		n := x.fileOf(i)
+		lf := x.files[n]
+		last := len(x.offsets)
+		if n+1 < len(x.first) {
+			last = x.first[n+1]
+		}
+		rd, err := echo.NewReader(io.NewSectionReader(lf.f, x.offsets[i], lf.size-x.offsets[i]), x.opts)
+		if err != nil {
+			return err
+		}
+		for ; i < last; i++ {
+			e, err := rd.Next()
+			var perr *echo.ParseError
+			if errors.As(err, &perr) {
+				i-- // Skipped when indexing too
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", lf.name, err)
+			}
+			if !fn(i, e) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the files and removes the temporary ones.
+func (x *logIndex) Close() error {
+	var err error
+	for _, lf := range x.files {
+		if cerr := lf.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// key is a key press: a rune, a control character, or one of the negative
+// values below for keys sent as escape sequences.
+type key rune
+
+// Control characters.
+const (
+	keyCtrlB     key = 0x02
+	keyCtrlC     key = 0x03
+	keyCtrlF     key = 0x06
+	keyTab       key = '\t'
+	keyEnter     key = '\r'
+	keyEsc       key = 0x1b
+	keyBackspace key = 0x7f
+)
+
+// Special keys.
+const (
+	keyUp key = -1 - iota
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyPgUp
+	keyPgDn
+	keyUnknown
+)
+
+// Escape sequences of special keys, as sent by xterm-compatible terminals
+// in normal and application cursor mode.
+var sequences = map[string]key{
+	"[A": keyUp, "OA": keyUp,
+	"[B": keyDown, "OB": keyDown,
+	"[C": keyRight, "OC": keyRight,
+	"[D": keyLeft, "OD": keyLeft,
+	"[H": keyHome, "OH": keyHome, "[1~": keyHome, "[7~": keyHome,
+	"[F": keyEnd, "OF": keyEnd, "[4~": keyEnd, "[8~": keyEnd,
+	"[5~": keyPgUp,
+	"[6~": keyPgDn,
+}
+
+// parseKeys splits what a read from the terminal returned into keys. An
+// escape at the end of b is the Esc key itself; unknown sequences become
+// keyUnknown.
+func parseKeys(b []byte) []key {
+	var keys []key
+	for len(b) > 0 {
+		switch {
+		case b[0] == 0x1b && len(b) > 1 && (b[1] == '[' || b[1] == 'O'):
+			// A CSI sequence ends with a byte in 0x40-0x7e; an SS3 one is
+			// a single byte after the O.
+			n := 2
+			if b[1] == '[' {
+				for n < len(b) && (b[n] < 0x40 || b[n] > 0x7e) {
+					n++
+				}
+			}
+			n = min(n+1, len(b))
+			k, ok := sequences[string(b[1:n])]
+			if !ok {
+				k = keyUnknown
+			}
+			keys = append(keys, k)
+			b = b[n:]
+		case b[0] == '\n':
+			keys = append(keys, keyEnter)
+			b = b[1:]
+		case b[0] == 0x08:
+			keys = append(keys, keyBackspace)
+			b = b[1:]
+		default:
+			r, n := utf8.DecodeRune(b)
+			keys = append(keys, key(r))
+			b = b[n:]
+		}
+	}
+	return keys
+}
+
+// sanitize replaces control characters in s, which would move the cursor
+// or change the terminal's state, with spaces.
+func sanitize(s string) string {
+	if !strings.ContainsFunc(s, isControl) {
+		return s
+	}
+	b := []rune(s)
+	for i, r := range b {
+		if isControl(r) {
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
+
+func isControl(r rune) bool {
+	return r < 0x20 || (r >= 0x7f && r < 0xa0)
+}
@@ -0,0 +1,159 @@
+// Command echo-tui is a full-screen terminal viewer for log files written by
+// echo, for browsing large files interactively.
+//
+// Usage:
+//
+//	echo-tui [flags] [file|glob ...]
+//
+// Files may be in any echo format, compressed (.gz, .zst) or encrypted (with
+// -key). Globs are expanded and read in name order, which puts rotated
+// segments before the active file. With no files, stdin is read; keys are
+// read from the terminal either way.
+//
+// The files are read once to index the position and level of each entry;
+// entries are decoded again when they are shown or searched, so only the
+// index is held in memory. Compressed and encrypted files, and stdin, are
+// decoded into temporary files first.
+//
+// Keys:
+//
+//	q, Ctrl-C          quit
+//	j, k, ↓, ↑         select the next or previous entry
+//	space, b, PgDn, PgUp  page down or up
+//	g, G, Home, End    first or last entry
+//	/, ?               search forwards or backwards, as you type
+//	n, N               repeat the search in the same or opposite direction
+//	1, 2, 3, 4         show or hide DEBUG, INFO, WARN or ERROR entries
+//	c                  choose the attributes shown as columns
+//	Enter, Tab         show or hide the details of the selected entry
+//	h                  help
+//
+// Searches match the text of entries as echo-view prints them, with all
+// their attributes, ignoring case unless the search has capitals.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+func main() {
+	var (
+		fields = flag.String("fields", "", "comma-separated attributes to show as columns, e.g. http.status,route (default all)")
+		key    = flag.String("key", "", "PEM-encoded RSA private key for encrypted files")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file|glob ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*fields, *key, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "echo-tui: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(fields, key string, args []string) error {
+	opts := &echo.ReaderOptions{}
+	var err error
+	if key != "" {
+		if opts.KeyUnwrapper, err = cli.LoadKeyUnwrapper(key); err != nil {
+			return err
+		}
+	}
+	paths, err := cli.ExpandArgs(args)
+	if err != nil {
+		return err
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("no terminal: %w", err)
+	}
+	defer tty.Close()
+
+	progressed := false
+	idx, err := buildIndex(paths, opts, func(n int) {
+		fmt.Fprintf(os.Stderr, "\rindexing: %d entries", n)
+		progressed = true
+	})
+	if progressed {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+	if idx.Len() == 0 {
+		return errors.New("no entries")
+	}
+	v := newView(idx, cli.SplitList(fields))
+	return explore(tty, v)
+}
+
+// explore runs v on the terminal tty until the user quits.
+func explore(tty *os.File, v *view) error {
+	restore, err := makeRaw(tty)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	out := bufio.NewWriter(tty)
+	// Switch to the alternate screen, hiding the cursor, and back on exit.
+	out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		out.WriteString("\x1b[?25h\x1b[?1049l")
+		out.Flush()
+	}()
+
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	keys := make(chan []key)
+	errc := make(chan error, 1)
+	go func() {
+		b := make([]byte, 256)
+		for {
+			n, err := tty.Read(b)
+			if err != nil {
+				errc <- err
+				return
+			}
+			keys <- parseKeys(b[:n])
+		}
+	}()
+
+	var buf bytes.Buffer
+	for {
+		if w, h, err := termSize(tty); err == nil {
+			v.resize(w, h)
+		}
+		buf.Reset()
+		v.draw(&buf)
+		out.Write(buf.Bytes())
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		select {
+		case ks := <-keys:
+			for _, k := range ks {
+				if v.handle(k) {
+					return nil
+				}
+			}
+		case <-resized:
+		case err := <-errc:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
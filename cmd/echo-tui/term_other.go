@@ -0,0 +1,19 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errUnsupported = errors.New("terminal control is not supported on this platform")
+
+// makeRaw is not available on this platform.
+func makeRaw(f *os.File) (func() error, error) { return nil, errUnsupported }
+
+// termSize is not available on this platform.
+func termSize(f *os.File) (int, int, error) { return 0, 0, errUnsupported }
+
+// notifyResize does nothing: resizes are not reported on this platform.
+func notifyResize(c chan<- os.Signal) {}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeLog writes n JSON entries, every third a warning, and a bad line.
+func writeLog(t *testing.T, path string, n int, gz bool) {
+	t.Helper()
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		level := "INFO"
+		if i%3 == 2 {
+			level = "WARN"
+		}
+		fmt.Fprintf(&buf, `{"time":"2024-01-01T00:00:%02dZ","level":%q,"msg":"entry %d","http":{"status":%d}}`+"\n", i%60, level, i, 200+i)
+		if i == 1 {
+			buf.WriteString("not a log line\n")
+		}
+	}
+	data := buf.Bytes()
+	if gz {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		zw.Write(data)
+		zw.Close()
+		data = zbuf.Bytes()
+	}
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+func messages(t *testing.T, x *logIndex, from int) []string {
+	var msgs []string
+	require.NoError(t, x.scan(from, func(i int, e echo.Entry) bool {
+		msgs = append(msgs, e.Message)
+		return true
+	}))
+	return msgs
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	plain, gz := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log.gz")
+	writeLog(t, plain, 4, false)
+	writeLog(t, gz, 3, true)
+	x, err := buildIndex([]string{plain, gz}, nil, nil)
+	require.NoError(t, err)
+	defer x.Close()
+
+	require.Equal(t, 7, x.Len(), "The bad lines are skipped")
+	assert.Equal(t, 1, x.fileOf(4))
+	for i, want := range []string{"entry 0", "entry 3", "entry 0", "entry 2"} {
+		e, err := x.entry([]int{0, 3, 4, 6}[i])
+		require.NoError(t, err)
+		assert.Equal(t, want, e.Message)
+	}
+	assert.Equal(t, []string{"entry 1", "entry 2", "entry 3", "entry 0", "entry 1", "entry 2"}, messages(t, x, 1))
+
+	tmp := x.files[1].f.Name()
+	require.NoError(t, x.Close())
+	assert.NoFileExists(t, tmp, "The decoded copy is removed")
+}
+
+func TestViewSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.log")
+	writeLog(t, path, 100, false)
+	x, err := buildIndex([]string{path}, nil, nil)
+	require.NoError(t, err)
+	defer x.Close()
+	v := newView(x, nil)
+	v.resize(80, 11)
+
+	press := func(s string) {
+		for _, k := range parseKeys([]byte(s)) {
+			v.handle(k)
+		}
+	}
+	press("/ENTRY 4")
+	assert.Equal(t, 0, v.cur, "Capitals match case")
+	press("\x7f\x7f\x7f\x7f\x7f\x7f\x7fentry 4")
+	assert.Equal(t, 4, v.cur, "The search is incremental")
+	press("\r")
+	assert.Equal(t, 4, v.cur)
+	press("n")
+	assert.Equal(t, 40, v.cur)
+	assert.Equal(t, 31, v.top)
+	press("/status=250\x1b")
+	assert.Equal(t, 40, v.cur, "Esc goes back")
+	press("N")
+	assert.Equal(t, 4, v.cur)
+	press("G?entry 4\r")
+	assert.Equal(t, 49, v.cur)
+	press("n")
+	assert.Equal(t, 48, v.cur, "n repeats backwards")
+
+	// Hiding INFO keeps the selection on the next WARN.
+	press("2")
+	assert.Equal(t, 16, v.cur)
+	e, err := x.entry(v.entryAt(v.cur))
+	require.NoError(t, err)
+	assert.Equal(t, "entry 50", e.Message)
+	press("g/entry 9\r")
+	assert.Equal(t, "entry 92", messageAt(t, v))
+	press("2")
+	assert.Equal(t, "entry 92", messageAt(t, v))
+	assert.Equal(t, 100, v.count())
+}
+
+func messageAt(t *testing.T, v *view) string {
+	e, err := v.idx.entry(v.entryAt(v.cur))
+	require.NoError(t, err)
+	return e.Message
+}
+
+func TestViewDraw(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.log")
+	writeLog(t, path, 10, false)
+	x, err := buildIndex([]string{path}, nil, nil)
+	require.NoError(t, err)
+	defer x.Close()
+	v := newView(x, nil)
+	v.resize(60, 8)
+	v.handle('j')
+	v.handle('c')
+	for _, k := range "\x7fhttp.status\r" {
+		v.handle(key(k))
+	}
+	v.handle(keyEnter)
+
+	var buf bytes.Buffer
+	v.draw(&buf)
+	lines := strings.Split(buf.String(), "\r\n")
+	require.Len(t, lines, 8)
+	assert.Contains(t, lines[1], csiReverse+"2024-01-01T00:00:01.000Z INFO  entry 1", "The selected entry is in reverse video")
+	assert.Contains(t, lines[1], "http.status=201")
+	assert.Contains(t, lines[4], "─")
+	assert.Contains(t, lines[5], "file: ")
+	assert.Contains(t, lines[6], "time: 2024-01-01T00:00:01.000Z")
+	assert.Contains(t, lines[7], "2/10")
+	for _, l := range lines {
+		assert.LessOrEqual(t, len([]rune(stripANSI(l))), 60)
+	}
+}
+
+func stripANSI(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0x1b {
+			for i++; i < len(s) && (s[i] == '[' || s[i] == '?' || s[i] < 0x40 || s[i] > 0x7e); i++ {
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func TestParseKeys(t *testing.T) {
+	assert.Equal(t,
+		[]key{'a', keyUp, keyPgDn, keyEnd, keyEnter, keyEnter, 'é', keyUnknown, keyBackspace, keyEsc},
+		parseKeys([]byte("a\x1b[A\x1b[6~\x1bOF\r\né\x1b[1;5C\x08\x1b")))
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "\x1b[1mab\x1b[0m", truncate("\x1b[1mab\x1b[0mcd", 2))
+	assert.Equal(t, "héllo", truncate("héllo", 5))
+	assert.Equal(t, "a b", sanitize("a\x1bb"))
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+// incrementalBudget bounds the search run on each key typed at the search
+// prompt, so typing stays responsive on large files; Enter searches to the
+// end.
+const incrementalBudget = 100 * time.Millisecond
+
+// searchBlock is the number of entries read at a time when searching
+// backwards, since entries can only be read forwards.
+const searchBlock = 512
+
+// Terminal control sequences.
+const (
+	csiHome      = "\x1b[H"
+	csiClearLine = "\x1b[K"
+	csiClearDown = "\x1b[J"
+	csiReverse   = "\x1b[7m"
+	csiReset     = "\x1b[0m"
+)
+
+const helpText = "q quit  j/k ↑/↓ move  space/b page  g/G first/last  / ? search  n/N next  1-4 levels  c columns  enter detail"
+
+// Level classes, toggled with the keys 1 to 4.
+var classNames = [4]string{"D", "I", "W", "E"}
+
+func classOf(l slog.Level) int {
+	switch {
+	case l >= slog.LevelError:
+		return 3
+	case l >= slog.LevelWarn:
+		return 2
+	case l >= slog.LevelInfo:
+		return 1
+	}
+	return 0
+}
+
+// view is the state of the screen: the entries shown, the selected one,
+// the last search and the prompt being edited. It reacts to keys and draws
+// itself, and knows nothing else of the terminal.
+type view struct {
+	idx     *logIndex
+	shown   [4]bool // Level classes shown
+	visible []int32 // Entries shown, when some classes are hidden
+	cur     int     // Position of the selected entry among those shown
+	top     int     // Position of the first row on screen
+	width   int
+	height  int
+	detail  bool
+	rows    cli.Printer // Renders rows, limited to the selected columns
+	plain   cli.Printer // Renders entries for searching
+	buf     bytes.Buffer
+
+	search   string
+	backward bool
+	prompt   string // Label of the prompt being edited, if any
+	input    []rune
+	origin   int // Selection when the search prompt was opened
+	message  string
+}
+
+func newView(idx *logIndex, fields []string) *view {
+	return &view{
+		idx:    idx,
+		shown:  [4]bool{true, true, true, true},
+		width:  80,
+		height: 24,
+		rows:   cli.Printer{Color: true, Fields: fields},
+	}
+}
+
+// resize sets the size of the screen.
+func (v *view) resize(width, height int) {
+	v.width, v.height = max(width, 1), max(height, 2)
+	v.move(v.cur)
+}
+
+// count returns the number of entries shown.
+func (v *view) count() int {
+	if v.visible != nil {
+		return len(v.visible)
+	}
+	return v.idx.Len()
+}
+
+// entryAt returns the number of the entry at a position among those shown.
+func (v *view) entryAt(pos int) int {
+	if v.visible != nil {
+		return int(v.visible[pos])
+	}
+	return pos
+}
+
+// toggle shows or hides a level class, keeping the selection on the same
+// entry or, if it is hidden, the next one shown.
+func (v *view) toggle(class int) {
+	selected := 0
+	if v.count() > 0 {
+		selected = v.entryAt(v.cur)
+	}
+	v.shown[class] = !v.shown[class]
+	v.visible = nil
+	pos := selected
+	if v.shown != [4]bool{true, true, true, true} {
+		v.visible = []int32{}
+		for i, l := range v.idx.levels {
+			if v.shown[classOf(l)] {
+				v.visible = append(v.visible, int32(i))
+			}
+		}
+		pos = sort.Search(len(v.visible), func(p int) bool { return int(v.visible[p]) >= selected })
+	}
+	v.move(pos)
+}
+
+// listHeight returns the number of rows of entries.
+func (v *view) listHeight() int {
+	h := v.height - 1 // Status line
+	if v.detail {
+		h -= h / 2
+	}
+	return max(h, 1)
+}
+
+// move selects the entry at pos, scrolling as needed.
+func (v *view) move(pos int) {
+	v.cur = max(min(pos, v.count()-1), 0)
+	lh := v.listHeight()
+	if v.cur < v.top {
+		v.top = v.cur
+	}
+	if v.cur >= v.top+lh {
+		v.top = v.cur - lh + 1
+	}
+	v.top = max(min(v.top, v.count()-lh), 0)
+}
+
+// handle reacts to k and reports whether to quit.
+func (v *view) handle(k key) bool {
+	if v.prompt != "" {
+		v.edit(k)
+		return false
+	}
+	v.message = ""
+	lh := v.listHeight()
+	switch k {
+	case 'q', keyCtrlC:
+		return true
+	case 'j', keyDown:
+		v.move(v.cur + 1)
+	case 'k', keyUp:
+		v.move(v.cur - 1)
+	case ' ', keyCtrlF, keyPgDn:
+		v.move(v.cur + lh)
+	case 'b', keyCtrlB, keyPgUp:
+		v.move(v.cur - lh)
+	case 'g', keyHome:
+		v.move(0)
+	case 'G', keyEnd:
+		v.move(v.count() - 1)
+	case '1', '2', '3', '4':
+		v.toggle(int(k - '1'))
+	case keyEnter, keyTab:
+		v.detail = !v.detail
+		v.move(v.cur)
+	case '/', '?':
+		v.prompt, v.input, v.origin, v.backward = string(k), nil, v.cur, k == '?'
+	case 'n', 'N':
+		if v.search == "" {
+			v.message = "no previous search"
+			break
+		}
+		backward := v.backward != (k == 'N')
+		from := v.cur + 1
+		if backward {
+			from = v.cur - 1
+		}
+		if pos, ok := v.find(from, backward, v.search, time.Time{}); ok {
+			v.move(pos)
+		} else {
+			v.message = "not found: " + v.search
+		}
+	case 'c':
+		v.prompt = "columns: "
+		v.input = []rune(strings.Join(v.rows.Fields, ","))
+	case 'h':
+		v.message = helpText
+	}
+	return false
+}
+
+// edit handles a key at a prompt. Searches are incremental: each key typed
+// selects the first match of the text so far, within a time budget.
+func (v *view) edit(k key) {
+	search := v.prompt == "/" || v.prompt == "?"
+	switch k {
+	case keyEsc, keyCtrlC:
+		if search {
+			v.move(v.origin)
+		}
+		v.prompt = ""
+		return
+	case keyEnter:
+		text := string(v.input)
+		v.prompt = ""
+		if !search {
+			v.rows.Fields = cli.SplitList(text)
+			return
+		}
+		if text == "" {
+			return
+		}
+		v.search = text
+		if pos, ok := v.find(v.origin, v.backward, text, time.Time{}); ok {
+			v.move(pos)
+		} else {
+			v.move(v.origin)
+			v.message = "not found: " + text
+		}
+		return
+	case keyBackspace:
+		if len(v.input) > 0 {
+			v.input = v.input[:len(v.input)-1]
+		}
+	default:
+		if k < ' ' {
+			return
+		}
+		v.input = append(v.input, rune(k))
+	}
+	if search {
+		v.move(v.origin)
+		if len(v.input) > 0 {
+			if pos, ok := v.find(v.origin, v.backward, string(v.input), time.Now().Add(incrementalBudget)); ok {
+				v.move(pos)
+			}
+		}
+	}
+}
+
+// matcher returns a function matching the entries whose rendering with all
+// attributes contains pattern, ignoring case unless pattern has capitals.
+func (v *view) matcher(pattern string) func(echo.Entry) bool {
+	fold := strings.ToLower(pattern) == pattern
+	return func(e echo.Entry) bool {
+		v.buf.Reset()
+		v.plain.Format(&v.buf, e)
+		text := v.buf.String()
+		if fold {
+			text = strings.ToLower(text)
+		}
+		return strings.Contains(text, pattern)
+	}
+}
+
+// find returns the position of the first entry shown from pos on, or the
+// last one up to pos if backward, that matches pattern. It gives up at
+// deadline, unless that is zero.
+func (v *view) find(pos int, backward bool, pattern string, deadline time.Time) (int, bool) {
+	match := v.matcher(pattern)
+	expired := func() bool { return !deadline.IsZero() && time.Now().After(deadline) }
+	found := -1
+	if !backward {
+		n := 0
+		v.scanShown(pos, v.count(), func(p int, e echo.Entry) bool {
+			if match(e) {
+				found = p
+				return false
+			}
+			n++
+			return n%256 != 0 || !expired()
+		})
+		return found, found >= 0
+	}
+	for end := min(pos, v.count()-1); end >= 0 && !expired(); end -= searchBlock {
+		v.scanShown(max(end-searchBlock+1, 0), end+1, func(p int, e echo.Entry) bool {
+			if match(e) {
+				found = p
+			}
+			return true
+		})
+		if found >= 0 {
+			return found, true
+		}
+	}
+	return 0, false
+}
+
+// scanShown passes the entries shown at positions [pos, end) to fn, in
+// order, until fn returns false.
+func (v *view) scanShown(pos, end int, fn func(int, echo.Entry) bool) {
+	if pos < 0 || pos >= min(end, v.count()) {
+		return
+	}
+	err := v.idx.scan(v.entryAt(pos), func(i int, e echo.Entry) bool {
+		if !v.shown[classOf(v.idx.levels[i])] {
+			return true
+		}
+		if !fn(pos, e) {
+			return false
+		}
+		pos++
+		return pos < end
+	})
+	if err != nil {
+		v.message = err.Error()
+	}
+}
+
+// draw writes the whole screen to buf.
+func (v *view) draw(buf *bytes.Buffer) {
+	buf.WriteString(csiHome)
+	lh := v.listHeight()
+	for row := 0; row < lh; row++ {
+		pos := v.top + row
+		if pos < v.count() {
+			v.drawEntry(buf, pos)
+		}
+		buf.WriteString(csiClearLine + "\r\n")
+	}
+	if v.detail {
+		v.drawDetail(buf, v.height-1-lh)
+	}
+	v.drawStatus(buf)
+}
+
+// drawEntry writes the row of the entry at pos, in reverse video if it is
+// selected.
+func (v *view) drawEntry(buf *bytes.Buffer, pos int) {
+	e, err := v.idx.entry(v.entryAt(pos))
+	if err != nil {
+		buf.WriteString(truncate(sanitize(err.Error()), v.width))
+		return
+	}
+	e.Message = sanitize(e.Message)
+	var line bytes.Buffer
+	if pos == v.cur {
+		p := cli.Printer{Fields: v.rows.Fields}
+		p.Format(&line, e)
+		buf.WriteString(csiReverse)
+		buf.WriteString(truncate(line.String(), v.width))
+		buf.WriteString(csiReset)
+		return
+	}
+	v.rows.Format(&line, e)
+	buf.WriteString(truncate(line.String(), v.width))
+	buf.WriteString(csiReset)
+}
+
+// drawDetail writes the detail pane, of height rows: a rule and every field
+// of the selected entry, one per line.
+func (v *view) drawDetail(buf *bytes.Buffer, height int) {
+	lines := []string{strings.Repeat("─", v.width)}
+	if v.count() > 0 {
+		lines = append(lines, v.detailLines()...)
+	}
+	for i := 0; i < height; i++ {
+		if i < len(lines) {
+			buf.WriteString(truncate(lines[i], v.width))
+		}
+		buf.WriteString(csiClearLine + "\r\n")
+	}
+}
+
+// detailLines returns the fields of the selected entry, with attributes
+// flattened to dotted keys and multi-line values on several lines.
+func (v *view) detailLines() []string {
+	i := v.entryAt(v.cur)
+	e, err := v.idx.entry(i)
+	if err != nil {
+		return []string{sanitize(err.Error())}
+	}
+	lf := v.idx.files[v.idx.fileOf(i)]
+	var lines []string
+	field := func(key, value string) {
+		for j, l := range strings.Split(value, "\n") {
+			if j == 0 {
+				lines = append(lines, key+": "+sanitize(l))
+			} else {
+				lines = append(lines, strings.Repeat(" ", utf8.RuneCountInString(key)+2)+sanitize(l))
+			}
+		}
+	}
+	field("file", fmt.Sprintf("%s (offset %d)", lf.name, v.idx.offsets[i]))
+	if !e.Time.IsZero() {
+		field("time", e.Time.Format(cli.TimeFormat))
+	}
+	field("level", e.Level.String())
+	field("msg", e.Message)
+	if e.Source != nil {
+		field("source", fmt.Sprintf("%s:%d", e.Source.File, e.Source.Line))
+	}
+	var flatten func(prefix string, attrs []slog.Attr)
+	flatten = func(prefix string, attrs []slog.Attr) {
+		for _, a := range attrs {
+			if a.Value.Kind() == slog.KindGroup {
+				flatten(prefix+a.Key+".", a.Value.Group())
+				continue
+			}
+			field(prefix+a.Key, cli.ValueString(a.Value))
+		}
+	}
+	flatten("", e.Attrs)
+	return lines
+}
+
+// drawStatus writes the status line: the prompt being edited, or the
+// position, the level classes shown, the last search and any message.
+func (v *view) drawStatus(buf *bytes.Buffer) {
+	var s string
+	if v.prompt != "" {
+		s = v.prompt + sanitize(string(v.input))
+	} else {
+		classes := make([]byte, 4)
+		for c, name := range classNames {
+			classes[c] = '-'
+			if v.shown[c] {
+				classes[c] = name[0]
+			}
+		}
+		s = fmt.Sprintf("%d/%d  [%s]", min(v.cur+1, v.count()), v.count(), classes)
+		if v.count() < v.idx.Len() {
+			s += fmt.Sprintf(" of %d", v.idx.Len())
+		}
+		if v.search != "" {
+			s += "  search: " + sanitize(v.search)
+		}
+		if v.message != "" {
+			s += "  " + sanitize(v.message)
+		} else {
+			s += "  h help"
+		}
+	}
+	s = truncate(s, v.width)
+	buf.WriteString(csiReverse)
+	buf.WriteString(s)
+	buf.WriteString(strings.Repeat(" ", max(v.width-utf8.RuneCountInString(s), 0)))
+	buf.WriteString(csiReset + csiClearDown)
+}
+
+// truncate cuts s to width runes, not counting the escape sequences it
+// holds.
+func truncate(s string, width int) string {
+	n := 0
+	for i := 0; i < len(s); {
+		if s[i] == 0x1b {
+			j := i + 1
+			if j < len(s) && s[j] == '[' {
+				for j++; j < len(s) && (s[j] < 0x40 || s[j] > 0x7e); j++ {
+				}
+			}
+			i = j + 1
+			continue
+		}
+		if n == width {
+			return s[:i]
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		n++
+	}
+	return s
+}
@@ -0,0 +1,143 @@
+// Command echo-view pretty-prints log files written by echo, in the style of
+// echo's text console output, with colours when writing to a terminal.
+//
+// Usage:
+//
+//	echo-view [flags] [file|glob ...]
+//
+// Files may be in any echo format, compressed (.gz, .zst) or encrypted (with
+// -key). Globs such as 'logs/app*.log.gz' are expanded and read in name
+// order, which puts rotated segments before the active file. With no files,
+// stdin is read.
+//
+// Examples:
+//
+//	echo-view -level warn -since 1h /var/log/app/app.log
+//	echo-view -fields http.status,route 'logs/app*.log*'
+//	echo-view -follow /var/log/app/app.log
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+	"github.com/altitude-analytics/echo/internal/tail"
+)
+
+// filter selects the entries to show.
+type filter struct {
+	minLevel     slog.Level
+	since, until time.Time
+}
+
+func (f filter) match(e echo.Entry) bool {
+	if e.Level < f.minLevel {
+		return false
+	}
+	if !f.since.IsZero() && e.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !e.Time.Before(f.until) {
+		return false
+	}
+	return true
+}
+
+func main() {
+	var (
+		level  = flag.String("level", "debug", "minimum level to show")
+		fields = flag.String("fields", "", "comma-separated attributes to show, e.g. http.status,route (default all)")
+		since  = flag.String("since", "", "show entries at or after this time (RFC 3339, YYYY-MM-DD, or a duration ago such as 15m)")
+		until  = flag.String("until", "", "show entries before this time (same forms as -since)")
+		follow = flag.Bool("follow", false, "keep reading the file as it grows, across rotations")
+		color  = flag.String("color", "auto", "colourise output: auto, always or never")
+		key    = flag.String("key", "", "PEM-encoded RSA private key for encrypted files")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file|glob ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*level, *fields, *since, *until, *follow, *color, *key, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "echo-view: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(level, fields, since, until string, follow bool, color, key string, args []string) error {
+	var f filter
+	var err error
+	if f.minLevel, err = cli.ParseLevel(level); err != nil {
+		return err
+	}
+	now := time.Now()
+	if since != "" {
+		if f.since, err = cli.ParseTime(since, now); err != nil {
+			return err
+		}
+	}
+	if until != "" {
+		if f.until, err = cli.ParseTime(until, now); err != nil {
+			return err
+		}
+	}
+
+	p := &cli.Printer{W: os.Stdout, Fields: cli.SplitList(fields)}
+	if p.Color, err = cli.ParseColor(color, os.Stdout); err != nil {
+		return err
+	}
+
+	opts := &echo.ReaderOptions{}
+	if key != "" {
+		if opts.KeyUnwrapper, err = cli.LoadKeyUnwrapper(key); err != nil {
+			return err
+		}
+	}
+
+	paths, err := cli.ExpandArgs(args)
+	if err != nil {
+		return err
+	}
+	show := func(e echo.Entry) error {
+		if !f.match(e) {
+			return nil
+		}
+		return p.Print(e)
+	}
+
+	if follow {
+		if len(paths) != 1 || paths[0] == cli.Stdin {
+			return fmt.Errorf("-follow needs exactly one file")
+		}
+		return followFile(paths[0], opts, show)
+	}
+	return cli.ReadEntries(paths, opts, os.Stderr, func(_ string, e echo.Entry) error {
+		return show(e)
+	})
+}
+
+// followFile shows the whole file and then keeps showing entries as they are
+// appended, until interrupted.
+func followFile(path string, opts *echo.ReaderOptions, show func(echo.Entry) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fl, err := tail.Open(ctx, path, 0)
+	if err != nil {
+		return err
+	}
+	defer fl.Close()
+	rd, err := echo.NewReader(fl, opts)
+	if err != nil {
+		return err
+	}
+	return cli.Drain(rd, os.Stderr, show)
+}
@@ -0,0 +1,78 @@
+package echo
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultFlushInterval is how often compressed file output is flushed when
+// Config.FileFlushInterval is not set.
+const defaultFlushInterval = time.Second
+
+// compressionExt maps FileCompression values to the extension they add.
+var compressionExt = map[string]string{
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+// flusher is implemented by segment encoders that buffer data internally.
+type flusher interface {
+	Flush() error
+}
+
+// compressEncoder returns a segmentEncoder that writes each segment as an
+// independent gzip or zstd stream. Closing the encoder finishes the stream;
+// a file reopened for appending gets a new stream, which both formats allow
+// to follow a finished one. Use streamsFinished to check for an unfinished
+// one first.
+func compressEncoder(kind string) (segmentEncoder, error) {
+	switch kind {
+	case "gzip":
+		return func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		}, nil
+	case "zstd":
+		return func(w io.Writer) (io.WriteCloser, error) {
+			enc, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+			if err != nil {
+				return nil, fmt.Errorf("echo: failed to start zstd stream: %w", err)
+			}
+			return enc, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown FileCompression '%s'", kind)
+	}
+}
+
+// streamsFinished returns a tailChecker reporting whether a file holds only
+// finished gzip or zstd streams. A stream left unfinished by a crash ends
+// the file without its trailer, so a stream appended after it could never
+// be read. The check decompresses the whole file.
+func streamsFinished(kind string) tailChecker {
+	return func(r io.Reader) bool {
+		var dec io.Reader
+		switch kind {
+		case "gzip":
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return false
+			}
+			dec = gz
+		case "zstd":
+			zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return false
+			}
+			defer zr.Close()
+			dec = zr
+		default:
+			return true
+		}
+		_, err := io.Copy(io.Discard, dec)
+		return err == nil
+	}
+}
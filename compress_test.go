@@ -0,0 +1,174 @@
+package echo
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decompressFile returns the decompressed content of a gzip or zstd file,
+// together with the error that ended the read, if any.
+func decompressFile(t *testing.T, path string) (string, error) {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var r io.Reader
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		gz, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		r = gz
+	case strings.HasSuffix(path, ".zst"):
+		zr, err := zstd.NewReader(f)
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	default:
+		t.Fatalf("unexpected file %s", path)
+	}
+	content, err := io.ReadAll(r)
+	return string(content), err
+}
+
+func TestCompressedFileRotation(t *testing.T) {
+	for _, kind := range []string{"gzip", "zstd"} {
+		t.Run(kind, func(t *testing.T) {
+			dir := t.TempDir()
+			logPath := filepath.Join(dir, "app.log"+compressionExt[kind])
+			encode, err := compressEncoder(kind)
+			require.NoError(t, err)
+
+			// Compressed output reaches the file in blocks, so write enough
+			// poorly compressible data for several of them.
+			const records = 4000
+			w, err := newFileWriter(logPath, fileWriterOptions{encode: encode, maxSize: 64 << 10})
+			require.NoError(t, err)
+			buf := make([]byte, 128)
+			for i := 0; i < records; i++ {
+				_, _ = rand.Read(buf)
+				_, err := w.Write([]byte(hex.EncodeToString(buf) + "\n"))
+				require.NoError(t, err)
+			}
+			require.NoError(t, w.Close())
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Greater(t, len(entries), 1, "Expected rotated segments")
+			total := 0
+			for _, e := range entries {
+				assert.True(t, strings.HasSuffix(e.Name(), ".log"+compressionExt[kind]), "Unexpected name %s", e.Name())
+				// Each segment must decompress on its own.
+				content, err := decompressFile(t, filepath.Join(dir, e.Name()))
+				require.NoError(t, err, "Segment %s should be a complete stream", e.Name())
+				total += strings.Count(content, "\n")
+			}
+			assert.Equal(t, records, total, "No record should be lost across rotations")
+		})
+	}
+}
+
+func TestCompressedFileFlushedWhileOpen(t *testing.T) {
+	for _, kind := range []string{"gzip", "zstd"} {
+		t.Run(kind, func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), "app.log"+compressionExt[kind])
+			encode, err := compressEncoder(kind)
+			require.NoError(t, err)
+
+			w, err := newFileWriter(logPath, fileWriterOptions{encode: encode, flushEvery: 10 * time.Millisecond})
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = w.Close() })
+			_, err = w.Write([]byte("visible before close\n"))
+			require.NoError(t, err)
+
+			// The stream is unfinished, so the reader hits an unexpected EOF,
+			// but everything up to the last flush is readable.
+			assert.Eventually(t, func() bool {
+				content, _ := decompressFile(t, logPath)
+				return content == "visible before close\n"
+			}, time.Second, 10*time.Millisecond)
+
+			// Once flushed, an idle writer leaves the file alone.
+			time.Sleep(20 * time.Millisecond)
+			before, err := os.Stat(logPath)
+			require.NoError(t, err)
+			time.Sleep(50 * time.Millisecond)
+			after, err := os.Stat(logPath)
+			require.NoError(t, err)
+			assert.Equal(t, before.Size(), after.Size(), "Idle flushes should not grow the file")
+		})
+	}
+}
+
+func TestCompressedFileAppend(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "app.log.gz")
+	encode, err := compressEncoder("gzip")
+	require.NoError(t, err)
+	for _, line := range []string{"first run\n", "second run\n"} {
+		w, err := newFileWriter(logPath, fileWriterOptions{encode: encode, appendable: streamsFinished("gzip")})
+		require.NoError(t, err)
+		_, err = w.Write([]byte(line))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+	content, err := decompressFile(t, logPath)
+	require.NoError(t, err)
+	assert.Equal(t, "first run\nsecond run\n", content, "Appended streams should read back as one")
+}
+
+func TestCompressedFileReopenedAfterCrash(t *testing.T) {
+	for _, kind := range []string{"gzip", "zstd"} {
+		t.Run(kind, func(t *testing.T) {
+			dir := t.TempDir()
+			logPath := filepath.Join(dir, "app.log"+compressionExt[kind])
+			encode, err := compressEncoder(kind)
+			require.NoError(t, err)
+			opts := fileWriterOptions{encode: encode, appendable: streamsFinished(kind)}
+
+			// A crash after a flush leaves the stream without its end.
+			w, err := newFileWriter(logPath, opts)
+			require.NoError(t, err)
+			_, err = w.Write([]byte("before the crash\n"))
+			require.NoError(t, err)
+			require.NoError(t, w.enc.(flusher).Flush())
+			require.NoError(t, w.file.Close())
+
+			w, err = newFileWriter(logPath, opts)
+			require.NoError(t, err)
+			_, err = w.Write([]byte("after the restart\n"))
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			content, err := decompressFile(t, logPath)
+			require.NoError(t, err, "The new file should be a complete stream")
+			assert.Equal(t, "after the restart\n", content)
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Len(t, entries, 2, "Expected the unfinished file to be rotated away")
+			for _, e := range entries {
+				if e.Name() != filepath.Base(logPath) {
+					content, _ := decompressFile(t, filepath.Join(dir, e.Name()))
+					assert.Equal(t, "before the crash\n", content, "Flushed records should be kept")
+				}
+			}
+		})
+	}
+}
+
+func TestCompressEncoderUnknown(t *testing.T) {
+	_, err := compressEncoder("lz4")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown FileCompression")
+}
@@ -0,0 +1,136 @@
+package echo
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// diskCheckInterval is how often the disk guard re-reads free space.
+const diskCheckInterval = 10 * time.Second
+
+// diskGuard tracks free space on the log volume. It is shared by every
+// handler derived from the guarded file handler.
+type diskGuard struct {
+	dir       string
+	minFree   uint64
+	stop      bool         // Stop file logging entirely rather than keep Error records
+	base      slog.Handler // Undecorated file handler used for the guard's own notices
+	low       atomic.Bool
+	lastCheck atomic.Int64 // UnixNano of the last check
+	checking  atomic.Bool
+	freeSpace func(dir string) (uint64, error)
+	now       func() time.Time
+}
+
+// diskGuardHandler wraps the file handler and restricts it to Error records,
+// or silences it, while the log volume is short of space.
+type diskGuardHandler struct {
+	next  slog.Handler
+	guard *diskGuard
+}
+
+// newDiskGuardHandler wraps next with a guard on the volume holding dir.
+// action is "stop" or "error-only".
+func newDiskGuardHandler(next slog.Handler, dir string, minFree uint64, action string) *diskGuardHandler {
+	g := &diskGuard{
+		dir:       dir,
+		minFree:   minFree,
+		stop:      action == "stop",
+		base:      next,
+		freeSpace: freeDiskSpace,
+		now:       time.Now,
+	}
+	// lastCheck starts at zero, so the first record triggers a check.
+	return &diskGuardHandler{next: next, guard: g}
+}
+
+// Enabled reports whether next is enabled for level and the guard allows it.
+// While space is low it also re-checks, as nothing else may reach Handle.
+func (h *diskGuardHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.guard.low.Load() {
+		h.guard.maybeCheck(ctx)
+		if !h.guard.allows(level) {
+			return false
+		}
+	}
+	return h.next.Enabled(ctx, level)
+}
+
+// minLevel is the level of next: the guard only raises it while space is
+// low, which must not be cached.
+func (h *diskGuardHandler) minLevel() int64 {
+	return handlerMinLevel(h.next)
+}
+
+// Handle forwards the record unless the guard currently suppresses its level.
+func (h *diskGuardHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.guard.maybeCheck(ctx)
+	if !h.guard.allows(record.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *diskGuardHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &diskGuardHandler{next: h.next.WithAttrs(attrs), guard: h.guard}
+}
+
+func (h *diskGuardHandler) WithGroup(name string) slog.Handler {
+	return &diskGuardHandler{next: h.next.WithGroup(name), guard: h.guard}
+}
+
+// allows reports whether records at level may be written.
+func (g *diskGuard) allows(level slog.Level) bool {
+	if !g.low.Load() {
+		return true
+	}
+	return !g.stop && level >= LevelError
+}
+
+// maybeCheck re-reads free space if the last check is older than
+// diskCheckInterval. Only one caller checks at a time; others carry on with
+// the cached state.
+func (g *diskGuard) maybeCheck(ctx context.Context) {
+	if g.now().UnixNano()-g.lastCheck.Load() < int64(diskCheckInterval) {
+		return
+	}
+	if !g.checking.CompareAndSwap(false, true) {
+		return
+	}
+	defer g.checking.Store(false)
+	g.check(ctx)
+}
+
+// check reads free space and emits a notice when the state changes. A failed
+// check keeps the previous state.
+func (g *diskGuard) check(ctx context.Context) {
+	g.lastCheck.Store(g.now().UnixNano())
+	free, err := g.freeSpace(g.dir)
+	if err != nil {
+		return
+	}
+	low := free < g.minFree
+	if g.low.Swap(low) == low {
+		return
+	}
+
+	var level slog.Level
+	var msg string
+	switch {
+	case !low:
+		level, msg = LevelInfo, "echo: free disk space recovered, file logging resumed"
+	case g.stop:
+		level, msg = LevelWarn, "echo: free disk space below threshold, file logging stopped"
+	default:
+		level, msg = LevelWarn, "echo: free disk space below threshold, file logging restricted to errors"
+	}
+	attrs := []any{"dir", g.dir, "freeBytes", free, "minFreeBytes", g.minFree}
+	slog.New(slog.NewTextHandler(os.Stderr, nil)).Log(ctx, level, msg, attrs...)
+	// Leave a note in the file itself so readers know why records are missing.
+	record := slog.NewRecord(g.now(), level, msg, 0)
+	record.Add(attrs...)
+	_ = g.base.Handle(ctx, record)
+}
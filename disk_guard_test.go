@@ -0,0 +1,75 @@
+package echo
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDiskGuard returns a guarded mock handler whose free space and clock
+// are controlled by the test.
+func newTestDiskGuard(action string, free *uint64, now *time.Time) (*diskGuardHandler, *mockHandler) {
+	mock := newMockHandler(slog.LevelDebug)
+	h := newDiskGuardHandler(mock, "/var/log/app", 1000, action)
+	h.guard.freeSpace = func(string) (uint64, error) { return *free, nil }
+	h.guard.now = func() time.Time { return *now }
+	return h, mock
+}
+
+func TestDiskGuardErrorOnly(t *testing.T) {
+	ctx := context.Background()
+	free := uint64(500)
+	now := time.Now()
+	h, mock := newTestDiskGuard("error-only", &free, &now)
+
+	require.NoError(t, h.Handle(ctx, slog.NewRecord(now, slog.LevelInfo, "dropped", 0)))
+	require.Equal(t, 1, mock.HandledCount(), "Only the low-space warning should be written")
+	warning, _ := mock.LastHandledRecord()
+	assert.Equal(t, slog.LevelWarn, warning.Level)
+	assert.Contains(t, warning.Message, "restricted to errors")
+
+	assert.False(t, h.Enabled(ctx, slog.LevelWarn), "Warn should be disabled while space is low")
+	assert.True(t, h.Enabled(ctx, slog.LevelError), "Error should stay enabled in error-only mode")
+	require.NoError(t, h.Handle(ctx, slog.NewRecord(now, slog.LevelError, "kept", 0)))
+	assert.Equal(t, 2, mock.HandledCount())
+
+	// The warning is emitted once, not on every check.
+	now = now.Add(2 * diskCheckInterval)
+	require.NoError(t, h.Handle(ctx, slog.NewRecord(now, slog.LevelError, "kept again", 0)))
+	assert.Equal(t, 3, mock.HandledCount())
+
+	// Recovery is noticed through Enabled, even though Handle is not reached.
+	free = 5000
+	now = now.Add(2 * diskCheckInterval)
+	assert.True(t, h.Enabled(ctx, slog.LevelInfo), "Info should be re-enabled after recovery")
+	last, _ := mock.LastHandledRecord()
+	assert.Contains(t, last.Message, "recovered")
+}
+
+func TestDiskGuardStop(t *testing.T) {
+	ctx := context.Background()
+	free := uint64(10)
+	now := time.Now()
+	h, mock := newTestDiskGuard("stop", &free, &now)
+
+	require.NoError(t, h.Handle(ctx, slog.NewRecord(now, slog.LevelError, "dropped", 0)))
+	require.Equal(t, 1, mock.HandledCount(), "Only the low-space warning should be written")
+	warning, _ := mock.LastHandledRecord()
+	assert.Contains(t, warning.Message, "stopped")
+	assert.False(t, h.Enabled(ctx, slog.LevelError), "Stop mode should disable all levels")
+}
+
+func TestDiskGuardSharedAcrossDerivedHandlers(t *testing.T) {
+	ctx := context.Background()
+	free := uint64(10)
+	now := time.Now()
+	h, _ := newTestDiskGuard("error-only", &free, &now)
+	derived := h.WithAttrs([]slog.Attr{slog.String("k", "v")}).WithGroup("g")
+
+	require.NoError(t, h.Handle(ctx, slog.NewRecord(now, slog.LevelInfo, "trigger check", 0)))
+	assert.False(t, derived.Enabled(ctx, slog.LevelInfo), "Derived handlers should share the guard state")
+}
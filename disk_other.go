@@ -0,0 +1,14 @@
+//go:build !(darwin || freebsd || linux)
+
+package echo
+
+import "errors"
+
+// diskSpaceSupported reports whether freeDiskSpace works on this platform.
+const diskSpaceSupported = false
+
+// freeDiskSpace is not available on this platform; Init rejects
+// FileMinFreeBytes before it is reached.
+func freeDiskSpace(dir string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,18 @@
+//go:build darwin || freebsd || linux
+
+package echo
+
+import "syscall"
+
+// diskSpaceSupported reports whether freeDiskSpace works on this platform.
+const diskSpaceSupported = true
+
+// freeDiskSpace returns the bytes available to unprivileged users on the
+// volume holding dir.
+func freeDiskSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
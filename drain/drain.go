@@ -0,0 +1,253 @@
+// Package drain groups log messages into templates, so that messages with
+// interpolated values can be counted together. It implements the Drain
+// algorithm (He et al., "Drain: An Online Log Parsing Approach with Fixed
+// Depth Tree", ICWS 2017):
+//
+//	"user 42 logged in from 10.0.0.1"  ┐
+//	"user 7 logged in from 10.0.0.9"   ┴ "user <*> logged in from <*>"
+//
+// Messages are split into tokens at whitespace. A fixed-depth tree keyed by
+// token count and the first tokens narrows the candidate templates; the
+// message joins the most similar one if enough tokens agree, turning the
+// differing tokens into wildcards, or starts a new template otherwise.
+//
+// A Miner learns online, one message at a time. Use it offline over files
+// (echo-stats -templates) or online with NewHandler.
+package drain
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Wildcard is the template token standing for any value.
+const Wildcard = "<*>"
+
+// Config tunes a Miner. The zero value uses the defaults.
+type Config struct {
+	// Depth is the depth of the prefix tree, counting the token-count level;
+	// messages are routed by their first Depth-1 tokens. Defaults to 4.
+	Depth int
+	// Similarity is the fraction of tokens (0-1) that must equal those of a
+	// template for a message to join it. Defaults to 0.4.
+	Similarity float64
+	// MaxChildren bounds the branches of a tree node; further tokens are
+	// routed to a wildcard branch. Defaults to 100.
+	MaxChildren int
+	// MaxTemplates bounds the number of templates. Once reached, messages
+	// that match no template are not learned. Zero means no limit, except
+	// for a Miner passed to NewHandler, which defaults to
+	// DefaultHandlerMaxTemplates; a negative value means no limit.
+	MaxTemplates int
+}
+
+// Template is a message template with the number of messages it covers.
+type Template struct {
+	// ID identifies the template within its Miner. It does not change as
+	// the template is generalised, but is not stable across Miners; see
+	// StableID.
+	ID     int64
+	Tokens []string
+	Count  int64
+}
+
+// String returns the template as text, with Wildcard in place of values.
+func (t Template) String() string { return strings.Join(t.Tokens, " ") }
+
+// StableID returns a hash of the template's text as 16 hex digits. Unlike
+// ID it is the same for the same template in every Miner, so it groups
+// records across restarts and processes, but it changes when the template
+// is generalised, as it typically is by the second message it covers.
+func (t Template) StableID() string {
+	h := fnv.New64a()
+	h.Write([]byte(t.String()))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// Miner learns templates from messages. It is safe for concurrent use.
+type Miner struct {
+	cfg Config
+
+	mu        sync.Mutex
+	root      map[int]*node // By token count
+	templates []*cluster    // By ID - 1
+}
+
+type node struct {
+	children map[string]*node
+	clusters []*cluster // Leaves only
+}
+
+type cluster struct {
+	id     int64
+	tokens []string
+	count  int64
+}
+
+// New returns a Miner with no templates.
+func New(cfg Config) *Miner {
+	if cfg.Depth < 3 {
+		cfg.Depth = 4
+	}
+	if cfg.Similarity <= 0 {
+		cfg.Similarity = 0.4
+	}
+	if cfg.MaxChildren <= 0 {
+		cfg.MaxChildren = 100
+	}
+	return &Miner{cfg: cfg, root: map[int]*node{}}
+}
+
+// Add learns msg and returns the template it now belongs to. It reports
+// false, with a zero Template, only when MaxTemplates stops a new template
+// from being created.
+func (m *Miner) Add(msg string) (Template, bool) {
+	tokens := strings.Fields(msg)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	leaf := m.leaf(tokens, true)
+	c := m.best(leaf, tokens, false)
+	if c == nil {
+		if m.cfg.MaxTemplates > 0 && len(m.templates) >= m.cfg.MaxTemplates {
+			return Template{}, false
+		}
+		c = &cluster{id: int64(len(m.templates) + 1), tokens: tokens}
+		m.templates = append(m.templates, c)
+		leaf.clusters = append(leaf.clusters, c)
+	} else {
+		for i, tok := range tokens {
+			if c.tokens[i] != tok {
+				c.tokens[i] = Wildcard
+			}
+		}
+	}
+	c.count++
+	return c.template(), true
+}
+
+// Match returns the template msg fits, without learning from it: every
+// token must equal the template's or stand where it has a wildcard.
+func (m *Miner) Match(msg string) (Template, bool) {
+	tokens := strings.Fields(msg)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	leaf := m.leaf(tokens, false)
+	if leaf == nil {
+		return Template{}, false
+	}
+	if c := m.best(leaf, tokens, true); c != nil {
+		return c.template(), true
+	}
+	return Template{}, false
+}
+
+// Template returns the template with the given ID.
+func (m *Miner) Template(id int64) (Template, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > int64(len(m.templates)) {
+		return Template{}, false
+	}
+	return m.templates[id-1].template(), true
+}
+
+// Templates returns all templates, most frequent first.
+func (m *Miner) Templates() []Template {
+	m.mu.Lock()
+	out := make([]Template, len(m.templates))
+	for i, c := range m.templates {
+		out[i] = c.template()
+	}
+	m.mu.Unlock()
+	slices.SortStableFunc(out, func(a, b Template) int {
+		switch {
+		case a.Count > b.Count:
+			return -1
+		case a.Count < b.Count:
+			return 1
+		}
+		return 0
+	})
+	return out
+}
+
+func (c *cluster) template() Template {
+	return Template{ID: c.id, Tokens: slices.Clone(c.tokens), Count: c.count}
+}
+
+// leaf walks the tree to the leaf for tokens, creating nodes if learn is
+// set; otherwise it returns nil if there is no such leaf.
+func (m *Miner) leaf(tokens []string, learn bool) *node {
+	n := m.root[len(tokens)]
+	if n == nil {
+		if !learn {
+			return nil
+		}
+		n = &node{children: map[string]*node{}}
+		m.root[len(tokens)] = n
+	}
+	for i := 0; i < m.cfg.Depth-2 && i < len(tokens); i++ {
+		key := tokens[i]
+		if hasDigit(key) {
+			key = Wildcard
+		}
+		child := n.children[key]
+		if child == nil {
+			if key != Wildcard && (!learn || len(n.children) >= m.cfg.MaxChildren) {
+				key = Wildcard
+				child = n.children[key]
+			}
+			if child == nil {
+				if !learn {
+					return nil
+				}
+				child = &node{children: map[string]*node{}}
+				n.children[key] = child
+			}
+		}
+		n = child
+	}
+	return n
+}
+
+// best returns the cluster of leaf most similar to tokens, or nil if none
+// is similar enough. With exact set, wildcards must cover every difference.
+func (m *Miner) best(leaf *node, tokens []string, exact bool) *cluster {
+	var best *cluster
+	bestSim, bestWild := -1.0, -1
+	for _, c := range leaf.clusters {
+		same, wild := 0, 0
+		for i, tok := range tokens {
+			switch c.tokens[i] {
+			case Wildcard:
+				wild++
+			case tok:
+				same++
+			}
+		}
+		if exact && same+wild != len(tokens) {
+			continue
+		}
+		sim := 1.0
+		if len(tokens) > 0 {
+			sim = float64(same) / float64(len(tokens))
+		}
+		if sim > bestSim || sim == bestSim && wild > bestWild {
+			best, bestSim, bestWild = c, sim, wild
+		}
+	}
+	if best == nil || !exact && bestSim < m.cfg.Similarity {
+		return nil
+	}
+	return best
+}
+
+func hasDigit(s string) bool {
+	return strings.IndexFunc(s, unicode.IsDigit) >= 0
+}
@@ -0,0 +1,137 @@
+package drain
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMinerGroupsMessages(t *testing.T) {
+	m := New(Config{})
+	first, ok := m.Add("user 42 logged in from 10.0.0.1")
+	require.True(t, ok)
+	assert.Equal(t, "user 42 logged in from 10.0.0.1", first.String(), "A new template is the message itself")
+
+	second, _ := m.Add("user 7 logged in from 10.0.0.9")
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, "user <*> logged in from <*>", second.String())
+	assert.Equal(t, int64(2), second.Count)
+
+	other, _ := m.Add("connection reset by peer")
+	assert.NotEqual(t, first.ID, other.ID)
+	different, _ := m.Add("user 9 deleted their account forever")
+	assert.NotEqual(t, first.ID, different.ID, "Too few shared tokens should start a new template")
+
+	for i := 0; i < 5; i++ {
+		m.Add(fmt.Sprintf("user %d logged in from 10.0.1.%d", i, i))
+	}
+	templates := m.Templates()
+	require.Len(t, templates, 3)
+	assert.Equal(t, "user <*> logged in from <*>", templates[0].String())
+	assert.Equal(t, int64(7), templates[0].Count)
+
+	got, ok := m.Template(first.ID)
+	require.True(t, ok)
+	assert.Equal(t, templates[0], got)
+	_, ok = m.Template(99)
+	assert.False(t, ok)
+}
+
+func TestMinerMatch(t *testing.T) {
+	m := New(Config{})
+	m.Add("cache miss for key a1")
+	m.Add("cache miss for key b2")
+
+	tpl, ok := m.Match("cache miss for key zz")
+	require.True(t, ok)
+	assert.Equal(t, "cache miss for key <*>", tpl.String())
+	assert.Equal(t, int64(2), tpl.Count, "Match should not learn")
+
+	_, ok = m.Match("cache hit for key zz")
+	assert.False(t, ok, "Every token must fit the template")
+	_, ok = m.Match("something else entirely")
+	assert.False(t, ok)
+	assert.Len(t, m.Templates(), 1)
+}
+
+func TestMinerLimits(t *testing.T) {
+	m := New(Config{MaxTemplates: 2, MaxChildren: 1})
+	m.Add("alpha one")
+	m.Add("beta two")
+	_, ok := m.Add("gamma three extra")
+	assert.False(t, ok, "MaxTemplates should stop new templates")
+
+	tpl, ok := m.Add("alpha one")
+	require.True(t, ok, "Known messages still match")
+	assert.Equal(t, int64(2), tpl.Count)
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	m := New(Config{})
+	logger := slog.New(NewHandler(slog.NewTextHandler(&buf, nil), m)).With("svc", "api")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger.Info(fmt.Sprintf("job %d done", i))
+		}()
+	}
+	wg.Wait()
+	logger.Info("unrelated message here")
+
+	templates := m.Templates()
+	require.Len(t, templates, 2)
+	assert.Equal(t, "job <*> done", templates[0].String())
+	// The first job message is logged before its template is generalised.
+	assert.Equal(t, 9, bytes.Count(buf.Bytes(), []byte("svc=api template_id="+templates[0].StableID()+"\n")))
+	assert.Contains(t, buf.String(), `msg="unrelated message here" svc=api template_id=`+templates[1].StableID())
+}
+
+func TestStableID(t *testing.T) {
+	a, b := New(Config{}), New(Config{})
+	a.Add("user 1 logged in")
+	ta, _ := a.Add("user 2 logged in")
+	b.Add("disk full")
+	b.Add("user 7 logged in")
+	tb, _ := b.Add("user 9 logged in")
+	assert.NotEqual(t, ta.ID, tb.ID)
+	assert.Equal(t, ta.StableID(), tb.StableID(), "The same template should have the same ID in every Miner")
+	assert.Len(t, ta.StableID(), 16)
+
+	other, _ := a.Add("disk full")
+	assert.NotEqual(t, ta.StableID(), other.StableID())
+}
+
+func TestHandlerBoundsTemplates(t *testing.T) {
+	m := New(Config{})
+	logger := slog.New(NewHandler(slog.NewTextHandler(io.Discard, nil), m))
+	for i := range DefaultHandlerMaxTemplates + 10 {
+		logger.Info(letters(i))
+	}
+	assert.Len(t, m.Templates(), DefaultHandlerMaxTemplates)
+
+	unlimited := New(Config{MaxTemplates: -1})
+	logger = slog.New(NewHandler(slog.NewTextHandler(io.Discard, nil), unlimited))
+	for i := range DefaultHandlerMaxTemplates + 10 {
+		logger.Info(letters(i))
+	}
+	assert.Len(t, unlimited.Templates(), DefaultHandlerMaxTemplates+10)
+}
+
+// letters spells i in letters, a message no other i shares a template with.
+func letters(i int) string {
+	b := []byte{byte('a' + i%26)}
+	for i /= 26; i > 0; i /= 26 {
+		b = append(b, byte('a'+i%26))
+	}
+	return string(b)
+}
@@ -0,0 +1,63 @@
+package drain
+
+import (
+	"context"
+	"log/slog"
+)
+
+// TemplateKey is the attribute key used by Handler.
+const TemplateKey = "template_id"
+
+// DefaultHandlerMaxTemplates is the MaxTemplates NewHandler gives a Miner
+// configured without one.
+const DefaultHandlerMaxTemplates = 1000
+
+// Handler is a slog.Handler that learns the template of each record's
+// message and adds its Template.StableID under TemplateKey before passing
+// the record on, so that the attribute groups records across restarts and
+// replicas.
+// Like other record attributes, the ID goes into the logger's current group,
+// if any.
+type Handler struct {
+	next  slog.Handler
+	miner *Miner
+}
+
+// NewHandler returns a Handler adding template IDs from m to the records
+// passed to next. A Handler typically sees the messages of a long-running
+// process, so if m has no MaxTemplates, it is set to
+// DefaultHandlerMaxTemplates to keep m from growing without bound; set a
+// negative MaxTemplates to really have no limit.
+func NewHandler(next slog.Handler, m *Miner) *Handler {
+	m.mu.Lock()
+	if m.cfg.MaxTemplates == 0 {
+		m.cfg.MaxTemplates = DefaultHandlerMaxTemplates
+	}
+	m.mu.Unlock()
+	return &Handler{next: next, miner: m}
+}
+
+// Enabled reports whether next is enabled for level.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle adds the stable template ID of r's message and passes r to next. Records
+// that MaxTemplates keeps from forming a template are passed on unchanged.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if t, ok := h.miner.Add(r.Message); ok {
+		r = r.Clone()
+		r.AddAttrs(slog.String(TemplateKey, t.StableID()))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns a Handler sharing h's Miner in front of next.WithAttrs.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{next: h.next.WithAttrs(attrs), miner: h.miner}
+}
+
+// WithGroup returns a Handler sharing h's Miner in front of next.WithGroup.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name), miner: h.miner}
+}
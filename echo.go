@@ -7,7 +7,11 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // LogLevel aliases slog.Level for configuration clarity.
@@ -32,12 +36,70 @@ type Config struct {
 	FileOutput bool
 	// FilePath specifies the path for the log file. Required if FileOutput is true.
 	FilePath string
-	// FileFormat specifies the format for file logs ("json" or "text"). Defaults to "json".
+	// FileFormat specifies the format for file logs ("json", "text", "logfmt" or "cbor"). Defaults to "json".
+	// "cbor" is a compact binary format that keeps slog types; read it with NewCBORReader.
+	// A record cut short by a crash is dropped when the file is reopened.
+	// It cannot be combined with FileShared, whose record size cap would cut binary
+	// records, and does not support ReplaceAttr (see NewFormatHandler).
 	FileFormat string
 	// ConsoleFormat specifies the format for console logs ("json" or "text"). Defaults to "text".
 	ConsoleFormat string
 	// AddSource includes the source code position (file:line) in logs. Useful for debugging.
 	AddSource bool
+	// FileMaxSize rotates the log file before it grows beyond this many bytes. The
+	// current file is renamed with a timestamp ("app-20060102T150405.000000000.log")
+	// and a new one is started. Zero disables rotation.
+	FileMaxSize int64
+	// FileShared makes file output safe for several processes appending to the same
+	// FilePath. Each record is written with a single append, capped at
+	// FileMaxRecordSize, and rotation is coordinated through an advisory flock on
+	// "<FilePath>.lock". Only supported on Unix-like systems.
+	FileShared bool
+	// FileMaxRecordSize caps the size of a single record in FileShared mode. Longer
+	// records are truncated. Defaults to 64 KiB.
+	FileMaxRecordSize int
+	// FileEncryptionKey, if set, encrypts the log file at rest with AES-256-GCM.
+	// Each segment gets a fresh data key wrapped by this KeyWrapper (see
+	// NewRSAKeyWrapper). Read such files with NewDecryptReader or cmd/echo-decrypt.
+	// Cannot be combined with FileShared.
+	FileEncryptionKey KeyWrapper
+	// FileMode is the permission mode of log files created by echo, applied
+	// regardless of umask. Defaults to 0640.
+	FileMode os.FileMode
+	// DirMode is the permission mode of the log directory if echo creates it.
+	// Defaults to 0750.
+	DirMode os.FileMode
+	// FileGroup, if set, is the group (name or numeric ID) given to log files and
+	// to the log directory when echo creates them. Not supported on Windows.
+	FileGroup string
+	// FileMinFreeBytes enables a disk-space guard: when free space on the log
+	// volume drops below this many bytes, file logging is restricted according to
+	// FileLowSpaceAction and a warning is emitted once. Logging returns to normal
+	// when space recovers. Zero disables the guard.
+	FileMinFreeBytes uint64
+	// FileLowSpaceAction is what the disk-space guard does ("error-only" or
+	// "stop"). Defaults to "error-only".
+	FileLowSpaceAction string
+	// FileCompression writes the log file compressed on the fly ("gzip" or
+	// "zstd"). The matching extension (".gz" or ".zst") is appended to FilePath
+	// if missing. Each segment is an independent compressed stream, finished on
+	// rotation and Close; a file whose last stream a crash left unfinished is
+	// rotated away when reopened. FileMaxSize then applies to the compressed size, which
+	// grows in blocks, so segments may overshoot it slightly. Cannot be combined
+	// with FileShared or FileEncryptionKey.
+	FileCompression string
+	// FileFlushInterval is how often compressed output is flushed so that the
+	// active file can be decompressed while it is being written. Defaults to 1s.
+	FileFlushInterval time.Duration
+	// RuntimeStatsInterval, if set, logs Go runtime statistics at Info at this
+	// interval: heap and total memory, GC goal, goroutines, GC cycles, and
+	// quantiles of GC pauses and scheduling latency over the interval, from
+	// runtime/metrics. The reporter is stopped by the FileCloser returned by
+	// Init; NewHandler ignores it.
+	RuntimeStatsInterval time.Duration
+	// Handlers are further outputs receiving every record alongside the console
+	// and the file, e.g. a store.Handler. Each applies its own level.
+	Handlers []slog.Handler
 }
 
 // FileCloser is the interface returned by Init, allowing the caller to close the log file.
@@ -55,8 +117,34 @@ func (nc noopCloser) Close() error { return nil }
 // (if opened) and an error if initialization fails. The caller is responsible
 // for calling the Close() method on the returned FileCloser, typically using defer.
 func Init(cfg Config) (FileCloser, error) {
+	handler, closer, err := newHandler(cfg, "echo.Init")
+	if err != nil {
+		return closer, err
+	}
+
+	// --- Create and Set Logger ---
+	logger := slog.New(handler)
+	slog.SetDefault(logger) // Set as the global default logger
+
+	slog.Info("Echo logger initialized") // Log confirmation using the new setup
+
+	if cfg.RuntimeStatsInterval > 0 {
+		closer = statsCloser{stop: startRuntimeStats(logger, cfg.RuntimeStatsInterval), next: closer}
+	}
+	return closer, nil
+}
+
+// NewHandler builds the handler tree Init would install for cfg, without
+// touching the default logger, e.g. to replay logs through it or to run
+// several configurations side by side. The caller must Close the returned
+// FileCloser.
+func NewHandler(cfg Config) (slog.Handler, FileCloser, error) {
+	return newHandler(cfg, "echo.NewHandler")
+}
+
+// newHandler implements NewHandler; op prefixes errors.
+func newHandler(cfg Config, op string) (slog.Handler, FileCloser, error) {
 	var handlers []slog.Handler
-	var logFile *os.File
 	var err error
 
 	// --- Set Defaults ---
@@ -73,6 +161,18 @@ func Init(cfg Config) (FileCloser, error) {
 	if cfg.ConsoleFormat == "" {
 		cfg.ConsoleFormat = "text"
 	}
+	if cfg.FileMode == 0 {
+		cfg.FileMode = defaultFileMode
+	}
+	if cfg.DirMode == 0 {
+		cfg.DirMode = defaultDirMode
+	}
+	if cfg.FileLowSpaceAction == "" {
+		cfg.FileLowSpaceAction = "error-only"
+	}
+	if cfg.FileFlushInterval == 0 {
+		cfg.FileFlushInterval = defaultFlushInterval
+	}
 
 	// --- Handler Options ---
 	handlerOpts := &slog.HandlerOptions{
@@ -80,18 +180,16 @@ func Init(cfg Config) (FileCloser, error) {
 		Level:     cfg.Level,
 	}
 
-	// --- Console Handler ---
+	// --- Console Output ---
+	// Outputs are collected first and turned into handlers at the end, so
+	// that outputs sharing a format encode each record once.
+	var outputs []output
 	if *cfg.ConsoleOutput {
-		var consoleHandler slog.Handler
-		switch cfg.ConsoleFormat {
-		case "json":
-			consoleHandler = slog.NewJSONHandler(os.Stdout, handlerOpts)
-		case "text":
-			fallthrough // Default to text
-		default:
-			consoleHandler = slog.NewTextHandler(os.Stdout, handlerOpts)
-		}
-		handlers = append(handlers, consoleHandler)
+		consoleFormat := "text" // Default to text
+		if cfg.ConsoleFormat == "json" {
+			consoleFormat = "json"
+		}
+		outputs = append(outputs, output{format: consoleFormat, opts: handlerOpts, w: os.Stdout})
 		// Use a temporary logger for init messages before default is set
 		slog.New(slog.NewTextHandler(os.Stderr, nil)).Debug(
 			"Console logging enabled",
@@ -106,52 +204,117 @@ func Init(cfg Config) (FileCloser, error) {
 
 	if cfg.FileOutput {
 		if cfg.FilePath == "" {
-			return closer, fmt.Errorf("echo.Init: FilePath is required when FileOutput is true")
+			return nil, closer, fmt.Errorf("%s: FilePath is required when FileOutput is true", op)
+		}
+
+		if cfg.FileLowSpaceAction != "error-only" && cfg.FileLowSpaceAction != "stop" {
+			return nil, closer, fmt.Errorf("%s: unknown FileLowSpaceAction '%s'", op, cfg.FileLowSpaceAction)
+		}
+		if cfg.FileMinFreeBytes > 0 && !diskSpaceSupported {
+			return nil, closer, fmt.Errorf("%s: FileMinFreeBytes is not supported on this platform", op)
+		}
+		gid := -1
+		if cfg.FileGroup != "" {
+			if gid, err = lookupGroup(cfg.FileGroup); err != nil {
+				return nil, closer, fmt.Errorf("%s: %w", op, err)
+			}
 		}
 
 		// Ensure directory exists
 		logDir := filepath.Dir(cfg.FilePath)
 		if logDir != "." && logDir != "/" { // Avoid MkdirAll on current dir or root
-			if err := os.MkdirAll(logDir, 0750); err != nil {
-				return closer, fmt.Errorf("echo.Init: failed to create log directory '%s': %w", logDir, err)
+			if err := makeLogDir(logDir, cfg.DirMode, gid); err != nil {
+				return nil, closer, fmt.Errorf("%s: failed to create log directory '%s': %w", op, logDir, err)
+			}
+		}
+
+		if cfg.FileShared && !flockSupported {
+			return nil, closer, fmt.Errorf("%s: FileShared is not supported on this platform", op)
+		}
+		if cfg.FileShared && canonicalFormat(cfg.FileFormat) == "cbor" {
+			return nil, closer, fmt.Errorf("%s: FileFormat \"cbor\" cannot be combined with FileShared", op)
+		}
+		if cfg.FileShared && cfg.FileEncryptionKey != nil {
+			return nil, closer, fmt.Errorf("%s: FileEncryptionKey cannot be combined with FileShared", op)
+		}
+		if cfg.FileCompression != "" && (cfg.FileShared || cfg.FileEncryptionKey != nil) {
+			return nil, closer, fmt.Errorf("%s: FileCompression cannot be combined with FileShared or FileEncryptionKey", op)
+		}
+		var encode segmentEncoder
+		var trimTail tailTrimmer
+		var appendable tailChecker
+		if cfg.FileEncryptionKey != nil {
+			encode = encryptEncoder(cfg.FileEncryptionKey)
+			trimTail = trimPartialFrame
+		}
+		if cfg.FileCompression != "" {
+			if encode, err = compressEncoder(cfg.FileCompression); err != nil {
+				return nil, closer, fmt.Errorf("%s: %w", op, err)
+			}
+			appendable = streamsFinished(cfg.FileCompression)
+			if ext := compressionExt[cfg.FileCompression]; !strings.HasSuffix(cfg.FilePath, ext) {
+				cfg.FilePath += ext
 			}
 		}
+		if encode == nil && canonicalFormat(cfg.FileFormat) == "cbor" {
+			trimTail = trimPartialCBOR
+		}
 
 		// Open file for appending, create if it doesn't exist
-		logFile, err = os.OpenFile(cfg.FilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		logFile, err := newFileWriter(cfg.FilePath, fileWriterOptions{
+			maxSize:    cfg.FileMaxSize,
+			shared:     cfg.FileShared,
+			maxRecord:  cfg.FileMaxRecordSize,
+			encode:     encode,
+			trimTail:   trimTail,
+			appendable: appendable,
+			perm:       cfg.FileMode,
+			chgrp:      gid >= 0,
+			gid:        gid,
+			flushEvery: cfg.FileFlushInterval,
+		})
 		if err != nil {
-			return closer, fmt.Errorf("echo.Init: failed to open log file '%s': %w", cfg.FilePath, err)
+			return nil, closer, fmt.Errorf("%s: %w", op, err)
 		}
 		closer = logFile // Assign the actual file to be closed
 
-		var fileHandler slog.Handler
 		var fileWriter io.Writer = logFile
 
-		switch cfg.FileFormat {
-		case "text":
-			fileHandler = slog.NewTextHandler(fileWriter, handlerOpts)
-		case "json":
-			fallthrough // Default to json
-		default:
-			fileHandler = slog.NewJSONHandler(fileWriter, handlerOpts)
+		fileFormat := canonicalFormat(cfg.FileFormat)
+		if fileFormat == "" {
+			fileFormat = "json" // Default to json
+		}
+		if cfg.FileMinFreeBytes > 0 {
+			// The guard filters records for the file alone, so it cannot
+			// share an encoding with the console.
+			fileHandler, _ := NewFormatHandler(fileFormat, fileWriter, handlerOpts)
+			handlers = append(handlers, newDiskGuardHandler(fileHandler, logDir, cfg.FileMinFreeBytes, cfg.FileLowSpaceAction))
+		} else {
+			outputs = append(outputs, output{format: fileFormat, opts: handlerOpts, w: fileWriter})
 		}
-		handlers = append(handlers, fileHandler)
 		slog.New(slog.NewTextHandler(os.Stderr, nil)).Debug(
 			"File logging enabled",
 			"path", cfg.FilePath,
 			"level", cfg.Level.String(),
 			"format", cfg.FileFormat,
 			"addSource", cfg.AddSource,
+			"maxSize", cfg.FileMaxSize,
+			"shared", cfg.FileShared,
+			"encrypted", cfg.FileEncryptionKey != nil,
+			"compression", cfg.FileCompression,
 		)
 	}
 
+	handlers = append(newOutputHandlers(outputs), handlers...)
+	handlers = append(handlers, cfg.Handlers...)
+
 	// --- Combine Handlers ---
 	var finalHandler slog.Handler
 	if len(handlers) == 0 {
 		// If absolutely no output is configured, perhaps default to a handler that discards everything?
 		// Or stick with minimal console info as before. Let's discard to be truly silent if configured.
 		slog.New(slog.NewTextHandler(os.Stderr, nil)).Warn(
-			"echo.Init: No log outputs configured. Logs will be discarded.",
+			op + ": No log outputs configured. Logs will be discarded.",
 		)
 		finalHandler = slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}) // Effectively disable
 	} else if len(handlers) == 1 {
@@ -161,13 +324,41 @@ func Init(cfg Config) (FileCloser, error) {
 		finalHandler = newMultiHandler(handlers...)
 	}
 
-	// --- Create and Set Logger ---
-	logger := slog.New(finalHandler)
-	slog.SetDefault(logger) // Set as the global default logger
+	return finalHandler, closer, nil
+}
 
-	slog.Info("Echo logger initialized") // Log confirmation using the new setup
+// makeLogDir creates dir and any missing parents. If dir itself is created, it
+// gets exactly perm and, when gid is not negative, that group.
+func makeLogDir(dir string, perm os.FileMode, gid int) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, perm); err != nil {
+		return err
+	}
+	if gid >= 0 {
+		return os.Chown(dir, -1, gid)
+	}
+	return nil
+}
 
-	return closer, nil
+// lookupGroup resolves a group name or numeric ID to a gid.
+func lookupGroup(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up group '%s': %w", group, err)
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return 0, fmt.Errorf("group '%s' has non-numeric ID '%s'", group, g.Gid)
+	}
+	return gid, nil
 }
 
 // ErrAttr is a helper to create a slog.Attr for an error under the key "error".
@@ -2,7 +2,10 @@ package echo_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/json"
 	"errors"
 	"io"
@@ -10,8 +13,10 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings" // Keep sync for now, might not be needed for buffer capture
 	"testing"
+	"time"
 
 	// Adjust import path to your actual module path
 	"github.com/altitude-analytics/echo" // <-- Adjust this path
@@ -532,3 +537,216 @@ func TestErrAttr(t *testing.T) {
 		assert.Equal(t, testErr, errVal, "Error value mismatch")
 	})
 }
+
+func TestInitEncryptedFile(t *testing.T) {
+	originalLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(originalLogger) })
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kw, err := echo.NewRSAKeyWrapper(&priv.PublicKey)
+	require.NoError(t, err)
+	ku, err := echo.NewRSAKeyUnwrapper(priv)
+	require.NoError(t, err)
+
+	logPath := filepath.Join(t.TempDir(), "secret.log")
+	consoleOutput := false
+	closer, err := echo.Init(echo.Config{
+		ConsoleOutput:     &consoleOutput,
+		FileOutput:        true,
+		FilePath:          logPath,
+		FileEncryptionKey: kw,
+	})
+	require.NoError(t, err)
+	slog.Info("Regulated data", "ssn", "000-00-0000")
+	require.NoError(t, closer.Close())
+
+	raw := readLogFile(t, logPath)
+	assert.NotContains(t, raw, "000-00-0000", "Log file should be encrypted")
+
+	f, err := os.Open(logPath)
+	require.NoError(t, err)
+	defer f.Close()
+	plain, err := io.ReadAll(echo.NewDecryptReader(f, ku))
+	require.NoError(t, err)
+	logs := parseJSONLogs(t, string(plain))
+	require.Len(t, logs, 2, "Expected 2 log entries in file (Init + test)")
+	assert.Equal(t, "000-00-0000", logs[1]["ssn"])
+}
+
+func TestInitErrorEncryptedShared(t *testing.T) {
+	originalLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(originalLogger) })
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kw, err := echo.NewRSAKeyWrapper(&priv.PublicKey)
+	require.NoError(t, err)
+
+	consoleOutput := false
+	_, err = echo.Init(echo.Config{
+		ConsoleOutput:     &consoleOutput,
+		FileOutput:        true,
+		FilePath:          filepath.Join(t.TempDir(), "secret.log"),
+		FileShared:        true,
+		FileEncryptionKey: kw,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be combined")
+}
+
+func TestInitErrorCBORShared(t *testing.T) {
+	originalLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(originalLogger) })
+
+	consoleOutput := false
+	_, err := echo.Init(echo.Config{
+		ConsoleOutput: &consoleOutput,
+		FileOutput:    true,
+		FilePath:      filepath.Join(t.TempDir(), "app.cbor"),
+		FileFormat:    "cbor",
+		FileShared:    true,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be combined")
+}
+
+func TestInitFileAndDirModes(t *testing.T) {
+	originalLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(originalLogger) })
+
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping permission test on Windows")
+	}
+	logDir := filepath.Join(t.TempDir(), "logs")
+	logPath := filepath.Join(logDir, "app.log")
+	consoleOutput := false
+	cfg := echo.Config{
+		ConsoleOutput: &consoleOutput,
+		FileOutput:    true,
+		FilePath:      logPath,
+		FileMode:      0600,
+		DirMode:       0700,
+		FileGroup:     strconv.Itoa(os.Getgid()),
+	}
+	_, err := runInitWithCleanup(t, cfg, nil)
+	require.NoError(t, err)
+
+	fi, err := os.Stat(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "File mode mismatch")
+	di, err := os.Stat(logDir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), di.Mode().Perm(), "Directory mode mismatch")
+}
+
+func TestInitErrorUnknownLowSpaceAction(t *testing.T) {
+	originalLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(originalLogger) })
+
+	consoleOutput := false
+	_, err := echo.Init(echo.Config{
+		ConsoleOutput:      &consoleOutput,
+		FileOutput:         true,
+		FilePath:           filepath.Join(t.TempDir(), "app.log"),
+		FileMinFreeBytes:   1,
+		FileLowSpaceAction: "panic",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown FileLowSpaceAction")
+}
+
+func TestInitCompressedFile(t *testing.T) {
+	originalLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(originalLogger) })
+
+	logPath := filepath.Join(t.TempDir(), "batch.log")
+	consoleOutput := false
+	closer, err := echo.Init(echo.Config{
+		ConsoleOutput:   &consoleOutput,
+		FileOutput:      true,
+		FilePath:        logPath,
+		FileCompression: "gzip",
+	})
+	require.NoError(t, err)
+	slog.Info("Compressed record", "n", 1)
+	require.NoError(t, closer.Close())
+
+	assert.NoFileExists(t, logPath)
+	f, err := os.Open(logPath + ".gz")
+	require.NoError(t, err, "Compressed file should get the .gz extension")
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	content, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	logs := parseJSONLogs(t, string(content))
+	require.Len(t, logs, 2, "Expected 2 log entries in file (Init + test)")
+	assert.Equal(t, "Compressed record", logs[1]["msg"])
+}
+
+func TestInitFileCBOR(t *testing.T) {
+	tempDir := t.TempDir()
+	logPath := filepath.Join(tempDir, "test_file.cbor")
+	consoleOutput := false
+	cfg := echo.Config{
+		ConsoleOutput: &consoleOutput,
+		FileOutput:    true,
+		FilePath:      logPath,
+		FileFormat:    "cbor",
+	}
+	closer, err := runInitWithCleanup(t, cfg, nil)
+	require.NoError(t, err)
+	require.NotNil(t, closer)
+
+	slog.Info("File cbor info", "took", 2*time.Second)
+
+	f, err := os.Open(logPath)
+	require.NoError(t, err)
+	defer f.Close()
+	cr := echo.NewCBORReader(f)
+	var records []slog.Record
+	for {
+		r, err := cr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		records = append(records, r)
+	}
+	require.Len(t, records, 2, "Expected two log entries in file (Init + test)")
+	assert.Equal(t, "Echo logger initialized", records[0].Message)
+	assert.Equal(t, "File cbor info", records[1].Message)
+	records[1].Attrs(func(a slog.Attr) bool {
+		assert.Equal(t, "took", a.Key)
+		assert.Equal(t, 2*time.Second, a.Value.Duration(), "Duration should keep its type")
+		return true
+	})
+}
+
+func TestInitRuntimeStats(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "stats.log")
+	consoleOutput := false
+	originalLogger := slog.Default()
+	defer slog.SetDefault(originalLogger)
+	closer, err := echo.Init(echo.Config{
+		ConsoleOutput:        &consoleOutput,
+		FileOutput:           true,
+		FilePath:             logPath,
+		RuntimeStatsInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(readLogFile(t, logPath), `"msg":"runtime stats"`)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, closer.Close(), "Close stops the reporter before closing the file")
+
+	logs := parseJSONLogs(t, readLogFile(t, logPath))
+	stats := logs[len(logs)-1]
+	assert.Equal(t, "runtime stats", stats["msg"])
+	for _, key := range []string{"heap_bytes", "heap_goal_bytes", "goroutines", "gc_cycles", "gc_pause_p99", "sched_latency_p50"} {
+		assert.Contains(t, stats, key)
+	}
+	assert.Positive(t, stats["goroutines"])
+}
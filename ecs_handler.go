@@ -0,0 +1,63 @@
+package echo
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// ecsVersion is the version of the Elastic Common Schema written by the
+// "ecs" format.
+const ecsVersion = "8.11.0"
+
+// newECSHandler returns a handler writing records to w as JSON lines in the
+// Elastic Common Schema, as ECS loggers do: "@timestamp" in UTC, a lower
+// case "log.level", "message", "log.origin" for the source and
+// "ecs.version", followed by the attributes as the JSON format writes them.
+// A top-level "error" attribute is written as "error.message", since ECS
+// maps "error" as an object.
+func newECSHandler(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	return newEntryWriter(w, appendECSEntry, opts)
+}
+
+func appendECSEntry(b []byte, e Entry) []byte {
+	b = append(b, '{')
+	if !e.Time.IsZero() {
+		b = appendJSONKey(b, "@timestamp")
+		b = appendJSONTime(b, e.Time.UTC())
+	}
+	b = appendJSONKey(b, "log.level")
+	b = appendJSONString(b, strings.ToLower(e.Level.String()))
+	if e.Source != nil {
+		var origin []slog.Attr
+		if e.Source.File != "" {
+			origin = append(origin, slog.String("file.name", e.Source.File))
+		}
+		if e.Source.Line != 0 {
+			origin = append(origin, slog.Int("file.line", e.Source.Line))
+		}
+		if e.Source.Function != "" {
+			origin = append(origin, slog.String("function", e.Source.Function))
+		}
+		b, _ = appendJSONAttr(b, slog.Attr{Key: "log.origin", Value: slog.GroupValue(origin...)})
+	}
+	b = appendJSONKey(b, "message")
+	b = appendJSONString(b, e.Message)
+	b = appendJSONKey(b, "ecs.version")
+	b = appendJSONString(b, ecsVersion)
+	for _, a := range e.Attrs {
+		if a.Key == "error" && a.Value.Kind() != slog.KindGroup {
+			a = slog.Group("error", slog.String("message", errorText(a.Value)))
+		}
+		b, _ = appendJSONAttr(b, a)
+	}
+	return append(b, '}', '\n')
+}
+
+// errorText returns the text of an error attribute's value.
+func errorText(v slog.Value) string {
+	if err, ok := v.Any().(error); ok {
+		return err.Error()
+	}
+	return v.String()
+}
@@ -0,0 +1,362 @@
+package echo
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypted log files are a sequence of frames, each a one byte type, a
+// four byte big-endian payload length and the payload:
+//
+//	'K' key frame:  magic "ECHOENC" | version (1) | keyID length (2) | keyID |
+//	                wrapped key length (2) | wrapped key
+//	'D' data frame: AES-256-GCM ciphertext of one write (one log record)
+//
+// Every segment starts with a key frame carrying a fresh data key wrapped by
+// the configured KeyWrapper; the data frames that follow are sealed with that
+// key, using their position after the key frame as the nonce. A file reopened
+// for appending gets another key frame, after any partial frame left at the
+// end by a crash has been cut off, so everything before and after it stays
+// readable.
+const (
+	frameKey  byte = 'K'
+	frameData byte = 'D'
+
+	encMagic   = "ECHOENC"
+	encVersion = 1
+
+	frameHeaderSize = 5
+	dataKeySize     = 32
+	maxFrameSize    = 16 << 20 // Guards readers against corrupt length fields
+)
+
+// ErrTruncated is returned by readers of framed log files when the input ends
+// in the middle of a frame, typically because the writer crashed. All
+// complete frames before it have been returned.
+var ErrTruncated = errors.New("echo: truncated log file")
+
+// KeyWrapper wraps the per-segment data keys of encrypted log files, for
+// example with a public key or through a key management service. The keyID
+// is stored alongside the wrapped key and handed back to the KeyUnwrapper.
+type KeyWrapper interface {
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+}
+
+// KeyUnwrapper recovers data keys wrapped by a KeyWrapper.
+type KeyUnwrapper interface {
+	UnwrapKey(keyID string, wrapped []byte) (dataKey []byte, err error)
+}
+
+// rsaKeyWrapper wraps data keys with RSA-OAEP (SHA-256).
+type rsaKeyWrapper struct {
+	pub   *rsa.PublicKey
+	keyID string
+}
+
+// NewRSAKeyWrapper returns a KeyWrapper that wraps data keys for pub with
+// RSA-OAEP. Only the holder of the matching private key can read the logs.
+func NewRSAKeyWrapper(pub *rsa.PublicKey) (KeyWrapper, error) {
+	keyID, err := rsaKeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &rsaKeyWrapper{pub: pub, keyID: keyID}, nil
+}
+
+func (w *rsaKeyWrapper) WrapKey(dataKey []byte) (string, []byte, error) {
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, w.pub, dataKey, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("echo: failed to wrap data key: %w", err)
+	}
+	return w.keyID, wrapped, nil
+}
+
+// rsaKeyUnwrapper unwraps data keys wrapped by rsaKeyWrapper.
+type rsaKeyUnwrapper struct {
+	priv  *rsa.PrivateKey
+	keyID string
+}
+
+// NewRSAKeyUnwrapper returns a KeyUnwrapper for logs written with
+// NewRSAKeyWrapper(&priv.PublicKey).
+func NewRSAKeyUnwrapper(priv *rsa.PrivateKey) (KeyUnwrapper, error) {
+	keyID, err := rsaKeyID(&priv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &rsaKeyUnwrapper{priv: priv, keyID: keyID}, nil
+}
+
+func (u *rsaKeyUnwrapper) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	if keyID != u.keyID {
+		return nil, fmt.Errorf("echo: log segment was encrypted for key %s, have %s", keyID, u.keyID)
+	}
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), nil, u.priv, wrapped, nil)
+	if err != nil {
+		return nil, fmt.Errorf("echo: failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// rsaKeyID identifies an RSA key by a short fingerprint of its public half.
+func rsaKeyID(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("echo: invalid RSA public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return "rsa:" + hex.EncodeToString(sum[:8]), nil
+}
+
+// encryptEncoder returns a segmentEncoder that encrypts each segment with a
+// fresh data key wrapped by kw.
+func encryptEncoder(kw KeyWrapper) segmentEncoder {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return newEncryptWriter(w, kw)
+	}
+}
+
+// encryptWriter seals every Write into its own data frame.
+type encryptWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	seq  uint64
+	buf  []byte
+}
+
+// newEncryptWriter generates a data key, writes its key frame to w and
+// returns a writer sealing subsequent writes with it.
+func newEncryptWriter(w io.Writer, kw KeyWrapper) (*encryptWriter, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("echo: failed to generate data key: %w", err)
+	}
+	keyID, wrapped, err := kw.WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyID) > 0xFFFF || len(wrapped) > 0xFFFF {
+		return nil, fmt.Errorf("echo: wrapped data key too large")
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make([]byte, 0, len(encMagic)+5+len(keyID)+len(wrapped))
+	payload = append(payload, encMagic...)
+	payload = append(payload, encVersion)
+	payload = binary.BigEndian.AppendUint16(payload, uint16(len(keyID)))
+	payload = append(payload, keyID...)
+	payload = binary.BigEndian.AppendUint16(payload, uint16(len(wrapped)))
+	payload = append(payload, wrapped...)
+
+	ew := &encryptWriter{w: w, aead: aead}
+	if _, err := w.Write(appendFrame(nil, frameKey, payload)); err != nil {
+		return nil, err
+	}
+	return ew, nil
+}
+
+// Write seals p into a single data frame and writes it with one call to the
+// underlying writer.
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	sealedLen := len(p) + ew.aead.Overhead()
+	ew.buf = append(ew.buf[:0], frameData, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(ew.buf[1:], uint32(sealedLen))
+	ew.buf = ew.aead.Seal(ew.buf, frameNonce(ew.seq), p, nil)
+	ew.seq++
+	if _, err := ew.w.Write(ew.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close ends the segment. Frames are self-contained, so there is nothing to flush.
+func (ew *encryptWriter) Close() error { return nil }
+
+// decryptReader yields the plaintext of an encrypted log stream.
+type decryptReader struct {
+	r       *bufio.Reader
+	ku      KeyUnwrapper
+	aead    cipher.AEAD
+	seq     uint64
+	pending []byte
+	err     error
+}
+
+// NewDecryptReader returns a reader yielding the plaintext of an encrypted
+// log file written with Config.FileEncryptionKey. If the file ends in a
+// partial frame, all complete records are returned followed by ErrTruncated.
+func NewDecryptReader(r io.Reader, ku KeyUnwrapper) io.Reader {
+	return &decryptReader{r: bufio.NewReader(r), ku: ku}
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.pending, d.err = d.nextRecord()
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// nextRecord reads frames until it has decrypted the next data frame.
+func (d *decryptReader) nextRecord() ([]byte, error) {
+	for {
+		typ, payload, err := readFrame(d.r)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case frameKey:
+			if err := d.startSegment(payload); err != nil {
+				return nil, err
+			}
+		case frameData:
+			if d.aead == nil {
+				return nil, fmt.Errorf("echo: data frame before key frame")
+			}
+			plain, err := d.aead.Open(payload[:0], frameNonce(d.seq), payload, nil)
+			if err != nil {
+				return nil, fmt.Errorf("echo: failed to decrypt record %d of segment: %w", d.seq, err)
+			}
+			d.seq++
+			return plain, nil
+		default:
+			return nil, fmt.Errorf("echo: unknown frame type %q", typ)
+		}
+	}
+}
+
+// startSegment parses a key frame and switches to its data key.
+func (d *decryptReader) startSegment(payload []byte) error {
+	if len(payload) < len(encMagic)+1 || string(payload[:len(encMagic)]) != encMagic {
+		return fmt.Errorf("echo: not an encrypted echo log")
+	}
+	payload = payload[len(encMagic):]
+	if payload[0] != encVersion {
+		return fmt.Errorf("echo: unsupported encrypted log version %d", payload[0])
+	}
+	payload = payload[1:]
+	keyID, payload, ok := cutLengthPrefixed(payload)
+	if !ok {
+		return fmt.Errorf("echo: malformed key frame")
+	}
+	wrapped, _, ok := cutLengthPrefixed(payload)
+	if !ok {
+		return fmt.Errorf("echo: malformed key frame")
+	}
+	dataKey, err := d.ku.UnwrapKey(string(keyID), wrapped)
+	if err != nil {
+		return err
+	}
+	if d.aead, err = newAEAD(dataKey); err != nil {
+		return err
+	}
+	d.seq = 0
+	return nil
+}
+
+// readFrame reads one frame. A clean end of input yields io.EOF, a partial
+// frame ErrTruncated.
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var hdr [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, ErrTruncated
+		}
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("echo: frame of %d bytes exceeds limit", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, nil, ErrTruncated
+		}
+		return 0, nil, err
+	}
+	return hdr[0], payload, nil
+}
+
+// trimPartialFrame returns the size the framed file r of the given size
+// should be truncated to so that it does not end in a partial frame. Input
+// that does not parse as frames, such as a plaintext log, is left whole.
+func trimPartialFrame(r io.Reader, size int64) (int64, error) {
+	br := bufio.NewReader(r)
+	var off int64
+	for {
+		var hdr [frameHeaderSize]byte
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			switch err {
+			case io.EOF:
+				return size, nil
+			case io.ErrUnexpectedEOF:
+				return off, nil
+			}
+			return 0, err
+		}
+		n := binary.BigEndian.Uint32(hdr[1:])
+		if (hdr[0] != frameKey && hdr[0] != frameData) || n > maxFrameSize {
+			return size, nil
+		}
+		if d, err := br.Discard(int(n)); err != nil {
+			if err == io.EOF && d < int(n) {
+				return off, nil
+			}
+			return 0, err
+		}
+		off += frameHeaderSize + int64(n)
+	}
+}
+
+// appendFrame appends a frame of the given type to dst.
+func appendFrame(dst []byte, typ byte, payload []byte) []byte {
+	dst = append(dst, typ)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(payload)))
+	return append(dst, payload...)
+}
+
+// cutLengthPrefixed splits a two byte length-prefixed field off b.
+func cutLengthPrefixed(b []byte) (field, rest []byte, ok bool) {
+	if len(b) < 2 {
+		return nil, nil, false
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, false
+	}
+	return b[2 : 2+n], b[2+n:], true
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("echo: invalid data key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// frameNonce derives the GCM nonce of the seq-th data frame of a segment.
+// Data keys are never reused across segments, so a counter is sufficient.
+func frameNonce(seq uint64) []byte {
+	var nonce [12]byte
+	binary.BigEndian.PutUint64(nonce[4:], seq)
+	return nonce[:]
+}
@@ -0,0 +1,153 @@
+package echo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRSAKey generates a key pair once per test; 2048 bits keeps it quick.
+func newTestRSAKey(t *testing.T) (KeyWrapper, KeyUnwrapper) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kw, err := NewRSAKeyWrapper(&priv.PublicKey)
+	require.NoError(t, err)
+	ku, err := NewRSAKeyUnwrapper(priv)
+	require.NoError(t, err)
+	return kw, ku
+}
+
+func TestEncryptedFileRoundTrip(t *testing.T) {
+	kw, ku := newTestRSAKey(t)
+	logPath := filepath.Join(t.TempDir(), "app.log")
+
+	w, err := newFileWriter(logPath, fileWriterOptions{encode: encryptEncoder(kw)})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("first record\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// Reopening appends a second segment with its own key frame.
+	w, err = newFileWriter(logPath, fileWriterOptions{encode: encryptEncoder(kw)})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("second record\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	raw, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "record", "Plaintext should not appear in the file")
+
+	plain, err := io.ReadAll(NewDecryptReader(bytes.NewReader(raw), ku))
+	require.NoError(t, err)
+	assert.Equal(t, "first record\nsecond record\n", string(plain))
+}
+
+func TestEncryptedFileTruncated(t *testing.T) {
+	kw, ku := newTestRSAKey(t)
+	var buf bytes.Buffer
+	ew, err := newEncryptWriter(&buf, kw)
+	require.NoError(t, err)
+	_, err = ew.Write([]byte("complete\n"))
+	require.NoError(t, err)
+	_, err = ew.Write([]byte("cut short by a crash\n"))
+	require.NoError(t, err)
+
+	truncated := buf.Bytes()[:buf.Len()-7]
+	plain, err := io.ReadAll(NewDecryptReader(bytes.NewReader(truncated), ku))
+	assert.True(t, errors.Is(err, ErrTruncated), "Expected ErrTruncated, got %v", err)
+	assert.Equal(t, "complete\n", string(plain), "Complete frames should be readable")
+}
+
+func TestEncryptedFileReopenedAfterCrash(t *testing.T) {
+	kw, ku := newTestRSAKey(t)
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	opts := fileWriterOptions{encode: encryptEncoder(kw), trimTail: trimPartialFrame}
+
+	w, err := newFileWriter(logPath, opts)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("before the crash\n"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("cut short by the crash\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// Cut the last data frame in the middle of its payload.
+	fi, err := os.Stat(logPath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(logPath, fi.Size()-7))
+
+	w, err = newFileWriter(logPath, opts)
+	require.NoError(t, err)
+	for _, rec := range []string{"after the restart\n", "and another\n"} {
+		_, err = w.Write([]byte(rec))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	raw, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	plain, err := io.ReadAll(NewDecryptReader(bytes.NewReader(raw), ku))
+	require.NoError(t, err)
+	assert.Equal(t, "before the crash\nafter the restart\nand another\n", string(plain))
+}
+
+func TestTrimPartialFrame(t *testing.T) {
+	framed := appendFrame(appendFrame(nil, frameKey, []byte("key")), frameData, []byte("data"))
+	tests := []struct {
+		name  string
+		input []byte
+		want  int
+	}{
+		{"complete", framed, len(framed)},
+		{"partial header", framed[:len(framed)-len("data")-2], len(framed) - len("data") - frameHeaderSize},
+		{"partial payload", framed[:len(framed)-1], len(framed) - len("data") - frameHeaderSize},
+		{"plaintext", []byte("not a framed file\n"), len("not a framed file\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := trimPartialFrame(bytes.NewReader(tt.input), int64(len(tt.input)))
+			require.NoError(t, err)
+			assert.Equal(t, int64(tt.want), got)
+		})
+	}
+}
+
+func TestEncryptedFileTampered(t *testing.T) {
+	kw, ku := newTestRSAKey(t)
+	var buf bytes.Buffer
+	ew, err := newEncryptWriter(&buf, kw)
+	require.NoError(t, err)
+	_, err = ew.Write([]byte("do not touch\n"))
+	require.NoError(t, err)
+
+	raw := buf.Bytes()
+	raw[len(raw)-1] ^= 0xFF
+	_, err = io.ReadAll(NewDecryptReader(bytes.NewReader(raw), ku))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to decrypt")
+}
+
+func TestEncryptedFileWrongKey(t *testing.T) {
+	kw, _ := newTestRSAKey(t)
+	_, otherKU := newTestRSAKey(t)
+	var buf bytes.Buffer
+	ew, err := newEncryptWriter(&buf, kw)
+	require.NoError(t, err)
+	_, err = ew.Write([]byte("secret\n"))
+	require.NoError(t, err)
+
+	_, err = io.ReadAll(NewDecryptReader(&buf, otherKU))
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "encrypted for key"), "Unexpected error: %v", err)
+}
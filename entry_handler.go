@@ -0,0 +1,122 @@
+package echo
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"slices"
+)
+
+// EntryHandler is a slog.Handler that turns records into Entries, as a
+// Reader would read them back from a log file, and passes them to a
+// function, e.g. to keep them in memory or in a store. Attributes from
+// WithAttrs and WithGroup are nested in their groups, LogValuers are
+// resolved, and empty attributes and groups are dropped.
+type EntryHandler struct {
+	fn     func(Entry) error
+	opts   slog.HandlerOptions
+	attrs  []slog.Attr // From WithAttrs, nested in their groups
+	groups []string    // From WithGroup
+}
+
+// NewEntryHandler returns an EntryHandler passing entries to fn, which may
+// be called concurrently. Of opts, Level and AddSource are used;
+// ReplaceAttr is not supported.
+func NewEntryHandler(fn func(Entry) error, opts *slog.HandlerOptions) *EntryHandler {
+	h := &EntryHandler{fn: fn}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+// Enabled reports whether level is at least the handler's level, which
+// defaults to Info.
+func (h *EntryHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *EntryHandler) minLevel() int64 { return staticMinLevel(h.opts.Level) }
+
+// Handle converts r to an Entry and passes it on.
+func (h *EntryHandler) Handle(_ context.Context, r slog.Record) error {
+	e := Entry{Time: r.Time, Level: r.Level, Message: r.Message}
+	if h.opts.AddSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		e.Source = &slog.Source{Function: frame.Function, File: frame.File, Line: frame.Line}
+	}
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	e.Attrs = addInGroups(h.attrs, h.groups, resolveAttrs(attrs))
+	return h.fn(e)
+}
+
+// WithAttrs returns an EntryHandler adding attrs to every record, inside the
+// current groups.
+func (h *EntryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = addInGroups(h.attrs, h.groups, resolveAttrs(attrs))
+	return &h2
+}
+
+// WithGroup returns an EntryHandler nesting later attributes in the group name.
+func (h *EntryHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+// addInGroups returns attrs with add appended inside the groups path. The
+// group being added to, if it exists, is the last attribute at each level,
+// as groups only get deeper. attrs is not modified.
+func addInGroups(attrs []slog.Attr, groups []string, add []slog.Attr) []slog.Attr {
+	if len(add) == 0 {
+		return attrs
+	}
+	if len(groups) == 0 {
+		return append(slices.Clip(attrs), add...)
+	}
+	if n := len(attrs); n > 0 && attrs[n-1].Key == groups[0] && attrs[n-1].Value.Kind() == slog.KindGroup {
+		inner := addInGroups(attrs[n-1].Value.Group(), groups[1:], add)
+		attrs = slices.Clone(attrs)
+		attrs[n-1] = slog.Attr{Key: groups[0], Value: slog.GroupValue(inner...)}
+		return attrs
+	}
+	return append(slices.Clip(attrs), slog.Attr{Key: groups[0], Value: slog.GroupValue(addInGroups(nil, groups[1:], add)...)})
+}
+
+// resolveAttrs resolves LogValuers and applies slog's rules for empty
+// attributes: they are dropped, as are empty groups, and groups without a
+// key are inlined.
+func resolveAttrs(attrs []slog.Attr) []slog.Attr {
+	out := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Equal(slog.Attr{}) {
+			continue
+		}
+		if a.Value.Kind() == slog.KindGroup {
+			inner := resolveAttrs(a.Value.Group())
+			if len(inner) == 0 {
+				continue
+			}
+			if a.Key == "" {
+				out = append(out, inner...)
+				continue
+			}
+			a.Value = slog.GroupValue(inner...)
+		}
+		out = append(out, a)
+	}
+	return out
+}
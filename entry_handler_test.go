@@ -0,0 +1,40 @@
+package echo
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tokenValuer string
+
+func (t tokenValuer) LogValue() slog.Value { return slog.StringValue("***") }
+
+func TestEntryHandlerGroups(t *testing.T) {
+	var got []Entry
+	h := NewEntryHandler(func(e Entry) error {
+		got = append(got, e)
+		return nil
+	}, &slog.HandlerOptions{Level: LevelDebug})
+
+	logger := slog.New(h).With("svc", "api").WithGroup("req").With("id", "r1")
+	logger.Debug("one", "token", tokenValuer("secret"), slog.Group("empty"), slog.Group("", slog.Int("inlined", 1)))
+	logger.WithGroup("db").Info("two", "rows", 3)
+	logger.WithGroup("unused").Info("three")
+
+	require.Len(t, got, 3)
+	assert.Equal(t, []slog.Attr{
+		slog.String("svc", "api"),
+		slog.Group("req", slog.String("id", "r1"), slog.String("token", "***"), slog.Int("inlined", 1)),
+	}, got[0].Attrs)
+	assert.Equal(t, []slog.Attr{
+		slog.String("svc", "api"),
+		slog.Group("req", slog.String("id", "r1"), slog.Group("db", slog.Int("rows", 3))),
+	}, got[1].Attrs)
+	assert.Equal(t, []slog.Attr{slog.String("svc", "api"), slog.Group("req", slog.String("id", "r1"))}, got[2].Attrs,
+		"Empty groups are dropped")
+	assert.Equal(t, LevelDebug, got[0].Level)
+	assert.Nil(t, got[0].Source, "AddSource is off")
+}
@@ -0,0 +1,395 @@
+package echo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default permissions for log files and the directories created for them.
+const (
+	defaultFileMode os.FileMode = 0640
+	defaultDirMode  os.FileMode = 0750
+)
+
+// defaultMaxRecordSize caps a single record written in FileShared mode when
+// Config.FileMaxRecordSize is not set.
+const defaultMaxRecordSize = 64 << 10
+
+// rotationTimeFormat is used for the timestamp inserted into rotated file names.
+// It sorts lexically in chronological order.
+const rotationTimeFormat = "20060102T150405.000000000"
+
+// segmentEncoder wraps the raw writer of a newly opened file segment, for
+// example to encrypt it. Closing the returned writer finalises the segment
+// without closing the underlying file.
+type segmentEncoder func(w io.Writer) (io.WriteCloser, error)
+
+// tailTrimmer returns the size a reopened file of the given size, read
+// through r, should be truncated to before a new segment is appended, for
+// example to drop a partial frame left by a crash.
+type tailTrimmer func(r io.Reader, size int64) (int64, error)
+
+// tailChecker reports whether a reopened, non-empty file read through r can
+// be appended to. A file that cannot is rotated away and a new one started,
+// for example when a crash left a compressed stream unfinished.
+type tailChecker func(r io.Reader) bool
+
+// fileWriterOptions configures a fileWriter. The zero value appends to a
+// single, never rotated file.
+type fileWriterOptions struct {
+	maxSize    int64          // Rotate before exceeding this size; zero disables rotation
+	shared     bool           // Coordinate with other processes via a sidecar lock file
+	maxRecord  int            // Cap for a single record in shared mode
+	encode     segmentEncoder // Optional per-segment encoding; not used in shared mode
+	trimTail   tailTrimmer    // Optional repair of a reopened file before encode
+	appendable tailChecker    // Optional check of a reopened file before encode
+	perm       os.FileMode    // Mode for files the writer creates; defaults to defaultFileMode
+	chgrp      bool           // Change the group of created files to gid
+	gid        int
+	flushEvery time.Duration // Flush buffering encoders this often; zero disables
+}
+
+// fileWriter owns the log file opened by Init. It serialises writes, rotates
+// the file by size and, in shared mode, coordinates with other processes
+// appending to the same path through an advisory lock on a sidecar file.
+// Kept unexported; Init hands it out only as a FileCloser.
+type fileWriter struct {
+	mu       sync.Mutex
+	path     string
+	opts     fileWriterOptions
+	file     *os.File
+	out      io.Writer      // Where records go: file, or enc wrapping it
+	enc      io.WriteCloser // Active segment encoder, if any
+	size     int64          // Bytes in the current file, as far as this process knows
+	dirty    bool           // Written to enc since its last flush
+	lockFile *os.File
+	done     chan struct{} // Closed by Close to stop the flush loop
+	closed   bool          // Set by Close; file is also nil after a failed reopen
+}
+
+// newFileWriter opens (or creates) path for appending. In shared mode it also
+// opens the sidecar lock file "<path>.lock".
+func newFileWriter(path string, opts fileWriterOptions) (*fileWriter, error) {
+	w := &fileWriter{
+		path: path,
+		opts: opts,
+	}
+	if w.opts.perm == 0 {
+		w.opts.perm = defaultFileMode
+	}
+	if w.opts.shared {
+		if w.opts.maxRecord <= 0 {
+			w.opts.maxRecord = defaultMaxRecordSize
+		}
+		lf, err := w.openFile(path+".lock", os.O_CREATE|os.O_RDWR)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lock file '%s.lock': %w", path, err)
+		}
+		w.lockFile = lf
+	}
+	if err := w.open(); err != nil {
+		if w.lockFile != nil {
+			_ = w.lockFile.Close()
+		}
+		return nil, err
+	}
+	if _, ok := w.enc.(flusher); ok && w.opts.flushEvery > 0 {
+		w.done = make(chan struct{})
+		go w.flushLoop()
+	}
+	return w, nil
+}
+
+// flushLoop periodically flushes a buffering encoder so that readers of the
+// active file see recent records without waiting for the segment to end.
+func (w *fileWriter) flushLoop() {
+	ticker := time.NewTicker(w.opts.flushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			// Flushing an idle encoder would still write an empty block.
+			w.mu.Lock()
+			if f, ok := w.enc.(flusher); ok && w.dirty {
+				_ = f.Flush()
+				w.dirty = false
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// open opens w.path for appending, records its current size and starts a new
+// encoded segment if an encoder is configured.
+func (w *fileWriter) open() error {
+	flag := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+	if w.opts.trimTail != nil || w.opts.appendable != nil {
+		flag = os.O_APPEND | os.O_CREATE | os.O_RDWR
+	}
+	f, err := w.openFile(w.path, flag)
+	if err != nil {
+		return fmt.Errorf("failed to open log file '%s': %w", w.path, err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat log file '%s': %w", w.path, err)
+	}
+	size := fi.Size()
+	if w.opts.trimTail != nil && size > 0 {
+		keep, err := w.opts.trimTail(io.NewSectionReader(f, 0, size), size)
+		if err == nil && keep < size {
+			err = f.Truncate(keep)
+			size = keep
+		}
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("failed to repair log file '%s': %w", w.path, err)
+		}
+	}
+	if w.opts.appendable != nil && size > 0 && !w.opts.appendable(io.NewSectionReader(f, 0, size)) {
+		// Keep what the file holds as a rotated segment; anything appended
+		// to it would be unreadable.
+		_ = f.Close()
+		if err := os.Rename(w.path, rotatedName(w.path, time.Now())); err != nil {
+			return fmt.Errorf("failed to rotate unfinished log file '%s': %w", w.path, err)
+		}
+		return w.open()
+	}
+	w.file = f
+	w.size = size
+	w.out = &countingWriter{w: f, n: &w.size}
+	if w.opts.encode != nil {
+		enc, err := w.opts.encode(w.out)
+		if err != nil {
+			_ = f.Close()
+			w.file = nil
+			return fmt.Errorf("failed to start log segment '%s': %w", w.path, err)
+		}
+		w.enc = enc
+		w.out = enc
+	}
+	return nil
+}
+
+// openFile opens name with the given flags. A file created by the call gets
+// exactly the configured mode, regardless of umask, and the configured group.
+func (w *fileWriter) openFile(name string, flag int) (*os.File, error) {
+	_, statErr := os.Stat(name)
+	created := errors.Is(statErr, os.ErrNotExist)
+	f, err := os.OpenFile(name, flag, w.opts.perm)
+	if err != nil || !created {
+		return f, err
+	}
+	if err := f.Chmod(w.opts.perm); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if w.opts.chgrp {
+		if err := f.Chown(-1, w.opts.gid); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// closeFile finalises the active segment encoder, if any, and closes the file.
+func (w *fileWriter) closeFile() error {
+	var err error
+	if w.enc != nil {
+		err = w.enc.Close()
+		w.enc = nil
+	}
+	if cerr := w.file.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	w.file = nil
+	w.out = nil
+	return err
+}
+
+// Write writes p to the log file as a single write call. slog handlers call
+// Write once per record, so each record lands in the file in one piece.
+func (w *fileWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.opts.shared {
+		return w.writeShared(p)
+	}
+	if w.needsRotation(w.size, len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	w.dirty = true
+	return w.out.Write(p)
+}
+
+// writeShared appends p while holding the sidecar lock. Writers take a shared
+// lock, so appends from several processes proceed concurrently and rely on
+// O_APPEND for atomicity; rotation takes the lock exclusively so that no
+// process is mid-write when the file is renamed.
+func (w *fileWriter) writeShared(p []byte) (int, error) {
+	n := len(p)
+	p = capRecord(p, w.opts.maxRecord)
+
+	if err := flock(w.lockFile, lockShared); err != nil {
+		return 0, fmt.Errorf("echo: failed to lock '%s.lock': %w", w.path, err)
+	}
+	size, err := w.syncWithPath()
+	if err == nil && w.needsRotation(size, len(p)) {
+		// Upgrade to an exclusive lock. flock upgrades are not atomic, so the
+		// file is re-checked once the exclusive lock is held: another process
+		// may have rotated it in between.
+		if err = flock(w.lockFile, lockExclusive); err == nil {
+			if size, err = w.syncWithPath(); err == nil && w.needsRotation(size, len(p)) {
+				err = w.rotate()
+			}
+		}
+	}
+	if err == nil {
+		_, err = w.file.Write(p)
+	}
+	if uerr := flock(w.lockFile, lockUnlock); uerr != nil && err == nil {
+		err = fmt.Errorf("echo: failed to unlock '%s.lock': %w", w.path, uerr)
+	}
+	if err != nil {
+		return 0, err
+	}
+	// Report the caller's full length even if the record was capped, so
+	// handlers don't treat truncation as a short write.
+	return n, nil
+}
+
+// syncWithPath reopens the log file if another process has rotated it away
+// from w.path and returns the size of the file now at w.path.
+func (w *fileWriter) syncWithPath() (int64, error) {
+	cur, err := w.file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("echo: failed to stat log file '%s': %w", w.path, err)
+	}
+	onDisk, err := os.Stat(w.path)
+	if err == nil && os.SameFile(cur, onDisk) {
+		return cur.Size(), nil
+	}
+	_ = w.closeFile()
+	if err := w.open(); err != nil {
+		return 0, fmt.Errorf("echo: %w", err)
+	}
+	return w.size, nil
+}
+
+// needsRotation reports whether writing n more bytes to a file of the given
+// size would exceed maxSize. An empty file is never rotated, so records larger
+// than maxSize still get written.
+func (w *fileWriter) needsRotation(size int64, n int) bool {
+	return w.opts.maxSize > 0 && size > 0 && size+int64(n) > w.opts.maxSize
+}
+
+// rotate renames the current file to a timestamped name and opens a new one.
+func (w *fileWriter) rotate() error {
+	if err := w.closeFile(); err != nil {
+		return fmt.Errorf("echo: failed to close log file '%s' for rotation: %w", w.path, err)
+	}
+	if err := os.Rename(w.path, rotatedName(w.path, time.Now())); err != nil {
+		// Keep logging to the existing file rather than losing records.
+		if oerr := w.open(); oerr != nil {
+			return fmt.Errorf("echo: %w", oerr)
+		}
+		return fmt.Errorf("echo: failed to rotate log file '%s': %w", w.path, err)
+	}
+	if err := w.open(); err != nil {
+		return fmt.Errorf("echo: %w", err)
+	}
+	return nil
+}
+
+// Close closes the log file and, in shared mode, the lock file. The flush
+// loop and lock file are released even if a failed rotation left no file
+// open.
+func (w *fileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+	if w.done != nil {
+		close(w.done)
+	}
+	var err error
+	if w.file != nil {
+		err = w.closeFile()
+	}
+	if w.lockFile != nil {
+		if lerr := w.lockFile.Close(); lerr != nil && err == nil {
+			err = lerr
+		}
+		w.lockFile = nil
+	}
+	return err
+}
+
+// countingWriter adds the number of bytes written through it to *n.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// capRecord truncates p to at most max bytes, keeping a trailing newline so
+// the next record still starts on its own line.
+func capRecord(p []byte, max int) []byte {
+	if len(p) <= max {
+		return p
+	}
+	capped := make([]byte, max)
+	copy(capped, p[:max-1])
+	capped[max-1] = '\n'
+	return capped
+}
+
+// rotatedName returns the name a log file is renamed to on rotation: the
+// timestamp is inserted before the extension, so "app.log" becomes
+// "app-20060102T150405.000000000.log" and "app.log.gz" becomes
+// "app-20060102T150405.000000000.log.gz".
+func rotatedName(path string, t time.Time) string {
+	dir, base := filepath.Split(path)
+	stem, ext := splitLogExt(base)
+	return filepath.Join(dir, stem+"-"+t.UTC().Format(rotationTimeFormat)+ext)
+}
+
+// splitLogExt splits a log file name into its stem and extension. A
+// compression extension is kept together with the one before it.
+func splitLogExt(base string) (stem, ext string) {
+	var comp string
+	for _, e := range compressionExt {
+		if strings.HasSuffix(base, e) && len(base) > len(e) {
+			base, comp = strings.TrimSuffix(base, e), e
+			break
+		}
+	}
+	ext = filepath.Ext(base)
+	if ext == base {
+		// Dotfiles such as ".log" have no stem to speak of.
+		return base, comp
+	}
+	return strings.TrimSuffix(base, ext), ext + comp
+}
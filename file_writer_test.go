@@ -0,0 +1,238 @@
+package echo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAllSegments returns the lines of every file in dir except lock files.
+func readAllSegments(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var lines []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".lock") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		require.NoError(t, err)
+		for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+func TestFileWriterRotation(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+
+	w, err := newFileWriter(logPath, fileWriterOptions{maxSize: 100})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+
+	record := []byte(strings.Repeat("x", 39) + "\n") // 40 bytes
+	for i := 0; i < 5; i++ {
+		n, err := w.Write(record)
+		require.NoError(t, err)
+		assert.Equal(t, len(record), n)
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "Expected active file plus two rotated segments")
+	for _, e := range entries {
+		fi, err := e.Info()
+		require.NoError(t, err)
+		assert.LessOrEqual(t, fi.Size(), int64(100), "Segment %s exceeds FileMaxSize", e.Name())
+	}
+	assert.Len(t, readAllSegments(t, dir), 5, "No record should be lost across rotations")
+}
+
+func TestFileWriterOversizedRecordNotRotatedAway(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	w, err := newFileWriter(logPath, fileWriterOptions{maxSize: 10})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+
+	_, err = w.Write([]byte("a record longer than the limit\n"))
+	require.NoError(t, err)
+	content, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, "a record longer than the limit\n", string(content), "Empty file should accept an oversized record")
+}
+
+func TestFileWriterSharedCapsRecords(t *testing.T) {
+	if !flockSupported {
+		t.Skip("Skipping shared file test: flock not supported")
+	}
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	w, err := newFileWriter(logPath, fileWriterOptions{shared: true, maxRecord: 16})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+
+	long := []byte(strings.Repeat("y", 40) + "\n")
+	n, err := w.Write(long)
+	require.NoError(t, err)
+	assert.Equal(t, len(long), n, "Capped writes should report the full length")
+
+	content, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("y", 15)+"\n", string(content))
+	assert.FileExists(t, logPath+".lock")
+}
+
+func TestFileWriterSharedConcurrentRotation(t *testing.T) {
+	if !flockSupported {
+		t.Skip("Skipping shared file test: flock not supported")
+	}
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+
+	// Separate fileWriters hold separate open file descriptions, so their
+	// flocks contend exactly as they would across processes.
+	const writers, perWriter = 4, 200
+	ws := make([]*fileWriter, writers)
+	for i := range ws {
+		w, err := newFileWriter(logPath, fileWriterOptions{maxSize: 2048, shared: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = w.Close() })
+		ws[i] = w
+	}
+
+	var wg sync.WaitGroup
+	for i, w := range ws {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				line := fmt.Sprintf("writer=%d seq=%04d %s\n", i, j, strings.Repeat("z", 20))
+				_, err := w.Write([]byte(line))
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := readAllSegments(t, dir)
+	require.Len(t, lines, writers*perWriter, "Every record should be present exactly once")
+	for _, line := range lines {
+		assert.Regexp(t, `^writer=\d seq=\d{4} z{20}$`, line, "Record interleaved or torn")
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Greater(t, len(entries), 2, "Expected rotation to have happened")
+}
+
+func TestRotatedName(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 45, 123456789, time.UTC)
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/var/log/app.log", "/var/log/app-20240301T123045.123456789.log"},
+		{"/var/log/app.log.gz", "/var/log/app-20240301T123045.123456789.log.gz"},
+		{"app.zst", "app-20240301T123045.123456789.zst"},
+		{"app", "app-20240301T123045.123456789"},
+		{"/tmp/.log", "/tmp/.log-20240301T123045.123456789"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, filepath.FromSlash(tt.expected), rotatedName(tt.path, ts))
+		})
+	}
+}
+
+func TestCapRecord(t *testing.T) {
+	assert.Equal(t, []byte("short\n"), capRecord([]byte("short\n"), 16))
+	capped := capRecord([]byte("0123456789\n"), 5)
+	assert.True(t, bytes.Equal([]byte("0123\n"), capped))
+}
+
+func TestFileWriterMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping permission test on Windows")
+	}
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	w, err := newFileWriter(logPath, fileWriterOptions{perm: 0604, maxSize: 10})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+
+	fi, err := os.Stat(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0604), fi.Mode().Perm(), "Mode should be applied regardless of umask")
+
+	// Files created by rotation get the same mode.
+	_, err = w.Write([]byte("0123456789\n"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("0123456789\n"))
+	require.NoError(t, err)
+	fi, err = os.Stat(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0604), fi.Mode().Perm())
+}
+
+// failingSegments is a buffering segmentEncoder whose segments after the
+// first fail to start, so a rotation cannot reopen the file.
+type failingSegments struct{ started int }
+
+func (f *failingSegments) encode(w io.Writer) (io.WriteCloser, error) {
+	if f.started++; f.started > 1 {
+		return nil, errors.New("segment refused")
+	}
+	return &flushingSegment{w: w}, nil
+}
+
+type flushingSegment struct{ w io.Writer }
+
+func (s *flushingSegment) Write(p []byte) (int, error) { return s.w.Write(p) }
+func (s *flushingSegment) Flush() error                { return nil }
+func (s *flushingSegment) Close() error                { return nil }
+
+func TestFileWriterCloseAfterFailedRotation(t *testing.T) {
+	if !flockSupported {
+		t.Skip("Skipping shared file test: flock not supported")
+	}
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	segs := &failingSegments{}
+	w, err := newFileWriter(logPath, fileWriterOptions{
+		maxSize:    10,
+		shared:     true,
+		encode:     segs.encode,
+		flushEvery: time.Hour,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, w.done, "Expected a flush loop")
+
+	_, err = w.Write([]byte("0123456789\n"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("0123456789\n"))
+	require.ErrorContains(t, err, "segment refused")
+	_, err = w.Write([]byte("0123456789\n"))
+	assert.ErrorIs(t, err, os.ErrClosed, "No file should be open after the failed rotation")
+
+	require.NoError(t, w.Close())
+	select {
+	case <-w.done:
+	default:
+		t.Error("Close should stop the flush loop")
+	}
+	assert.Nil(t, w.lockFile, "Close should release the lock file")
+	assert.ErrorIs(t, w.Close(), os.ErrClosed)
+}
@@ -0,0 +1,74 @@
+package echo
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// NewFormatHandler returns a handler writing records to w in one of echo's
+// output formats, as Init does for log files: "json", "text", "logfmt" (the
+// same as "text", which slog writes as logfmt) or "cbor". It also writes two
+// formats for other backends, which Init and Reader do not use: "ecs", JSON
+// lines in the Elastic Common Schema, and "otlp", the OpenTelemetry OTLP
+// JSON encoding with one request per line. The "cbor", "ecs" and "otlp"
+// formats do not support ReplaceAttr: a non-nil opts.ReplaceAttr is an error.
+//
+// Together with Reader and Entry.Record it converts logs between formats:
+//
+//	h, _ := echo.NewFormatHandler("cbor", out, nil)
+//	for e, err := rd.Next(); err == nil; e, err = rd.Next() {
+//		h.Handle(ctx, e.Record())
+//	}
+func NewFormatHandler(format string, w io.Writer, opts *slog.HandlerOptions) (slog.Handler, error) {
+	switch format {
+	case "cbor", "ecs", "otlp":
+		if opts != nil && opts.ReplaceAttr != nil {
+			return nil, fmt.Errorf("echo: format %q does not support ReplaceAttr", format)
+		}
+	}
+	switch format {
+	case "json":
+		return newJSONHandler(w, opts), nil
+	case "text", "logfmt":
+		return slog.NewTextHandler(w, opts), nil
+	case "cbor":
+		return newCBORHandler(w, opts), nil
+	case "ecs":
+		return newECSHandler(w, opts), nil
+	case "otlp":
+		return newOTLPHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("echo: unknown format %q", format)
+}
+
+// newEntryWriter returns an EntryHandler writing each record to w as a
+// single line encoded from its Entry by appendEntry.
+func newEntryWriter(w io.Writer, appendEntry func([]byte, Entry) []byte, opts *slog.HandlerOptions) slog.Handler {
+	var mu sync.Mutex
+	return NewEntryHandler(func(e Entry) error {
+		bp := jsonBufPool.Get().(*[]byte)
+		buf := appendEntry((*bp)[:0], e)
+		mu.Lock()
+		_, err := w.Write(buf)
+		mu.Unlock()
+		if cap(buf) <= maxPooledBuffer {
+			*bp = buf
+			jsonBufPool.Put(bp)
+		}
+		return err
+	}, opts)
+}
+
+// canonicalFormat returns the name NewFormatHandler knows format by, with
+// aliases resolved, or "" if it is unknown.
+func canonicalFormat(format string) string {
+	switch format {
+	case "json", "cbor":
+		return format
+	case "text", "logfmt":
+		return "text"
+	}
+	return ""
+}
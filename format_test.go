@@ -0,0 +1,151 @@
+package echo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFormatHandlerUnknown(t *testing.T) {
+	_, err := NewFormatHandler("xml", &bytes.Buffer{}, nil)
+	assert.Error(t, err)
+}
+
+func TestNewFormatHandlerReplaceAttr(t *testing.T) {
+	opts := &slog.HandlerOptions{ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr { return a }}
+	for _, format := range []string{"cbor", "ecs", "otlp"} {
+		_, err := NewFormatHandler(format, &bytes.Buffer{}, opts)
+		assert.ErrorContains(t, err, "ReplaceAttr", format)
+	}
+}
+
+// formatSample logs a record through the handler for format and decodes the
+// JSON line it writes.
+func formatSample(t *testing.T, format string) map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	h, err := NewFormatHandler(format, &buf, &slog.HandlerOptions{AddSource: true})
+	require.NoError(t, err)
+	logger := slog.New(h).With("service", "api").WithGroup("http")
+	logger.Warn("request failed", "status", 503, "took", 1500*time.Millisecond, ErrAttr(errors.New("timeout")))
+	require.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("\n")), "One line per record")
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	return got
+}
+
+func TestFormatECS(t *testing.T) {
+	got := formatSample(t, "ecs")
+	assert.Equal(t, "warn", got["log.level"])
+	assert.Equal(t, "request failed", got["message"])
+	assert.Equal(t, ecsVersion, got["ecs.version"])
+	assert.Equal(t, "api", got["service"])
+	ts, err := time.Parse(time.RFC3339Nano, got["@timestamp"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, ts.Location())
+	origin := got["log.origin"].(map[string]any)
+	assert.True(t, strings.HasSuffix(origin["file.name"].(string), "format_test.go"))
+	assert.Positive(t, origin["file.line"])
+	assert.Equal(t, map[string]any{
+		"status": float64(503),
+		"took":   float64(1500 * time.Millisecond),
+		"error":  "timeout", // Only top-level errors are ECS's
+	}, got["http"])
+
+	var buf bytes.Buffer
+	h, err := NewFormatHandler("ecs", &buf, nil)
+	require.NoError(t, err)
+	slog.New(h).Error("failed", ErrAttr(errors.New("boom")))
+	assert.Contains(t, buf.String(), `"error":{"message":"boom"}`)
+}
+
+func TestFormatOTLP(t *testing.T) {
+	got := formatSample(t, "otlp")
+	resourceLogs := got["resourceLogs"].([]any)
+	require.Len(t, resourceLogs, 1)
+	scopeLogs := resourceLogs[0].(map[string]any)["scopeLogs"].([]any)
+	require.Len(t, scopeLogs, 1)
+	assert.Equal(t, map[string]any{"name": "echo"}, scopeLogs[0].(map[string]any)["scope"])
+	records := scopeLogs[0].(map[string]any)["logRecords"].([]any)
+	require.Len(t, records, 1)
+	rec := records[0].(map[string]any)
+
+	assert.Equal(t, float64(13), rec["severityNumber"])
+	assert.Equal(t, "WARN", rec["severityText"])
+	assert.Equal(t, map[string]any{"stringValue": "request failed"}, rec["body"])
+	ns, err := strconv.ParseInt(rec["timeUnixNano"].(string), 10, 64)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), time.Unix(0, ns), time.Minute)
+
+	attrs := map[string]any{}
+	for _, kv := range rec["attributes"].([]any) {
+		kv := kv.(map[string]any)
+		attrs[kv["key"].(string)] = kv["value"]
+	}
+	assert.True(t, strings.HasSuffix(attrs["code.file.path"].(map[string]any)["stringValue"].(string), "format_test.go"))
+	assert.Contains(t, attrs, "code.line.number")
+	assert.Equal(t, map[string]any{"stringValue": "api"}, attrs["service"])
+	assert.Equal(t, map[string]any{"kvlistValue": map[string]any{"values": []any{
+		map[string]any{"key": "status", "value": map[string]any{"intValue": "503"}},
+		map[string]any{"key": "took", "value": map[string]any{"intValue": "1500000000"}},
+		map[string]any{"key": "error", "value": map[string]any{"stringValue": "timeout"}},
+	}}}, attrs["http"])
+}
+
+func TestOTLPSeverity(t *testing.T) {
+	assert.Equal(t, 5, otlpSeverity(slog.LevelDebug))
+	assert.Equal(t, 9, otlpSeverity(slog.LevelInfo))
+	assert.Equal(t, 17, otlpSeverity(slog.LevelError))
+	assert.Equal(t, 1, otlpSeverity(slog.LevelDebug-10))
+	assert.Equal(t, 24, otlpSeverity(slog.LevelError+20))
+}
+
+// TestConvertRoundTrip converts JSON logs to each format and reads them
+// back, as echo-convert does.
+func TestConvertRoundTrip(t *testing.T) {
+	var src bytes.Buffer
+	logSample(slog.NewJSONHandler(&src, &slog.HandlerOptions{AddSource: true}))
+	rd, err := NewReader(bytes.NewReader(src.Bytes()), nil)
+	require.NoError(t, err)
+	want := readAllEntries(t, rd)
+	require.Len(t, want, 2)
+
+	for _, format := range []string{"json", "text", "logfmt", "cbor"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			h, err := NewFormatHandler(format, &buf, nil)
+			require.NoError(t, err)
+			for _, e := range want {
+				require.NoError(t, h.Handle(context.Background(), e.Record()))
+			}
+
+			rd, err := NewReader(&buf, nil)
+			require.NoError(t, err)
+			got := readAllEntries(t, rd)
+			require.Len(t, got, len(want))
+			for i := range want {
+				assert.WithinDuration(t, want[i].Time, got[i].Time, time.Millisecond)
+				assert.Equal(t, want[i].Level, got[i].Level)
+				assert.Equal(t, want[i].Message, got[i].Message)
+				require.NotNil(t, got[i].Source, "The source should survive conversion")
+				assert.Equal(t, want[i].Source.File, got[i].Source.File)
+				assert.Equal(t, want[i].Source.Line, got[i].Source.Line)
+				for _, path := range []string{"service", "http.status", "took", "remaining", "ok", "note"} {
+					wv, wok := want[i].Lookup(path)
+					gv, gok := got[i].Lookup(path)
+					assert.Equal(t, wok, gok, path)
+					assert.Equal(t, wv.String(), gv.String(), path)
+				}
+			}
+		})
+	}
+}
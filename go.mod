@@ -2,9 +2,13 @@ module github.com/altitude-analytics/echo
 
 go 1.23.4
 
+require (
+	github.com/klauspost/compress v1.17.11
+	github.com/stretchr/testify v1.10.0
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.10.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
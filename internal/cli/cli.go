@@ -0,0 +1,160 @@
+// Package cli holds helpers shared by the echo command-line tools: argument
+// expansion, reading entries from files or stdin, and flag value parsing.
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+)
+
+// Stdin is the argument naming standard input.
+const Stdin = "-"
+
+// ErrStop may be returned by a ReadEntries callback to end reading early
+// without an error.
+var ErrStop = errors.New("stop")
+
+// ExpandArgs expands glob patterns in args. Each pattern's matches are
+// sorted, which puts rotated segments ("app-<timestamp>.log") before the
+// active file ("app.log"). No arguments means stdin.
+func ExpandArgs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return []string{Stdin}, nil
+	}
+	var paths []string
+	seen := map[string]bool{}
+	for _, arg := range args {
+		matches := []string{arg}
+		if arg != Stdin && strings.ContainsAny(arg, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(arg); err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %q", arg)
+			}
+			sort.Strings(matches)
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				paths = append(paths, m)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// Open returns a reader for path, or for stdin if path is Stdin.
+func Open(path string, opts *echo.ReaderOptions) (*echo.Reader, error) {
+	if path == Stdin {
+		return echo.NewReader(os.Stdin, opts)
+	}
+	return echo.OpenFile(path, opts)
+}
+
+// ReadEntries calls fn for every entry in paths, in order. Unparseable lines
+// are reported to warn and skipped. Reading stops at the first error from
+// fn; ErrStop ends it without error.
+func ReadEntries(paths []string, opts *echo.ReaderOptions, warn io.Writer, fn func(path string, e echo.Entry) error) error {
+	for _, path := range paths {
+		rd, err := Open(path, opts)
+		if err != nil {
+			return err
+		}
+		err = Drain(rd, warn, func(e echo.Entry) error { return fn(path, e) })
+		rd.Close()
+		if errors.Is(err, ErrStop) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drain calls fn for every entry of rd until io.EOF. Parse errors are
+// reported to warn and skipped.
+func Drain(rd *echo.Reader, warn io.Writer, fn func(echo.Entry) error) error {
+	for {
+		e, err := rd.Next()
+		var perr *echo.ParseError
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case errors.As(err, &perr):
+			fmt.Fprintf(warn, "warning: %v\n", perr)
+			continue
+		case err != nil:
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// ParseLevel parses a level name such as "warn" or "INFO+2".
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid level %q", s)
+	}
+	return l, nil
+}
+
+// ParseTime parses an absolute RFC 3339 time, a date (2006-01-02), or a
+// duration meaning that long before now.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: want RFC 3339, YYYY-MM-DD or a duration", s)
+}
+
+// SplitList splits a comma-separated flag value, dropping empty items.
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseColor interprets a -color flag value for output to f: "always",
+// "never", or "auto", which colours terminals unless NO_COLOR is set.
+func ParseColor(s string, f *os.File) (bool, error) {
+	switch s {
+	case "auto":
+		return IsTerminal(f) && os.Getenv("NO_COLOR") == "", nil
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid -color %q: want auto, always or never", s)
+}
+
+// IsTerminal reports whether f is a character device, such as a terminal.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandArgs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app.log", "app-20240101T000000.000000000.log", "other.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+
+	paths, err := ExpandArgs([]string{filepath.Join(dir, "app*.log"), filepath.Join(dir, "app.log")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "app-20240101T000000.000000000.log"),
+		filepath.Join(dir, "app.log"),
+	}, paths, "Rotated segments should sort first and duplicates be dropped")
+
+	paths, err = ExpandArgs(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{Stdin}, paths)
+
+	_, err = ExpandArgs([]string{filepath.Join(dir, "*.json")})
+	assert.Error(t, err, "A glob without matches should be an error")
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	got, err := ParseTime("90m", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-90*time.Minute), got)
+
+	got, err = ParseTime("2024-05-31T10:00:00Z", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 31, 10, 0, 0, 0, time.UTC), got)
+
+	got, err = ParseTime("2024-05-31", now)
+	require.NoError(t, err)
+	assert.Equal(t, 31, got.Day())
+
+	_, err = ParseTime("yesterday", now)
+	assert.Error(t, err)
+}
+
+func TestParseLevel(t *testing.T) {
+	l, err := ParseLevel("warn")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, l)
+	_, err = ParseLevel("loud")
+	assert.Error(t, err)
+}
+
+func TestPrinter(t *testing.T) {
+	e := echo.Entry{
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC),
+		Level:   slog.LevelWarn,
+		Message: "slow request",
+		Source:  &slog.Source{File: "main.go", Line: 7},
+		Attrs: []slog.Attr{
+			slog.Group("http", slog.Int("status", 504), slog.String("route", "/a b")),
+			slog.Bool("retry", true),
+		},
+	}
+	var buf bytes.Buffer
+	p := &Printer{W: &buf}
+	require.NoError(t, p.Print(e))
+	assert.Equal(t, `2024-01-02T03:04:05.600Z WARN  slow request http.status=504 http.route="/a b" retry=true main.go:7`+"\n", buf.String())
+
+	buf.Reset()
+	p.Fields = []string{"http.status", "missing"}
+	require.NoError(t, p.Print(e))
+	assert.Equal(t, `2024-01-02T03:04:05.600Z WARN  slow request http.status=504 main.go:7`+"\n", buf.String())
+
+	buf.Reset()
+	p.Color = true
+	require.NoError(t, p.Print(e))
+	assert.Contains(t, buf.String(), ansiYellow+"WARN "+ansiReset)
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/altitude-analytics/echo"
+)
+
+// LoadKeyUnwrapper reads a PEM-encoded RSA private key (PKCS#1 or PKCS#8)
+// for decrypting files written with Config.FileEncryptionKey.
+func LoadKeyUnwrapper(path string) (echo.KeyUnwrapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return echo.NewRSAKeyUnwrapper(key)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to parse private key: %w", path, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA private key", path)
+	}
+	return echo.NewRSAKeyUnwrapper(rsaKey)
+}
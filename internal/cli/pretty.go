@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+	"unicode"
+
+	"github.com/altitude-analytics/echo"
+)
+
+// ANSI escape sequences used by Printer.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+)
+
+// TimeFormat is the time layout used for display; it matches the one of
+// slog's TextHandler, which echo uses for console output.
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Printer renders entries as single lines in the style of echo's text
+// console output, optionally colourised.
+type Printer struct {
+	W     io.Writer
+	Color bool
+	// Fields, if set, limits the attributes shown to these dotted paths.
+	Fields []string
+	buf    bytes.Buffer
+}
+
+// Print writes e as one line.
+func (p *Printer) Print(e echo.Entry) error {
+	p.buf.Reset()
+	p.Format(&p.buf, e)
+	p.buf.WriteByte('\n')
+	_, err := p.W.Write(p.buf.Bytes())
+	return err
+}
+
+// Format appends the rendering of e, without a newline, to buf.
+func (p *Printer) Format(buf *bytes.Buffer, e echo.Entry) {
+	if !e.Time.IsZero() {
+		p.paint(buf, ansiDim, e.Time.Format(TimeFormat))
+		buf.WriteByte(' ')
+	}
+	p.paint(buf, LevelColor(e.Level), fmt.Sprintf("%-5s", e.Level.String()))
+	buf.WriteByte(' ')
+	p.paint(buf, ansiBold, e.Message)
+
+	if p.Fields != nil {
+		for _, path := range p.Fields {
+			if v, ok := e.Lookup(path); ok {
+				p.writeAttr(buf, path, v)
+			}
+		}
+	} else {
+		p.FormatAttrs(buf, e.Attrs)
+	}
+	if e.Source != nil {
+		buf.WriteByte(' ')
+		p.paint(buf, ansiDim, fmt.Sprintf("%s:%d", e.Source.File, e.Source.Line))
+	}
+}
+
+// FormatAttrs appends " key=value" for each attribute to buf, flattening
+// groups into dotted keys.
+func (p *Printer) FormatAttrs(buf *bytes.Buffer, attrs []slog.Attr) {
+	for _, a := range attrs {
+		p.writeAttr(buf, a.Key, a.Value)
+	}
+}
+
+// writeAttr writes key=value, flattening groups into dotted keys.
+func (p *Printer) writeAttr(buf *bytes.Buffer, key string, v slog.Value) {
+	if v.Kind() == slog.KindGroup {
+		for _, a := range v.Group() {
+			p.writeAttr(buf, key+"."+a.Key, a.Value)
+		}
+		return
+	}
+	buf.WriteByte(' ')
+	p.paint(buf, ansiCyan, QuoteIfNeeded(key))
+	p.paint(buf, ansiDim, "=")
+	buf.WriteString(QuoteIfNeeded(ValueString(v)))
+}
+
+func (p *Printer) paint(buf *bytes.Buffer, color, s string) {
+	if p.Color {
+		buf.WriteString(color)
+		buf.WriteString(s)
+		buf.WriteString(ansiReset)
+		return
+	}
+	buf.WriteString(s)
+}
+
+// LevelColor returns the ANSI colour used for a level.
+func LevelColor(l slog.Level) string {
+	switch {
+	case l >= slog.LevelError:
+		return ansiRed
+	case l >= slog.LevelWarn:
+		return ansiYellow
+	case l >= slog.LevelInfo:
+		return ansiGreen
+	default:
+		return ansiMagenta
+	}
+}
+
+// ValueString renders a value the way slog's TextHandler would.
+func ValueString(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if b, ok := v.Any().([]byte); ok {
+			return string(b)
+		}
+		if v.Any() == nil {
+			return "<nil>"
+		}
+	}
+	return v.String()
+}
+
+// QuoteIfNeeded quotes s under the same rules as slog's TextHandler: when it
+// is empty or contains spaces, non-printing characters, '"' or '='.
+func QuoteIfNeeded(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) || r == '"' || r == '=' {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
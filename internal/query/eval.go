@@ -0,0 +1,229 @@
+package query
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+// record is an entry or a result row, as seen by expressions and stages.
+type record interface {
+	get(name string) (slog.Value, bool)
+}
+
+// entryRecord exposes an entry's built-in fields by name (time, level, msg,
+// source) and its attributes by dotted path.
+type entryRecord struct{ e *echo.Entry }
+
+func (r entryRecord) get(name string) (slog.Value, bool) {
+	switch name {
+	case slog.TimeKey:
+		return slog.TimeValue(r.e.Time), !r.e.Time.IsZero()
+	case slog.LevelKey:
+		return slog.AnyValue(r.e.Level), true
+	case slog.MessageKey, "message":
+		return slog.StringValue(r.e.Message), true
+	case slog.SourceKey:
+		if r.e.Source == nil {
+			return slog.Value{}, false
+		}
+		return slog.StringValue(fmt.Sprintf("%s:%d", r.e.Source.File, r.e.Source.Line)), true
+	}
+	return r.e.Lookup(name)
+}
+
+// rowRecord is a result row of a fields or aggregation stage. Missing
+// values are stored as the zero slog.Value.
+type rowRecord struct {
+	columns []string
+	values  []slog.Value
+}
+
+func (r rowRecord) get(name string) (slog.Value, bool) {
+	for i, c := range r.columns {
+		if c == name {
+			return r.values[i], !isMissing(r.values[i])
+		}
+	}
+	return slog.Value{}, false
+}
+
+func isMissing(v slog.Value) bool {
+	return v.Kind() == slog.KindAny && v.Any() == nil
+}
+
+type expr interface {
+	eval(r record) bool
+}
+
+type andExpr struct{ left, right expr }
+type orExpr struct{ left, right expr }
+type notExpr struct{ e expr }
+type existsExpr struct{ field string }
+
+func (e andExpr) eval(r record) bool { return e.left.eval(r) && e.right.eval(r) }
+func (e orExpr) eval(r record) bool  { return e.left.eval(r) || e.right.eval(r) }
+func (e notExpr) eval(r record) bool { return !e.e.eval(r) }
+
+func (e existsExpr) eval(r record) bool {
+	_, ok := r.get(e.field)
+	return ok
+}
+
+type literal struct {
+	text   string
+	quoted bool
+}
+
+// cmpExpr compares a field with a literal. A missing field never matches.
+type cmpExpr struct {
+	field string
+	op    string
+	lit   literal
+	re    *regexp.Regexp // For ~ and !~
+}
+
+func (e cmpExpr) eval(r record) bool {
+	v, ok := r.get(e.field)
+	if !ok {
+		return false
+	}
+	if e.re != nil {
+		return e.re.MatchString(cli.ValueString(v)) == (e.op == "~")
+	}
+	ordered := e.op != "=" && e.op != "!="
+	c, ok := compareLiteral(v, e.lit, ordered)
+	if !ok {
+		return false
+	}
+	switch e.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// compareLiteral compares v with a literal, interpreting the literal by the
+// type of v: a level name for levels, a time (or duration ago) for times, a
+// duration for durations and a number, or a duration in nanoseconds, for
+// numbers. Anything else compares as strings. It reports false if the
+// literal does not fit v's type, or if ordered and only one of v and the
+// literal is a number, since ordering them as strings would be meaningless.
+func compareLiteral(v slog.Value, lit literal, ordered bool) (int, bool) {
+	if l, ok := v.Any().(slog.Level); ok {
+		var want slog.Level
+		if err := want.UnmarshalText([]byte(lit.text)); err != nil {
+			return 0, false
+		}
+		return cmp.Compare(l, want), true
+	}
+	switch v.Kind() {
+	case slog.KindTime:
+		want, err := cli.ParseTime(lit.text, time.Now())
+		if err != nil {
+			return 0, false
+		}
+		return v.Time().Compare(want), true
+	case slog.KindDuration:
+		want, err := time.ParseDuration(lit.text)
+		if err != nil {
+			return 0, false
+		}
+		return cmp.Compare(v.Duration(), want), true
+	}
+	f, isNum := toFloat(v)
+	if !lit.quoted {
+		if want, ok := literalFloat(lit.text); ok {
+			if isNum {
+				return cmp.Compare(f, want), true
+			}
+			if ordered {
+				return 0, false
+			}
+		}
+	}
+	if isNum && ordered {
+		return 0, false
+	}
+	return strings.Compare(cli.ValueString(v), lit.text), true
+}
+
+// literalFloat parses an unquoted literal compared with a number: a number,
+// or a duration as the integer nanoseconds JSON logs hold.
+func literalFloat(s string) (float64, bool) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, true
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return float64(d), true
+	}
+	return 0, false
+}
+
+// compareValues orders two values for sorting. Missing values sort first.
+func compareValues(a, b slog.Value) int {
+	if am, bm := isMissing(a), isMissing(b); am || bm {
+		switch {
+		case am && bm:
+			return 0
+		case am:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if al, ok := a.Any().(slog.Level); ok {
+		if bl, ok := b.Any().(slog.Level); ok {
+			return cmp.Compare(al, bl)
+		}
+	}
+	if a.Kind() == slog.KindTime && b.Kind() == slog.KindTime {
+		return a.Time().Compare(b.Time())
+	}
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			return cmp.Compare(af, bf)
+		}
+	}
+	return strings.Compare(cli.ValueString(a), cli.ValueString(b))
+}
+
+// toFloat returns v as a number. Strings holding a number count, since the
+// text format cannot always tell them apart.
+func toFloat(v slog.Value) (float64, bool) {
+	switch v.Kind() {
+	case slog.KindInt64:
+		return float64(v.Int64()), true
+	case slog.KindUint64:
+		return float64(v.Uint64()), true
+	case slog.KindFloat64:
+		return v.Float64(), true
+	case slog.KindDuration:
+		return float64(v.Duration()), true
+	case slog.KindString:
+		s := strings.TrimLeft(v.String(), "+-")
+		if s == "" || (s[0] < '0' || s[0] > '9') && s[0] != '.' {
+			return 0, false // Not "Inf" or "NaN"
+		}
+		f, err := strconv.ParseFloat(v.String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
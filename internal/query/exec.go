@@ -0,0 +1,282 @@
+package query
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+)
+
+// Output receives the results of a query: whole entries if the query has
+// no fields or aggregation stage, rows of Query.Columns otherwise. Rows are
+// passed as the zero slog.Value for missing values.
+type Output interface {
+	Entry(e echo.Entry) error
+	Row(values []slog.Value) error
+}
+
+// Exec runs a query over a stream of entries. Results are passed to the
+// Output as soon as they are known: right away for filters and fields, when
+// Flush is called for aggregations and sorting.
+type Exec struct {
+	head sink
+}
+
+// NewExec starts running q, writing results to out.
+func NewExec(q *Query, out Output) *Exec {
+	var s sink = outputSink{out}
+	for i := len(q.stages) - 1; i >= 0; i-- {
+		switch st := q.stages[i].(type) {
+		case whereStage:
+			s = &whereSink{cond: st.cond, next: s}
+		case fieldsStage:
+			s = &fieldsSink{fields: st.fields, next: s}
+		case aggStage:
+			s = newAggSink(st, s)
+		case sortStage:
+			s = &sortSink{col: st.col, desc: st.desc, next: s}
+		case limitStage:
+			s = &limitSink{n: st.n, next: s}
+		}
+	}
+	return &Exec{head: s}
+}
+
+// Push feeds the next entry. It returns cli.ErrStop once no further entry
+// can change the results, e.g. after "head 10" has seen ten matches; Flush
+// must still be called.
+func (x *Exec) Push(e echo.Entry) error {
+	return x.head.push(entryRecord{&e})
+}
+
+// Flush ends the input and writes the remaining results.
+func (x *Exec) Flush() error {
+	return x.head.flush()
+}
+
+// sink is one stage of a running query.
+type sink interface {
+	push(r record) error
+	flush() error
+}
+
+type outputSink struct{ out Output }
+
+func (s outputSink) push(r record) error {
+	switch r := r.(type) {
+	case entryRecord:
+		return s.out.Entry(*r.e)
+	case rowRecord:
+		return s.out.Row(r.values)
+	}
+	return nil
+}
+
+func (s outputSink) flush() error { return nil }
+
+type whereSink struct {
+	cond expr
+	next sink
+}
+
+func (s *whereSink) push(r record) error {
+	if !s.cond.eval(r) {
+		return nil
+	}
+	return s.next.push(r)
+}
+
+func (s *whereSink) flush() error { return s.next.flush() }
+
+type fieldsSink struct {
+	fields []string
+	next   sink
+}
+
+func (s *fieldsSink) push(r record) error {
+	values := make([]slog.Value, len(s.fields))
+	for i, f := range s.fields {
+		values[i], _ = r.get(f)
+	}
+	return s.next.push(rowRecord{columns: s.fields, values: values})
+}
+
+func (s *fieldsSink) flush() error { return s.next.flush() }
+
+type limitSink struct {
+	n, seen int
+	next    sink
+}
+
+func (s *limitSink) push(r record) error {
+	if s.seen >= s.n {
+		return cli.ErrStop
+	}
+	s.seen++
+	if err := s.next.push(r); err != nil {
+		return err
+	}
+	if s.seen >= s.n {
+		return cli.ErrStop
+	}
+	return nil
+}
+
+func (s *limitSink) flush() error { return s.next.flush() }
+
+// sortSink buffers everything and passes it on sorted, keeping the input
+// order of equal values.
+type sortSink struct {
+	col  string
+	desc bool
+	buf  []record
+	next sink
+}
+
+func (s *sortSink) push(r record) error {
+	s.buf = append(s.buf, r)
+	return nil
+}
+
+func (s *sortSink) flush() error {
+	slices.SortStableFunc(s.buf, func(a, b record) int {
+		av, _ := a.get(s.col)
+		bv, _ := b.get(s.col)
+		if s.desc {
+			return compareValues(bv, av)
+		}
+		return compareValues(av, bv)
+	})
+	err := pushAll(s.buf, s.next)
+	s.buf = nil
+	if err != nil {
+		return err
+	}
+	return s.next.flush()
+}
+
+// pushAll passes records on until next has had enough.
+func pushAll(records []record, next sink) error {
+	for _, r := range records {
+		if err := next.push(r); errors.Is(err, cli.ErrStop) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aggSink groups records by the values of its by fields, in the order the
+// groups are first seen.
+type aggSink struct {
+	stage   aggStage
+	columns []string
+	groups  map[string]*aggGroup
+	order   []*aggGroup
+	next    sink
+}
+
+type aggGroup struct {
+	key  []slog.Value
+	accs []accumulator
+}
+
+// accumulator holds the state of one aggregate function for one group.
+type accumulator struct {
+	count    int64 // Records seen (count) or numeric values seen (others)
+	sum      float64
+	min, max float64
+}
+
+func newAggSink(st aggStage, next sink) *aggSink {
+	columns := slices.Clone(st.by)
+	for _, a := range st.aggs {
+		columns = append(columns, a.name())
+	}
+	return &aggSink{stage: st, columns: columns, groups: map[string]*aggGroup{}, next: next}
+}
+
+func (s *aggSink) push(r record) error {
+	key := make([]slog.Value, len(s.stage.by))
+	var b strings.Builder
+	for i, f := range s.stage.by {
+		key[i], _ = r.get(f)
+		if !isMissing(key[i]) {
+			b.WriteString(cli.ValueString(key[i]))
+		}
+		b.WriteByte(0)
+	}
+	g := s.groups[b.String()]
+	if g == nil {
+		g = &aggGroup{key: key, accs: make([]accumulator, len(s.stage.aggs))}
+		for i := range g.accs {
+			g.accs[i].min, g.accs[i].max = math.Inf(1), math.Inf(-1)
+		}
+		s.groups[b.String()] = g
+		s.order = append(s.order, g)
+	}
+
+	for i, a := range s.stage.aggs {
+		acc := &g.accs[i]
+		if a.fn == "count" {
+			acc.count++
+			continue
+		}
+		v, ok := r.get(a.field)
+		if !ok {
+			continue
+		}
+		f, ok := toFloat(v)
+		if !ok {
+			continue
+		}
+		acc.count++
+		acc.sum += f
+		acc.min = math.Min(acc.min, f)
+		acc.max = math.Max(acc.max, f)
+	}
+	return nil
+}
+
+func (s *aggSink) flush() error {
+	records := make([]record, len(s.order))
+	for i, g := range s.order {
+		values := slices.Clone(g.key)
+		for j, a := range s.stage.aggs {
+			values = append(values, g.accs[j].result(a.fn))
+		}
+		records[i] = rowRecord{columns: s.columns, values: values}
+	}
+	s.groups, s.order = nil, nil
+	if err := pushAll(records, s.next); err != nil {
+		return err
+	}
+	return s.next.flush()
+}
+
+// result returns the value of fn; it is missing for avg, min and max of
+// groups without numeric values.
+func (a *accumulator) result(fn string) slog.Value {
+	switch fn {
+	case "count":
+		return slog.Int64Value(a.count)
+	case "sum":
+		return slog.Float64Value(a.sum)
+	}
+	if a.count == 0 {
+		return slog.Value{}
+	}
+	switch fn {
+	case "avg":
+		return slog.Float64Value(a.sum / float64(a.count))
+	case "min":
+		return slog.Float64Value(a.min)
+	default:
+		return slog.Float64Value(a.max)
+	}
+}
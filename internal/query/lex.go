@@ -0,0 +1,109 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokPipe
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// is reports whether t is the word w, ignoring case.
+func (t token) is(w string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, w)
+}
+
+// wordBreaks are the characters that end a bare word.
+const wordBreaks = `=!<>~()|,"'`
+
+// lex splits a query into tokens. Bare words run up to whitespace or one of
+// wordBreaks, so unquoted values such as /v1/items or 2024-01-02T10:00:00Z
+// need no quoting.
+func lex(s string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case c == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case c == '|':
+			toks = append(toks, token{tokPipe, "|", i})
+			i++
+		case c == ',':
+			toks = append(toks, token{tokComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			var b strings.Builder
+			for end < len(s) && s[end] != c {
+				if s[end] == '\\' && end+1 < len(s) {
+					end++
+				}
+				b.WriteByte(s[end])
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			toks = append(toks, token{tokString, b.String(), i})
+			i = end + 1
+		case strings.IndexByte("=!<>~", c) >= 0:
+			op := s[i : i+1]
+			if i+1 < len(s) {
+				if two := s[i : i+2]; two == ">=" || two == "<=" || two == "!=" || two == "==" || two == "!~" {
+					op = two
+				}
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected '!' at offset %d", i)
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+		default:
+			end := i
+			for end < len(s) {
+				r, size := utf8.DecodeRuneInString(s[end:])
+				if unicode.IsSpace(r) || strings.ContainsRune(wordBreaks, r) {
+					break
+				}
+				end += size
+			}
+			toks = append(toks, token{tokWord, s[i:end], i})
+			i = end
+		}
+	}
+	return append(toks, token{tokEOF, "", len(s)}), nil
+}
@@ -0,0 +1,409 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/altitude-analytics/echo"
+)
+
+// Query is a parsed query, ready to be run with NewExec.
+type Query struct {
+	stages []stage
+	// columns names the values of result rows; nil when the result is
+	// the matching entries themselves.
+	columns []string
+}
+
+// Columns returns the names of the result columns, or nil if the query
+// returns whole entries.
+func (q *Query) Columns() []string { return q.columns }
+
+type stage interface{ isStage() }
+
+type whereStage struct{ cond expr }
+
+type fieldsStage struct{ fields []string }
+
+type aggStage struct {
+	aggs []aggSpec
+	by   []string
+}
+
+type aggSpec struct {
+	fn    string // count, sum, avg, min or max
+	field string // Empty for count
+}
+
+func (a aggSpec) name() string {
+	if a.field == "" {
+		return a.fn
+	}
+	return a.fn + "(" + a.field + ")"
+}
+
+type sortStage struct {
+	col  string
+	desc bool
+}
+
+type limitStage struct{ n int }
+
+func (whereStage) isStage()  {}
+func (fieldsStage) isStage() {}
+func (aggStage) isStage()    {}
+func (sortStage) isStage()   {}
+func (limitStage) isStage()  {}
+
+// stageKeywords start a stage; any other segment is a filter expression.
+var stageKeywords = map[string]bool{
+	"where": true, "fields": true, "sort": true, "top": true, "head": true, "limit": true,
+	"count": true, "sum": true, "avg": true, "min": true, "max": true,
+}
+
+// Parse parses a query: a filter expression and/or stages separated by '|'.
+//
+//	level>=warn and http.status>=500 | count by route | top 10
+//
+// See the echo-query command documentation for the full language.
+func Parse(s string) (*Query, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	p := &parser{toks: toks}
+	q, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	return q, nil
+}
+
+// ParseFilter parses a query made only of filter expressions and returns
+// a function matching the entries it selects.
+//
+//	level>=warn and http.status>=500
+func ParseFilter(s string) (func(echo.Entry) bool, error) {
+	q, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	var conds []expr
+	for _, st := range q.stages {
+		w, ok := st.(whereStage)
+		if !ok {
+			return nil, fmt.Errorf("query: only filter expressions are allowed here")
+		}
+		conds = append(conds, w.cond)
+	}
+	return func(e echo.Entry) bool {
+		r := entryRecord{&e}
+		for _, c := range conds {
+			if !c.eval(r) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func unexpected(t token) error {
+	return fmt.Errorf("unexpected %s at offset %d", t, t.pos)
+}
+
+func (p *parser) parse() (*Query, error) {
+	q := &Query{}
+	aggCol := "" // First aggregate column of the last aggregation, for top
+	for {
+		if err := p.parseSegment(q, &aggCol); err != nil {
+			return nil, err
+		}
+		switch t := p.next(); t.kind {
+		case tokEOF:
+			return q, nil
+		case tokPipe:
+		default:
+			return nil, unexpected(t)
+		}
+	}
+}
+
+func (p *parser) parseSegment(q *Query, aggCol *string) error {
+	t := p.peek()
+	kw := strings.ToLower(t.text)
+	if t.kind != tokWord || !stageKeywords[kw] || p.toks[p.pos+1].kind == tokOp {
+		// A bare expression is an implicit where.
+		cond, err := p.parseOr()
+		if err != nil {
+			return err
+		}
+		q.stages = append(q.stages, whereStage{cond})
+		return nil
+	}
+
+	switch kw {
+	case "where":
+		p.next()
+		cond, err := p.parseOr()
+		if err != nil {
+			return err
+		}
+		q.stages = append(q.stages, whereStage{cond})
+	case "fields":
+		p.next()
+		fields, err := p.parseFieldList()
+		if err != nil {
+			return err
+		}
+		q.stages = append(q.stages, fieldsStage{fields})
+		q.columns = fields
+	case "sort":
+		p.next()
+		col, err := p.parseField()
+		if err != nil {
+			return err
+		}
+		s := sortStage{col: col}
+		if t := p.peek(); t.is("desc") || t.is("asc") {
+			s.desc = p.next().is("desc")
+		}
+		q.stages = append(q.stages, s)
+	case "top":
+		p.next()
+		n, err := p.parseCount()
+		if err != nil {
+			return err
+		}
+		col := *aggCol
+		if p.peek().kind == tokWord || p.peek().kind == tokString {
+			if col, err = p.parseField(); err != nil {
+				return err
+			}
+		}
+		if col == "" {
+			return fmt.Errorf("top needs a column when it does not follow an aggregation")
+		}
+		q.stages = append(q.stages, sortStage{col: col, desc: true}, limitStage{n})
+	case "head", "limit":
+		p.next()
+		n, err := p.parseCount()
+		if err != nil {
+			return err
+		}
+		q.stages = append(q.stages, limitStage{n})
+	default:
+		agg, err := p.parseAgg()
+		if err != nil {
+			return err
+		}
+		q.stages = append(q.stages, agg)
+		q.columns = append(append([]string(nil), agg.by...), agg.aggs[0].name())
+		for _, a := range agg.aggs[1:] {
+			q.columns = append(q.columns, a.name())
+		}
+		*aggCol = agg.aggs[0].name()
+	}
+	return nil
+}
+
+// parseAgg parses "count, avg took by route, method". Function arguments
+// may also be written in parentheses: avg(took).
+func (p *parser) parseAgg() (aggStage, error) {
+	var agg aggStage
+	for {
+		t := p.next()
+		fn := strings.ToLower(t.text)
+		if t.kind != tokWord || !isAggFunc(fn) {
+			return aggStage{}, fmt.Errorf("expected count, sum, avg, min or max, got %s", t)
+		}
+		a := aggSpec{fn: fn}
+		paren := p.peek().kind == tokLParen
+		if paren {
+			p.next()
+		}
+		if fn != "count" || paren && p.peek().kind == tokWord {
+			field, err := p.parseField()
+			if err != nil {
+				return aggStage{}, err
+			}
+			if fn == "count" {
+				return aggStage{}, fmt.Errorf("count takes no field; use where to filter")
+			}
+			a.field = field
+		}
+		if paren {
+			if t := p.next(); t.kind != tokRParen {
+				return aggStage{}, unexpected(t)
+			}
+		}
+		agg.aggs = append(agg.aggs, a)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if p.peek().is("by") {
+		p.next()
+		by, err := p.parseFieldList()
+		if err != nil {
+			return aggStage{}, err
+		}
+		agg.by = by
+	}
+	return agg, nil
+}
+
+func isAggFunc(s string) bool {
+	switch s {
+	case "count", "sum", "avg", "min", "max":
+		return true
+	}
+	return false
+}
+
+// parseFieldList parses one or more fields, separated by commas or spaces.
+func (p *parser) parseFieldList() ([]string, error) {
+	var fields []string
+	for {
+		f, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+		if p.peek().kind == tokComma {
+			p.next()
+			continue
+		}
+		if p.peek().kind != tokWord {
+			return fields, nil
+		}
+	}
+}
+
+// parseField parses a field or column name. Aggregate columns can be named
+// as they are written, e.g. avg(took).
+func (p *parser) parseField() (string, error) {
+	t := p.next()
+	if t.kind != tokWord && t.kind != tokString {
+		return "", fmt.Errorf("expected a field name, got %s", t)
+	}
+	if fn := strings.ToLower(t.text); t.kind == tokWord && isAggFunc(fn) && p.peek().kind == tokLParen {
+		p.next()
+		arg := p.next()
+		if arg.kind != tokWord && arg.kind != tokString {
+			return "", fmt.Errorf("expected a field name, got %s", arg)
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return "", unexpected(t)
+		}
+		return aggSpec{fn: fn, field: arg.text}.name(), nil
+	}
+	return t.text, nil
+}
+
+func (p *parser) parseCount() (int, error) {
+	t := p.next()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != tokWord || err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a count, got %s", t)
+	}
+	return n, nil
+}
+
+// parseOr parses: and { "or" and }.
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+// parseAnd parses: unary { "and" unary }.
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+// parseUnary parses: "not" unary | "(" or ")" | field [op value].
+func (p *parser) parseUnary() (expr, error) {
+	t := p.peek()
+	switch {
+	case t.is("not"):
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+	case t.kind == tokLParen:
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, unexpected(t)
+		}
+		return e, nil
+	}
+
+	field, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokOp {
+		return existsExpr{field}, nil
+	}
+	op := p.next().text
+	if op == "==" {
+		op = "="
+	}
+	v := p.next()
+	if v.kind != tokWord && v.kind != tokString {
+		return nil, fmt.Errorf("expected a value after %s %s, got %s", field, op, v)
+	}
+	c := cmpExpr{field: field, op: op, lit: literal{text: v.text, quoted: v.kind == tokString}}
+	if op == "~" || op == "!~" {
+		if c.re, err = regexp.Compile(v.text); err != nil {
+			return nil, fmt.Errorf("bad pattern for %s: %w", field, err)
+		}
+	}
+	return c, nil
+}
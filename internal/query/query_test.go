@@ -0,0 +1,260 @@
+package query
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collect is an Output that keeps everything it is given.
+type collect struct {
+	entries []echo.Entry
+	rows    [][]slog.Value
+}
+
+func (c *collect) Entry(e echo.Entry) error {
+	c.entries = append(c.entries, e)
+	return nil
+}
+
+func (c *collect) Row(values []slog.Value) error {
+	c.rows = append(c.rows, values)
+	return nil
+}
+
+func request(level slog.Level, route string, status int, took float64) echo.Entry {
+	return echo.Entry{
+		Time:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Level:   level,
+		Message: "request",
+		Attrs: []slog.Attr{
+			slog.Group("http", slog.Int("status", status), slog.String("route", route)),
+			slog.Float64("took", took),
+		},
+	}
+}
+
+var sample = []echo.Entry{
+	request(slog.LevelInfo, "/a", 200, 0.1),
+	request(slog.LevelError, "/a", 503, 2),
+	request(slog.LevelWarn, "/b", 500, 1),
+	request(slog.LevelError, "/b", 502, 3),
+	request(slog.LevelError, "/c", 504, 4),
+	request(slog.LevelError, "/b", 500, 5),
+	{Level: slog.LevelError, Message: "panic: nil map"},
+}
+
+// run runs query over sample.
+func run(t *testing.T, query string) (*Query, *collect) {
+	t.Helper()
+	q, err := Parse(query)
+	require.NoError(t, err)
+	out := &collect{}
+	x := NewExec(q, out)
+	for _, e := range sample {
+		if err := x.Push(e); errors.Is(err, cli.ErrStop) {
+			break
+		} else {
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, x.Flush())
+	return q, out
+}
+
+// rowStrings renders result rows for comparison.
+func rowStrings(rows [][]slog.Value) [][]string {
+	var out [][]string
+	for _, row := range rows {
+		var s []string
+		for _, v := range row {
+			s = append(s, cli.ValueString(v))
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestFilter(t *testing.T) {
+	cases := map[string]int{
+		"level>=warn":                             6,
+		"level=error and http.status>=503":        2,
+		"http.route=/b or http.route=/c":          4,
+		"not http.status":                         1,
+		"level>=warn and not (http.route = '/b')": 3,
+		`msg ~ "^panic"`:                          1,
+		"msg !~ panic and took > 2.5":             3,
+		"http.status=503":                         1,
+		`http.status="503"`:                       1,
+		"time>=2024-01-01 and time<2024-01-02":    6,
+		"where level==ERROR | where took<=4":      3,
+		"http.route=/a | head 1":                  1,
+		"level>=warn | head 2":                    2,
+		"http.status>=500 and http.status<=502":   3,
+		"missing=1 or missing!=1":                 0,
+		"level>=WARN+2":                           5,
+		"took>1e0":                                4,
+		"http.route>/a":                           4,
+		"(level=warn or level=info) and took<0.5": 1,
+		"http.status >= 500 and (took < 3)":       2,
+	}
+	for query, want := range cases {
+		_, out := run(t, query)
+		assert.Len(t, out.entries, want, query)
+		assert.Empty(t, out.rows, query)
+	}
+}
+
+func TestFilterJSONDurations(t *testing.T) {
+	// JSON logs hold durations as integer nanoseconds.
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	for i := 1; i <= 20; i++ {
+		logger.Info("request", "dur", time.Duration(i)*time.Millisecond, "route", "/a")
+	}
+	rd, err := echo.NewReader(&buf, nil)
+	require.NoError(t, err)
+	var entries []echo.Entry
+	require.NoError(t, cli.Drain(rd, io.Discard, func(e echo.Entry) error {
+		entries = append(entries, e)
+		return nil
+	}))
+	require.Len(t, entries, 20)
+
+	cases := map[string]int{
+		"dur > 5ms":     15,
+		"dur <= 1.5ms":  1,
+		"dur = 20ms":    1,
+		"dur > 5000000": 15,
+		"dur > abc":     0,
+		"dur != abc":    20,
+		"route > 5ms":   0,
+		"route > /0":    20,
+	}
+	for query, want := range cases {
+		q, err := Parse(query)
+		require.NoError(t, err, query)
+		out := &collect{}
+		x := NewExec(q, out)
+		for _, e := range entries {
+			require.NoError(t, x.Push(e))
+		}
+		require.NoError(t, x.Flush())
+		assert.Len(t, out.entries, want, query)
+	}
+}
+
+func TestAggregation(t *testing.T) {
+	q, out := run(t, "level>=warn and http.status>=500 | count by http.route | top 2")
+	assert.Equal(t, []string{"http.route", "count"}, q.Columns())
+	assert.Equal(t, [][]string{{"/b", "3"}, {"/a", "1"}}, rowStrings(out.rows),
+		"Ties should keep first-seen order")
+
+	q, out = run(t, "count, avg took, max(took), sum took by level | sort level desc")
+	assert.Equal(t, []string{"level", "count", "avg(took)", "max(took)", "sum(took)"}, q.Columns())
+	assert.Equal(t, [][]string{
+		{"ERROR", "5", "3.5", "5", "14"},
+		{"WARN", "1", "1", "1", "1"},
+		{"INFO", "1", "0.1", "0.1", "0.1"},
+	}, rowStrings(out.rows))
+
+	_, out = run(t, "count by http.route | where count>=2 | sort http.route")
+	assert.Equal(t, [][]string{{"/a", "2"}, {"/b", "3"}}, rowStrings(out.rows))
+
+	_, out = run(t, "count by http.route | sort http.route | head 1")
+	assert.Equal(t, [][]string{{"<nil>", "1"}}, rowStrings(out.rows), "Missing values sort first")
+
+	_, out = run(t, "count")
+	assert.Equal(t, [][]string{{"7"}}, rowStrings(out.rows))
+
+	_, out = run(t, "min took by http.route | where http.route=/c or min(took)<1")
+	assert.Equal(t, [][]string{{"/a", "0.1"}, {"/c", "4"}}, rowStrings(out.rows))
+}
+
+func TestFieldsAndTop(t *testing.T) {
+	q, out := run(t, "http.status | fields http.route, took | top 2 took")
+	assert.Equal(t, []string{"http.route", "took"}, q.Columns())
+	assert.Equal(t, [][]string{{"/b", "5"}, {"/c", "4"}}, rowStrings(out.rows))
+
+	_, out = run(t, "top 1 took")
+	require.Len(t, out.entries, 1, "Sorting without projection should pass entries through")
+	assert.Equal(t, 500, int(mustLookup(t, out.entries[0], "http.status").Int64()))
+}
+
+func mustLookup(t *testing.T, e echo.Entry, path string) slog.Value {
+	t.Helper()
+	v, ok := e.Lookup(path)
+	require.True(t, ok, path)
+	return v
+}
+
+func TestHeadStopsInput(t *testing.T) {
+	q, err := Parse("level=error | head 1")
+	require.NoError(t, err)
+	x := NewExec(q, &collect{})
+	assert.NoError(t, x.Push(sample[0]))
+	assert.ErrorIs(t, x.Push(sample[1]), cli.ErrStop)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"level>=",
+		"(level=warn",
+		"level=warn |",
+		"count by",
+		"count took",
+		"avg",
+		"top 10",
+		"head -1",
+		"head x",
+		`msg ~ "("`,
+		`msg = "open`,
+		"a ! b",
+		"level=warn extra",
+	} {
+		_, err := Parse(query)
+		assert.Error(t, err, "%q should not parse", query)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	match, err := ParseFilter("level>=warn | where http.status>=500")
+	require.NoError(t, err)
+	matched := 0
+	for _, e := range sample {
+		v, ok := e.Lookup("http.status")
+		want := e.Level >= slog.LevelWarn && ok && v.Int64() >= 500
+		assert.Equal(t, want, match(e), "%+v", e)
+		if want {
+			matched++
+		}
+	}
+	assert.Positive(t, matched)
+
+	_, err = ParseFilter("level=warn | count")
+	assert.Error(t, err)
+}
+
+func TestLexNonASCII(t *testing.T) {
+	// "à" and "Å" end in the bytes 0x85 and 0xA0, which are spaces as runes.
+	toks, err := lex("city=à and name=Århus x")
+	require.NoError(t, err)
+	var texts []string
+	for _, tok := range toks[:len(toks)-1] {
+		texts = append(texts, tok.text)
+	}
+	assert.Equal(t, []string{"city", "=", "à", "and", "name", "=", "Århus", "x"}, texts)
+
+	match, err := ParseFilter("city=Århus")
+	require.NoError(t, err)
+	assert.True(t, match(echo.Entry{Attrs: []slog.Attr{slog.String("city", "Århus")}}))
+}
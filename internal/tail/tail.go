@@ -0,0 +1,156 @@
+// Package tail follows a growing log file, the way tail -F does: it waits
+// for appended data, and when the file is rotated away or truncated it
+// continues with the file that now sits at the path.
+package tail
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultPoll is how often a Follower checks for new data once it has
+// caught up.
+const DefaultPoll = 250 * time.Millisecond
+
+// Follower is an io.Reader over the file at a path that never reports the
+// end of the file. Read blocks until data arrives, and returns io.EOF only
+// once its context is done, or in single-file mode once the file is gone.
+type Follower struct {
+	ctx    context.Context
+	path   string
+	poll   time.Duration
+	file   *os.File
+	offset int64
+	single bool // Stop at rotation instead of moving on
+	done   bool // The single file has been rotated away and read to its end
+}
+
+// Open starts following path at offset. A missing file is waited for.
+func Open(ctx context.Context, path string, offset int64) (*Follower, error) {
+	f := &Follower{ctx: ctx, path: path, poll: DefaultPoll}
+	if err := f.open(offset); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetPoll changes the polling interval.
+func (f *Follower) SetPoll(d time.Duration) { f.poll = d }
+
+// SetSingleFile makes Read return io.EOF, instead of moving on, once the
+// file has been rotated away or truncated and everything in it has been
+// read. Positions then always refer to one file, e.g. to checkpoint them.
+func (f *Follower) SetSingleFile(single bool) { f.single = single }
+
+// Offset is the position in the current file up to which data has been
+// returned by Read.
+func (f *Follower) Offset() int64 { return f.offset }
+
+// File returns the file currently being read, or nil while waiting for the
+// path to appear.
+func (f *Follower) File() *os.File { return f.file }
+
+func (f *Follower) open(offset int64) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	if fi, err := file.Stat(); err == nil && fi.Size() < offset {
+		offset = 0 // Truncated since the offset was taken
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.offset = file, offset
+	return nil
+}
+
+// Read reads from the current file, waiting for more data at its end.
+func (f *Follower) Read(p []byte) (int, error) {
+	for {
+		if f.done {
+			return 0, io.EOF
+		}
+		if f.file != nil {
+			n, err := f.file.Read(p)
+			f.offset += int64(n)
+			if n > 0 {
+				return n, nil
+			}
+			if err != nil && err != io.EOF {
+				return 0, err
+			}
+			if switched, err := f.checkRotation(); err != nil {
+				return 0, err
+			} else if switched {
+				continue
+			}
+		} else if err := f.open(0); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+
+		select {
+		case <-f.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(f.poll):
+		}
+	}
+}
+
+// checkRotation moves to the file now at the path if it differs from the
+// one being read, and rewinds if the file was truncated. It is called at the
+// end of the current file, but records may have been appended between that
+// read and the rotation, so a rotated file is only left once it has been
+// read to its final end.
+func (f *Follower) checkRotation() (bool, error) {
+	cur, err := f.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	onDisk, err := os.Stat(f.path)
+	if err != nil {
+		// Rotated away and not yet recreated: keep waiting on the old file.
+		return false, nil
+	}
+	rotated, truncated := !os.SameFile(cur, onDisk), cur.Size() < f.offset
+	if rotated {
+		// The rotated file no longer grows, so its size now is final.
+		if cur, err = f.file.Stat(); err != nil {
+			return false, err
+		}
+		if cur.Size() > f.offset {
+			return true, nil
+		}
+	}
+	if f.single && (rotated || truncated) {
+		f.done = true
+		return true, nil
+	}
+	if rotated {
+		f.file.Close()
+		f.file = nil
+		return true, f.open(0)
+	}
+	if truncated {
+		_, err := f.file.Seek(0, io.SeekStart)
+		f.offset = 0
+		return err == nil, err
+	}
+	return false, nil
+}
+
+// Close closes the current file.
+func (f *Follower) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
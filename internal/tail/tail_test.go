@@ -0,0 +1,154 @@
+package tail
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendLine(t *testing.T, path, line string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(line + "\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func TestFollowerAcrossRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The file does not exist yet; the follower waits for it.
+	f, err := Open(ctx, path, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	f.SetPoll(5 * time.Millisecond)
+	lines := bufio.NewScanner(f)
+
+	appendLine(t, path, "one")
+	require.True(t, lines.Scan())
+	assert.Equal(t, "one", lines.Text())
+
+	// Data written to the old file before rotation is still read.
+	appendLine(t, path, "two")
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "app-1.log")))
+	appendLine(t, path, "three")
+
+	require.True(t, lines.Scan())
+	assert.Equal(t, "two", lines.Text())
+	require.True(t, lines.Scan())
+	assert.Equal(t, "three", lines.Text())
+	assert.Equal(t, int64(len("three\n")), f.Offset())
+}
+
+func TestFollowerOffsetAndCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendLine(t, path, "skipped")
+	appendLine(t, path, "kept")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f, err := Open(ctx, path, int64(len("skipped\n")))
+	require.NoError(t, err)
+	defer f.Close()
+	f.SetPoll(5 * time.Millisecond)
+
+	lines := bufio.NewScanner(f)
+	require.True(t, lines.Scan())
+	assert.Equal(t, "kept", lines.Text())
+
+	cancel()
+	assert.False(t, lines.Scan(), "Reading should end once the context is done")
+	assert.NoError(t, lines.Err())
+}
+
+func TestFollowerTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendLine(t, path, "long first line")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	f, err := Open(ctx, path, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	f.SetPoll(5 * time.Millisecond)
+	lines := bufio.NewScanner(f)
+	require.True(t, lines.Scan())
+
+	require.NoError(t, os.Truncate(path, 0))
+	appendLine(t, path, "new")
+	require.True(t, lines.Scan())
+	assert.Equal(t, "new", lines.Text())
+}
+
+func TestFollowerSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLine(t, path, "old")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	f, err := Open(ctx, path, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	f.SetPoll(5 * time.Millisecond)
+	f.SetSingleFile(true)
+	lines := bufio.NewScanner(f)
+	require.True(t, lines.Scan())
+
+	appendLine(t, path, "last")
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "app-1.log")))
+	appendLine(t, path, "new")
+
+	require.True(t, lines.Scan())
+	assert.Equal(t, "last", lines.Text())
+	assert.False(t, lines.Scan(), "Reading should end at the rotation")
+	assert.NoError(t, ctx.Err())
+}
+
+func TestFollowerDrainsBeforeRotation(t *testing.T) {
+	for _, single := range []bool{false, true} {
+		t.Run(fmt.Sprintf("single=%v", single), func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log")
+			appendLine(t, path, "one")
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			f, err := Open(ctx, path, 0)
+			require.NoError(t, err)
+			defer f.Close()
+			f.SetPoll(5 * time.Millisecond)
+			f.SetSingleFile(single)
+			lines := bufio.NewScanner(f)
+			require.True(t, lines.Scan())
+
+			// The writer appends and rotates right after Read has hit the end of
+			// the file, before the rotation check.
+			appendLine(t, path, "two")
+			require.NoError(t, os.Rename(path, filepath.Join(dir, "app-1.log")))
+			appendLine(t, path, "three")
+			switched, err := f.checkRotation()
+			require.NoError(t, err)
+			assert.True(t, switched)
+
+			require.True(t, lines.Scan(), "Records written before the rotation should be read")
+			assert.Equal(t, "two", lines.Text())
+			if single {
+				assert.False(t, lines.Scan(), "Reading should end at the rotation")
+				return
+			}
+			require.True(t, lines.Scan())
+			assert.Equal(t, "three", lines.Text())
+		})
+	}
+}
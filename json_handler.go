@@ -0,0 +1,390 @@
+package echo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxPooledBuffer is the largest buffer returned to the pools, so that one
+// huge record does not pin its memory.
+const maxPooledBuffer = 16 << 10
+
+// jsonHandler writes records exactly as slog's JSONHandler does, but
+// without allocating for records of common types: buffers are pooled,
+// WithAttrs attributes are encoded once, and only values of kind Any other
+// than errors go through encoding/json. Kept unexported; newJSONHandler
+// falls back to slog's handler when ReplaceAttr is set, which it does not
+// support.
+type jsonHandler struct {
+	opts       slog.HandlerOptions
+	w          io.Writer
+	mu         *sync.Mutex // Shared with derived handlers so records don't interleave
+	preformat  []byte      // Encoded WithAttrs attributes, inside groups[:openGroups]
+	groups     []string    // Groups from WithGroup
+	openGroups int         // Groups already opened in preformat
+}
+
+// newJSONHandler returns a handler writing records to w as JSON lines.
+func newJSONHandler(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	if opts != nil && opts.ReplaceAttr != nil {
+		return slog.NewJSONHandler(w, opts)
+	}
+	h := &jsonHandler{w: w, mu: &sync.Mutex{}}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+var jsonBufPool = sync.Pool{New: func() any { b := make([]byte, 0, 1024); return &b }}
+
+func (h *jsonHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *jsonHandler) minLevel() int64 { return staticMinLevel(h.opts.Level) }
+
+func (h *jsonHandler) Handle(_ context.Context, r slog.Record) error {
+	bp := jsonBufPool.Get().(*[]byte)
+	buf := (*bp)[:0]
+	defer func() {
+		if cap(buf) <= maxPooledBuffer {
+			*bp = buf
+			jsonBufPool.Put(bp)
+		}
+	}()
+
+	buf = append(buf, '{')
+	if !r.Time.IsZero() {
+		buf = append(buf, `"time":`...)
+		buf = appendJSONTime(buf, r.Time.Round(0))
+		buf = append(buf, ',')
+	}
+	buf = append(buf, `"level":`...)
+	buf = appendJSONString(buf, r.Level.String())
+	if h.opts.AddSource && r.PC != 0 {
+		fs := runtime.CallersFrames([]uintptr{r.PC})
+		f, _ := fs.Next()
+		buf, _ = appendJSONAttr(buf, slog.Any(slog.SourceKey, &slog.Source{Function: f.Function, File: f.File, Line: f.Line}))
+	}
+	buf = append(buf, `,"msg":`...)
+	buf = appendJSONString(buf, r.Message)
+
+	buf = append(buf, h.preformat...)
+	open := h.openGroups
+	if r.NumAttrs() > 0 {
+		// Groups from WithGroup are only opened if the record has attributes
+		// that are not empty, as in slog's handlers.
+		start := len(buf)
+		for _, g := range h.groups[h.openGroups:] {
+			buf = appendJSONKey(buf, g)
+			buf = append(buf, '{')
+		}
+		wrote := false
+		r.Attrs(func(a slog.Attr) bool {
+			var ok bool
+			buf, ok = appendJSONAttr(buf, a)
+			wrote = wrote || ok
+			return true
+		})
+		if wrote {
+			open = len(h.groups)
+		} else {
+			buf = buf[:start]
+		}
+	}
+	for range open {
+		buf = append(buf, '}')
+	}
+	buf = append(buf, '}', '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf)
+	return err
+}
+
+func (h *jsonHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := h.clone()
+	start := len(h2.preformat)
+	for _, g := range h2.groups[h2.openGroups:] {
+		h2.preformat = appendJSONKey(h2.preformat, g)
+		h2.preformat = append(h2.preformat, '{')
+	}
+	wrote := false
+	for _, a := range attrs {
+		var ok bool
+		h2.preformat, ok = appendJSONAttr(h2.preformat, a)
+		wrote = wrote || ok
+	}
+	if !wrote {
+		// Nothing but empty attributes: leave the groups unopened.
+		h2.preformat = h2.preformat[:start]
+		return h2
+	}
+	h2.openGroups = len(h2.groups)
+	return h2
+}
+
+func (h *jsonHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := h.clone()
+	h2.groups = append(h2.groups, name)
+	return h2
+}
+
+func (h *jsonHandler) clone() *jsonHandler {
+	h2 := *h
+	h2.preformat = append([]byte(nil), h.preformat...)
+	h2.groups = append([]string(nil), h.groups...)
+	return &h2
+}
+
+// appendJSONKey appends a key and its colon, after a comma unless it is the
+// first member of an object. b always follows at least the level member,
+// so an empty b is not the start of an object.
+func appendJSONKey(b []byte, key string) []byte {
+	if len(b) == 0 || b[len(b)-1] != '{' {
+		b = append(b, ',')
+	}
+	b = appendJSONString(b, key)
+	return append(b, ':')
+}
+
+// appendJSONAttr appends a member for a, following slog's rules: values are
+// resolved, empty attributes and empty groups are dropped, groups with an
+// empty key are inlined, and sources are written as objects. It reports
+// whether anything was appended.
+func appendJSONAttr(b []byte, a slog.Attr) ([]byte, bool) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return b, false
+	}
+	if a.Value.Kind() == slog.KindAny {
+		if src, ok := a.Value.Any().(*slog.Source); ok {
+			if src == nil || *src == (slog.Source{}) {
+				return b, false
+			}
+			a.Value = sourceGroup(src)
+		}
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return b, false
+		}
+		start := len(b)
+		if a.Key != "" {
+			b = appendJSONKey(b, a.Key)
+			b = append(b, '{')
+		}
+		wrote := false
+		for _, ga := range attrs {
+			var ok bool
+			b, ok = appendJSONAttr(b, ga)
+			wrote = wrote || ok
+		}
+		if !wrote {
+			return b[:start], false
+		}
+		if a.Key != "" {
+			b = append(b, '}')
+		}
+		return b, true
+	}
+	b = appendJSONKey(b, a.Key)
+	return appendJSONValue(b, a.Value), true
+}
+
+// sourceGroup returns src as slog's JSONHandler writes it, without its
+// empty fields.
+func sourceGroup(src *slog.Source) slog.Value {
+	var attrs []slog.Attr
+	if src.Function != "" {
+		attrs = append(attrs, slog.String("function", src.Function))
+	}
+	if src.File != "" {
+		attrs = append(attrs, slog.String("file", src.File))
+	}
+	if src.Line != 0 {
+		attrs = append(attrs, slog.Int("line", src.Line))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// appendJSONValue appends a resolved, non-group value. Values that cannot be
+// encoded are written as a "!ERROR:" string, as slog does.
+func appendJSONValue(b []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindString:
+		return appendJSONString(b, v.String())
+	case slog.KindInt64:
+		return strconv.AppendInt(b, v.Int64(), 10)
+	case slog.KindUint64:
+		return strconv.AppendUint(b, v.Uint64(), 10)
+	case slog.KindFloat64:
+		return appendJSONFloat(b, v.Float64())
+	case slog.KindBool:
+		return strconv.AppendBool(b, v.Bool())
+	case slog.KindDuration:
+		return strconv.AppendInt(b, int64(v.Duration()), 10)
+	case slog.KindTime:
+		return appendJSONTime(b, v.Time())
+	default:
+		return appendJSONAny(b, v.Any())
+	}
+}
+
+func appendJSONTime(b []byte, t time.Time) []byte {
+	if y := t.Year(); y < 0 || y >= 10000 {
+		return appendJSONError(b, errors.New("time.Time year outside of range [0,9999]"))
+	}
+	b = append(b, '"')
+	b = t.AppendFormat(b, time.RFC3339Nano)
+	return append(b, '"')
+}
+
+// appendJSONFloat appends f as encoding/json does.
+func appendJSONFloat(b []byte, f float64) []byte {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return appendJSONMarshal(b, f) // For the error
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+// appendJSONAny appends an error as its text and anything else as
+// encoding/json encodes it, without HTML escaping. Like slog, it writes
+// "<nil>" for nil pointers whose methods panic.
+func appendJSONAny(b []byte, v any) (out []byte) {
+	start := len(b)
+	defer func() {
+		if r := recover(); r != nil {
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+				out = appendJSONString(b[:start], "<nil>")
+				return
+			}
+			out = appendJSONString(b[:start], fmt.Sprintf("!PANIC: %v", r))
+		}
+	}()
+	if err, ok := v.(error); ok {
+		if _, isJSON := v.(json.Marshaler); !isJSON {
+			return appendJSONString(b, err.Error())
+		}
+	}
+	return appendJSONMarshal(b, v)
+}
+
+type jsonEncoder struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+var jsonEncoderPool = sync.Pool{New: func() any {
+	e := &jsonEncoder{}
+	e.enc = json.NewEncoder(&e.buf)
+	e.enc.SetEscapeHTML(false)
+	return e
+}}
+
+func appendJSONMarshal(b []byte, v any) []byte {
+	e := jsonEncoderPool.Get().(*jsonEncoder)
+	defer func() {
+		if e.buf.Cap() <= maxPooledBuffer {
+			e.buf.Reset()
+			jsonEncoderPool.Put(e)
+		}
+	}()
+	if err := e.enc.Encode(v); err != nil {
+		return appendJSONError(b, err)
+	}
+	return append(b, bytes.TrimSuffix(e.buf.Bytes(), []byte("\n"))...)
+}
+
+func appendJSONError(b []byte, err error) []byte {
+	return appendJSONString(b, "!ERROR:"+err.Error())
+}
+
+// appendJSONString appends s as a JSON string, escaped as encoding/json
+// does without HTML escaping.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= ' ' && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, jsonInvalidUTF8...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 are valid in JSON but not in JavaScript.
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
+const hexDigits = "0123456789abcdef"
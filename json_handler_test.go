@@ -0,0 +1,172 @@
+package echo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type jsonMarshalerError struct{}
+
+func (jsonMarshalerError) Error() string                { return "as error" }
+func (jsonMarshalerError) MarshalJSON() ([]byte, error) { return []byte(`{"as":"json"}`), nil }
+
+type panickyError struct{ msg string }
+
+func (e *panickyError) Error() string { return e.msg }
+
+type badJSON struct{}
+
+func (badJSON) MarshalJSON() ([]byte, error) { return nil, errors.New("no way") }
+
+type secret string
+
+func (secret) LogValue() slog.Value { return slog.StringValue("***") }
+
+// jsonParityAttrs covers the values slog's JSONHandler treats specially.
+var jsonParityAttrs = []slog.Attr{
+	slog.String("plain", "hello"),
+	slog.String("escapes", "q\"b\\n\n\r\t\x01<>&  é\xff"),
+	slog.Int("int", -42),
+	slog.Uint64("uint", math.MaxUint64),
+	slog.Float64("float", 1.5),
+	slog.Float64("whole", 100),
+	slog.Float64("big", 1e21),
+	slog.Float64("small", 1e-7),
+	slog.Float64("tiny", -1.5e-300),
+	slog.Float64("zero", 0),
+	slog.Float64("nan", math.NaN()),
+	slog.Float64("inf", math.Inf(-1)),
+	slog.Bool("bool", true),
+	slog.Duration("dur", 1500*time.Millisecond),
+	slog.Time("at", time.Date(2024, 2, 3, 4, 5, 6, 7000, time.FixedZone("", 3600))),
+	slog.Time("far", time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)),
+	slog.Any("err", errors.New("boom")),
+	slog.Any("nilerr", error(nil)),
+	slog.Any("jsonerr", jsonMarshalerError{}),
+	slog.Any("nilptr", (*panickyError)(nil)),
+	slog.Any("map", map[string]any{"b": 1, "a": []int{1, 2}, "h": "<&>"}),
+	slog.Any("bytes", []byte("raw")),
+	slog.Any("struct", struct{ A int }{1}),
+	slog.Any("bad", badJSON{}),
+	slog.Any("secret", secret("pw")),
+	slog.Group("g", slog.Int("a", 1), slog.Group("h", slog.String("b", "c"))),
+	slog.Group("empty"),
+	slog.Group("", slog.Int("inlined", 1)),
+	{},
+	slog.Any("src", &slog.Source{Function: "f", File: "x.go", Line: 3}),
+	slog.Any("nosrc", &slog.Source{}),
+	slog.String("", "empty key"),
+}
+
+func TestJSONHandlerParity(t *testing.T) {
+	pcs := make([]uintptr, 1)
+	runtime.Callers(1, pcs)
+	at := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+
+	records := map[string]slog.Record{}
+	add := func(name string, r slog.Record, attrs ...slog.Attr) {
+		r.AddAttrs(attrs...)
+		records[name] = r
+	}
+	add("all kinds", slog.NewRecord(at, slog.LevelInfo, "message \"quoted\"", pcs[0]), jsonParityAttrs...)
+	add("no attrs", slog.NewRecord(at, slog.LevelWarn, "", pcs[0]))
+	add("empty attrs", slog.NewRecord(time.Time{}, slog.LevelError+2, "no time", 0), slog.Attr{}, slog.Group("e"))
+	add("one attr", slog.NewRecord(at, slog.LevelDebug-1, "x", 0), slog.Int("n", 1))
+
+	variants := map[string]func(slog.Handler) slog.Handler{
+		"plain": func(h slog.Handler) slog.Handler { return h },
+		"with attrs": func(h slog.Handler) slog.Handler {
+			return h.WithAttrs([]slog.Attr{slog.String("svc", "api"), slog.Int("n", 2)})
+		},
+		"with group":   func(h slog.Handler) slog.Handler { return h.WithGroup("req") },
+		"group, attrs": func(h slog.Handler) slog.Handler { return h.WithGroup("req").WithAttrs(jsonParityAttrs[:3]) },
+		"attrs, groups": func(h slog.Handler) slog.Handler {
+			return h.WithAttrs(jsonParityAttrs[:1]).WithGroup("a").WithGroup("b")
+		},
+		"nested": func(h slog.Handler) slog.Handler {
+			return h.WithGroup("a").WithAttrs([]slog.Attr{slog.Int("x", 1)}).WithGroup("b").WithAttrs([]slog.Attr{slog.Int("y", 2)}).WithGroup("c")
+		},
+		"grouped attrs": func(h slog.Handler) slog.Handler { return h.WithAttrs([]slog.Attr{slog.Group("g", slog.Int("a", 1))}) },
+	}
+
+	for _, addSource := range []bool{false, true} {
+		opts := &slog.HandlerOptions{AddSource: addSource, Level: slog.LevelDebug - 4}
+		for vname, variant := range variants {
+			for rname, r := range records {
+				var want, got bytes.Buffer
+				require.NoError(t, variant(slog.NewJSONHandler(&want, opts)).Handle(context.Background(), r))
+				require.NoError(t, variant(newJSONHandler(&got, opts)).Handle(context.Background(), r))
+				assert.Equal(t, want.String(), got.String(), "source %v, %s, %s", addSource, vname, rname)
+			}
+		}
+	}
+}
+
+// TestJSONHandlerEmpty covers cases where slog's handler writes invalid
+// JSON or empty groups, and so are not in the parity test.
+func TestJSONHandlerEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	h := newJSONHandler(&buf, nil)
+	r := slog.NewRecord(time.Time{}, slog.LevelInfo, "m", 0)
+	r.AddAttrs(slog.Group("g", slog.Attr{}), slog.Int("n", 1))
+	require.NoError(t, h.Handle(context.Background(), r))
+	require.NoError(t, h.WithGroup("g").WithAttrs([]slog.Attr{{}}).Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelInfo, "m", 0)))
+	require.NoError(t, h.WithGroup("").Handle(context.Background(), r))
+	assert.Equal(t, `{"level":"INFO","msg":"m","n":1}
+{"level":"INFO","msg":"m"}
+{"level":"INFO","msg":"m","n":1}
+`, buf.String())
+}
+
+func TestJSONHandlerReplaceAttr(t *testing.T) {
+	opts := &slog.HandlerOptions{ReplaceAttr: func([]string, slog.Attr) slog.Attr { return slog.Attr{} }}
+	assert.IsType(t, &slog.JSONHandler{}, newJSONHandler(io.Discard, opts), "ReplaceAttr needs slog's handler")
+	assert.IsType(t, &jsonHandler{}, newJSONHandler(io.Discard, nil))
+}
+
+func TestJSONHandlerAllocs(t *testing.T) {
+	h := newJSONHandler(io.Discard, nil).WithAttrs([]slog.Attr{slog.String("service", "api")}).WithGroup("req")
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, "request handled", 0)
+	r.AddAttrs(slog.Int("status", 200), slog.String("path", "/v1/items"), slog.Duration("took", 3*time.Millisecond),
+		slog.Float64("ratio", 0.25), slog.Bool("cached", true), slog.Time("at", time.Now()), slog.Any("err", errors.New("x")))
+	allocs := testing.AllocsPerRun(100, func() {
+		h.Handle(context.Background(), r)
+	})
+	assert.Zero(t, allocs)
+}
+
+func BenchmarkFastJSONHandler(b *testing.B) {
+	benchmarkHandler(b, newJSONHandler(io.Discard, nil))
+}
+
+func BenchmarkJSONHandlers(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		h    slog.Handler
+	}{
+		{"slog", slog.NewJSONHandler(io.Discard, nil)},
+		{"echo", newJSONHandler(io.Discard, nil)},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			h := bm.h.WithAttrs([]slog.Attr{slog.String("service", "api"), slog.Int("pid", 1234)})
+			r := slog.NewRecord(time.Now(), slog.LevelInfo, "request handled", 0)
+			r.AddAttrs(slog.Int("status", 200), slog.String("path", "/v1/items"), slog.Duration("took", 3*time.Millisecond),
+				slog.Float64("ratio", 0.25), slog.Bool("cached", true), slog.Any("err", errors.New("not found")))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.Handle(context.Background(), r)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !goexperiment.jsonv2
+
+package echo
+
+// jsonInvalidUTF8 replaces invalid UTF-8 in JSON strings, as slog writes it.
+const jsonInvalidUTF8 = `\ufffd`
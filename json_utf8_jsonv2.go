@@ -0,0 +1,7 @@
+//go:build goexperiment.jsonv2
+
+package echo
+
+// jsonInvalidUTF8 replaces invalid UTF-8 in JSON strings. With json/v2,
+// slog writes the replacement character itself rather than its escape.
+const jsonInvalidUTF8 = "\ufffd"
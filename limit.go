@@ -0,0 +1,176 @@
+package echo
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// SuppressedKey is the key of the attribute counting the records a
+// LimitedLogger dropped at a call site since its previous record there.
+const SuppressedKey = "suppressed"
+
+// maxLimitKeys bounds the call sites and keys whose state LimitedLoggers
+// keep. Beyond it, the state of the least recently used one is forgotten:
+// a Once call site then logs again, and the records an Every call site had
+// dropped go uncounted.
+const maxLimitKeys = 4096
+
+// LimitedLogger logs a record at most once per call site, or once per
+// interval, e.g. for deprecation or configuration warnings that would
+// otherwise repeat on every request:
+//
+//	echo.Once(nil).Warn("X-Legacy header is deprecated")
+//	echo.Every(logger, time.Minute).Info("cache full", "size", n)
+//
+// Records are counted by call site, or by key if set with Key. The first
+// record logged after others were dropped counts them in a SuppressedKey
+// attribute.
+type LimitedLogger struct {
+	l     *slog.Logger
+	once  bool
+	every time.Duration
+	key   string
+}
+
+// Once returns a LimitedLogger logging to l, or to the default logger if l
+// is nil, the first record of each call site only.
+func Once(l *slog.Logger) *LimitedLogger {
+	return &LimitedLogger{l: l, once: true}
+}
+
+// Every returns a LimitedLogger logging to l, or to the default logger if l
+// is nil, at most one record per interval d at each call site. If d <= 0,
+// every record is logged.
+func Every(l *slog.Logger, d time.Duration) *LimitedLogger {
+	return &LimitedLogger{l: l, every: d}
+}
+
+// Key returns a LimitedLogger counting records by key rather than by call
+// site, e.g. to limit records logged from several places together, or from
+// a helper on behalf of its callers.
+func (x *LimitedLogger) Key(key string) *LimitedLogger {
+	x2 := *x
+	x2.key = key
+	return &x2
+}
+
+// Debug logs at LevelDebug, if allowed.
+func (x *LimitedLogger) Debug(msg string, args ...any) {
+	x.log(context.Background(), LevelDebug, msg, args)
+}
+
+// Info logs at LevelInfo, if allowed.
+func (x *LimitedLogger) Info(msg string, args ...any) {
+	x.log(context.Background(), LevelInfo, msg, args)
+}
+
+// Warn logs at LevelWarn, if allowed.
+func (x *LimitedLogger) Warn(msg string, args ...any) {
+	x.log(context.Background(), LevelWarn, msg, args)
+}
+
+// Error logs at LevelError, if allowed.
+func (x *LimitedLogger) Error(msg string, args ...any) {
+	x.log(context.Background(), LevelError, msg, args)
+}
+
+// Log logs at level with the context ctx, if allowed.
+func (x *LimitedLogger) Log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	x.log(ctx, level, msg, args)
+}
+
+// log must be called directly by the exported methods, so that the caller
+// it records is theirs.
+func (x *LimitedLogger) log(ctx context.Context, level slog.Level, msg string, args []any) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	l := x.l
+	if l == nil {
+		l = slog.Default()
+	}
+	h := l.Handler()
+	if !h.Enabled(ctx, level) {
+		return // Not counted as suppressed
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // Skip runtime.Callers, log and the exported method
+	var suppressed uint64
+	if x.once || x.every > 0 {
+		k := limitKey{key: x.key, every: x.every, once: x.once}
+		if k.key == "" {
+			k.pc = pcs[0]
+		}
+		var ok bool
+		if suppressed, ok = limits.allow(k); !ok {
+			return
+		}
+	}
+
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(args...)
+	if suppressed > 0 {
+		r.AddAttrs(slog.Uint64(SuppressedKey, suppressed))
+	}
+	_ = h.Handle(ctx, r)
+}
+
+// limitKey identifies the records limited together. Once and Every, and
+// Every with different intervals, keep separate counts.
+type limitKey struct {
+	pc    uintptr
+	key   string
+	every time.Duration
+	once  bool
+}
+
+type limitState struct {
+	key        limitKey
+	last       time.Time // Of the last record logged
+	suppressed uint64    // Records dropped since
+}
+
+// limiter holds the state of every LimitedLogger.
+type limiter struct {
+	mu     sync.Mutex
+	states map[limitKey]*list.Element // Of *limitState, in lru
+	lru    *list.List                 // Most recently used first
+	now    func() time.Time
+}
+
+func newLimiter(now func() time.Time) *limiter {
+	return &limiter{states: map[limitKey]*list.Element{}, lru: list.New(), now: now}
+}
+
+var limits = newLimiter(time.Now)
+
+// allow reports whether a record of k may be logged and, if so, how many
+// were dropped since the previous one.
+func (lm *limiter) allow(k limitKey) (suppressed uint64, ok bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	now := lm.now()
+	el := lm.states[k]
+	if el == nil {
+		if lm.lru.Len() >= maxLimitKeys {
+			oldest := lm.lru.Back()
+			delete(lm.states, oldest.Value.(*limitState).key)
+			lm.lru.Remove(oldest)
+		}
+		lm.states[k] = lm.lru.PushFront(&limitState{key: k, last: now})
+		return 0, true
+	}
+	lm.lru.MoveToFront(el)
+	s := el.Value.(*limitState)
+	if k.once || now.Sub(s.last) < k.every {
+		s.suppressed++
+		return 0, false
+	}
+	suppressed = s.suppressed
+	s.last, s.suppressed = now, 0
+	return suppressed, true
+}
@@ -0,0 +1,103 @@
+package echo
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useLimiter replaces the limiter's state and clock for a test.
+func useLimiter(t *testing.T, now *time.Time) {
+	saved := limits
+	limits = newLimiter(func() time.Time { return *now })
+	t.Cleanup(func() { limits = saved })
+}
+
+func TestLimitedLogger(t *testing.T) {
+	now := time.Now()
+	useLimiter(t, &now)
+	var got []Entry
+	logger := slog.New(NewEntryHandler(func(e Entry) error {
+		got = append(got, e)
+		return nil
+	}, &slog.HandlerOptions{AddSource: true}))
+
+	for i := range 5 {
+		Once(logger).Warn("deprecated", "i", i)
+		Every(logger, time.Minute).Info("busy", "i", i)
+		Every(logger, time.Minute).Debug("disabled")
+		now = now.Add(20 * time.Second)
+	}
+	// 0s: both; 20s, 40s: dropped; 60s: busy, suppressing 2; 80s: dropped.
+	require.Len(t, got, 3)
+	assert.Equal(t, "deprecated", got[0].Message)
+	assert.True(t, strings.HasSuffix(got[0].Source.File, "limit_test.go"), "The source is the caller's: %s", got[0].Source.File)
+	assert.Equal(t, []slog.Attr{slog.Int("i", 0)}, got[1].Attrs)
+	assert.Equal(t, []slog.Attr{slog.Int("i", 3), slog.Uint64(SuppressedKey, 2)}, got[2].Attrs)
+
+	// Keys are shared across call sites.
+	got = nil
+	Once(logger).Key("config").Warn("a")
+	Once(logger).Key("config").Warn("b")
+	Once(logger).Key("other").Warn("c")
+	assert.Len(t, got, 2)
+}
+
+func TestEveryWithoutInterval(t *testing.T) {
+	now := time.Now()
+	useLimiter(t, &now)
+	var got []Entry
+	logger := slog.New(NewEntryHandler(func(e Entry) error {
+		got = append(got, e)
+		return nil
+	}, nil))
+
+	for i := range 3 {
+		Every(logger, 0).Info("each", "i", i)
+		Every(logger, -time.Second).Info("each", "i", i)
+	}
+	assert.Len(t, got, 6, "Intervals <= 0 do not limit")
+	for _, e := range got {
+		assert.Len(t, e.Attrs, 1, "Nothing is suppressed")
+	}
+	assert.Empty(t, limits.states, "Unlimited records keep no state")
+}
+
+func TestLimiterBounded(t *testing.T) {
+	now := time.Now()
+	useLimiter(t, &now)
+	once := func(key string) bool {
+		_, ok := limits.allow(limitKey{key: key, once: true})
+		return ok
+	}
+	every := func(key string) (uint64, bool) { return limits.allow(limitKey{key: key, every: time.Minute}) }
+	_, _ = every("busy")
+	for i := range maxLimitKeys - 1 {
+		require.True(t, once(fmt.Sprint(i)))
+	}
+	_, ok := every("busy")
+	require.False(t, ok)
+	require.Len(t, limits.states, maxLimitKeys)
+
+	// Full: new keys are still limited, at the cost of the least recently
+	// used state.
+	_, ok = every("new")
+	assert.True(t, ok)
+	_, ok = every("new")
+	assert.False(t, ok, "New keys should be limited")
+	assert.True(t, once("0"), "The least recently used key should be forgotten")
+	assert.False(t, once("0"))
+	assert.False(t, once("2"))
+	assert.Len(t, limits.states, maxLimitKeys)
+
+	// Recently used state is kept.
+	now = now.Add(time.Minute)
+	suppressed, ok := every("busy")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), suppressed)
+}
@@ -0,0 +1,23 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package echo
+
+import (
+	"errors"
+	"os"
+)
+
+// Lock operations accepted by flock.
+const (
+	lockShared = iota
+	lockExclusive
+	lockUnlock
+)
+
+// flockSupported reports whether advisory file locks are available on this platform.
+const flockSupported = false
+
+// flock is not available on this platform; Init rejects FileShared before it is reached.
+func flock(f *os.File, how int) error {
+	return errors.ErrUnsupported
+}
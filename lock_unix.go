@@ -0,0 +1,28 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package echo
+
+import (
+	"os"
+	"syscall"
+)
+
+// Lock operations accepted by flock.
+const (
+	lockShared    = syscall.LOCK_SH
+	lockExclusive = syscall.LOCK_EX
+	lockUnlock    = syscall.LOCK_UN
+)
+
+// flockSupported reports whether advisory file locks are available on this platform.
+const flockSupported = true
+
+// flock applies or removes an advisory lock on f, blocking until it is granted.
+func flock(f *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
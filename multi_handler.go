@@ -2,15 +2,23 @@ package echo
 
 import (
 	"context"
+	"io"
 	"log/slog"
-	"sync"
+	"math"
 )
 
 // multiHandler routes logs to multiple underlying slog handlers.
 // Kept unexported as it's an internal detail of the Init function.
+//
+// Its handlers never change, so it needs no lock. Enabled first compares the
+// level with a lower bound of the levels the handlers enable, computed once
+// from the handlers whose level cannot change, so that disabled calls such as
+// Debug lines in production cost a single comparison whatever the number of
+// outputs. A handler whose level may change, such as one with a
+// slog.LevelVar, disables the shortcut.
 type multiHandler struct {
 	handlers []slog.Handler
-	mu       sync.RWMutex
+	floor    int64 // No handler enables a level below it
 }
 
 // newMultiHandler creates a handler that delegates to the provided handlers.
@@ -19,15 +27,53 @@ func newMultiHandler(handlers ...slog.Handler) slog.Handler {
 	// Defensive copy
 	h := make([]slog.Handler, len(handlers))
 	copy(h, handlers)
-	return &multiHandler{
+	m := &multiHandler{
 		handlers: h,
+		floor:    math.MaxInt64,
 	}
+	for _, h := range m.handlers {
+		m.floor = min(m.floor, handlerMinLevel(h))
+	}
+	return m
+}
+
+// minLeveler is implemented by handlers that can bound the levels they
+// enable, whatever the context and for as long as they are used.
+type minLeveler interface {
+	// minLevel returns a level below which the handler never enables a
+	// record, or math.MinInt64 if there is none.
+	minLevel() int64
+}
+
+// handlerMinLevel returns the level below which h never enables a record,
+// or math.MinInt64 if it cannot tell.
+func handlerMinLevel(h slog.Handler) int64 {
+	if ml, ok := h.(minLeveler); ok {
+		return ml.minLevel()
+	}
+	return math.MinInt64
+}
+
+// staticMinLevel returns the minimum level given by l, the Level of a
+// handler's options, if it cannot change: it is nil (Info) or a slog.Level.
+// Other Levelers, such as *slog.LevelVar, give math.MinInt64.
+func staticMinLevel(l slog.Leveler) int64 {
+	switch l := l.(type) {
+	case nil:
+		return int64(LevelInfo)
+	case slog.Level:
+		return int64(l)
+	}
+	return math.MinInt64
 }
 
+func (m *multiHandler) minLevel() int64 { return m.floor }
+
 // Enabled reports whether the handler handles records at the given level.
 func (m *multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	if int64(level) < m.floor {
+		return false // Fast path: no handler enables it
+	}
 	for _, h := range m.handlers {
 		if h.Enabled(ctx, level) {
 			return true // Enabled if any underlying handler is enabled
@@ -38,16 +84,14 @@ func (m *multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
 
 // Handle forwards the log record to all underlying handlers that are enabled for the record's level.
 func (m *multiHandler) Handle(ctx context.Context, record slog.Record) error {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
 	var firstErr error
-	// Create the record clone once outside the loop
-	clonedRecord := record.Clone()
+	// The record is passed as is: handlers that modify or retain a record must
+	// Clone it themselves, as slog requires, so cloning here would only cost
+	// an allocation per record.
 	for _, h := range m.handlers {
 		// Crucial check: only Handle if the specific handler is Enabled for this level
 		if h.Enabled(ctx, record.Level) {
-			// Pass the cloned record to prevent potential issues if a handler modifies it
-			if err := h.Handle(ctx, clonedRecord); err != nil && firstErr == nil {
+			if err := h.Handle(ctx, record); err != nil && firstErr == nil {
 				firstErr = err // Capture the first error encountered
 			}
 		}
@@ -56,15 +100,14 @@ func (m *multiHandler) Handle(ctx context.Context, record slog.Record) error {
 }
 
 // WithAttrs returns a new multiHandler whose underlying handlers are updated with the given attributes.
+// It keeps the minimum level, which attributes do not change.
 func (m *multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
 	newHandlers := make([]slog.Handler, len(m.handlers))
 	for i, h := range m.handlers {
 		newHandlers[i] = h.WithAttrs(attrs)
 	}
 	// Return a new multiHandler with the updated underlying handlers
-	return &multiHandler{handlers: newHandlers}
+	return &multiHandler{handlers: newHandlers, floor: m.floor}
 }
 
 // WithGroup returns a new multiHandler whose underlying handlers are updated with the given group name.
@@ -72,12 +115,92 @@ func (m *multiHandler) WithGroup(name string) slog.Handler {
 	// Optimization: If the name is empty, slog handlers should return themselves.
 	// If all handlers do this, we can return the original multiHandler.
 	// However, creating a new one consistently is simpler and safer.
-	m.mu.RLock()
-	defer m.mu.RUnlock()
 	newHandlers := make([]slog.Handler, len(m.handlers))
 	for i, h := range m.handlers {
 		newHandlers[i] = h.WithGroup(name)
 	}
 	// Return a new multiHandler with the updated underlying handlers
-	return &multiHandler{handlers: newHandlers}
+	return &multiHandler{handlers: newHandlers, floor: m.floor}
+}
+
+// output is a destination of Init's records, before its handler is built.
+type output struct {
+	format string // As returned by canonicalFormat
+	opts   *slog.HandlerOptions
+	w      io.Writer
+}
+
+// newOutputHandlers returns the handlers writing to outputs. Outputs with the
+// same format and options share a handler writing to all of their writers,
+// so that a record is encoded once rather than once per output; others get
+// their own handler. Handlers are in the order of their first output.
+func newOutputHandlers(outputs []output) []slog.Handler {
+	type key struct {
+		format string
+		opts   *slog.HandlerOptions
+	}
+	var keys []key
+	writers := map[key]fanoutWriter{}
+	for _, o := range outputs {
+		k := key{o.format, o.opts}
+		if _, ok := writers[k]; !ok {
+			keys = append(keys, k)
+		}
+		writers[k] = append(writers[k], o.w)
+	}
+	handlers := make([]slog.Handler, 0, len(keys))
+	for _, k := range keys {
+		var w io.Writer = writers[k]
+		if len(writers[k]) == 1 {
+			w = writers[k][0]
+		}
+		h, err := NewFormatHandler(k.format, w, k.opts)
+		if err != nil {
+			panic(err) // Formats are canonical
+		}
+		if _, ok := h.(minLeveler); !ok {
+			var level slog.Leveler
+			if k.opts != nil {
+				level = k.opts.Level
+			}
+			h = leveledHandler{h, staticMinLevel(level)}
+		}
+		handlers = append(handlers, h)
+	}
+	return handlers
+}
+
+// leveledHandler gives a handler built from known options, such as slog's
+// TextHandler, the minimum level of those options.
+type leveledHandler struct {
+	slog.Handler
+	level int64
+}
+
+func (h leveledHandler) minLevel() int64 { return h.level }
+
+func (h leveledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return leveledHandler{h.Handler.WithAttrs(attrs), h.level}
+}
+
+func (h leveledHandler) WithGroup(name string) slog.Handler {
+	return leveledHandler{h.Handler.WithGroup(name), h.level}
+}
+
+// fanoutWriter writes the same bytes to several writers. Unlike
+// io.MultiWriter, a failing writer does not keep the others from being
+// written to; the first error is returned.
+type fanoutWriter []io.Writer
+
+func (f fanoutWriter) Write(p []byte) (int, error) {
+	var firstErr error
+	for _, w := range f {
+		if _, err := w.Write(p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	return len(p), nil
 }
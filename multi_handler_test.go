@@ -1,9 +1,13 @@
 package echo
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"slices"
 	"sync"
 	"testing"
@@ -298,3 +302,103 @@ func TestMultiHandlerWithGroup(t *testing.T) {
 	// We mainly care that it doesn't panic and subsequent calls work.
 	assert.NotSame(t, multiWithGroup, multiWithEmptyGroup, "WithGroup(\"\") should return a new handler instance based on mock")
 }
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
+
+func TestOutputHandlersShareEncoding(t *testing.T) {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var console, file, text, other bytes.Buffer
+	handlers := newOutputHandlers([]output{
+		{format: "json", opts: opts, w: &console},
+		{format: "text", opts: opts, w: &text},
+		{format: "json", opts: opts, w: &file},
+		{format: "json", opts: &slog.HandlerOptions{AddSource: true}, w: &other},
+	})
+	require.Len(t, handlers, 3, "Outputs with the same format and options share a handler")
+
+	multi := newMultiHandler(handlers...)
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, "shared", 0)
+	require.NoError(t, multi.Handle(context.Background(), record))
+	assert.Contains(t, console.String(), `"msg":"shared"`)
+	assert.Equal(t, console.String(), file.String())
+	assert.Contains(t, text.String(), "msg=shared")
+	assert.Contains(t, other.String(), `"msg":"shared"`)
+
+	// A failing writer does not keep the others from being written.
+	console.Reset()
+	h := newOutputHandlers([]output{{format: "json", opts: opts, w: failingWriter{}}, {format: "json", opts: opts, w: &console}})[0]
+	assert.EqualError(t, h.Handle(context.Background(), record), "write failed")
+	assert.Contains(t, console.String(), `"msg":"shared"`)
+}
+
+func TestMultiHandlerMinLevel(t *testing.T) {
+	ctx := context.Background()
+	var extra slog.LevelVar
+	extra.Set(slog.LevelError)
+	text := newOutputHandlers([]output{{format: "text", opts: &slog.HandlerOptions{Level: slog.LevelWarn}, w: io.Discard}})[0]
+	assert.Equal(t, int64(slog.LevelWarn), handlerMinLevel(newJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	assert.Equal(t, int64(slog.LevelInfo), handlerMinLevel(NewEntryHandler(func(Entry) error { return nil }, nil)))
+	assert.Equal(t, int64(slog.LevelWarn), handlerMinLevel(text.WithAttrs([]slog.Attr{slog.Int("n", 1)}).WithGroup("g")))
+	assert.Equal(t, int64(math.MinInt64), handlerMinLevel(newJSONHandler(io.Discard, &slog.HandlerOptions{Level: &extra})),
+		"A LevelVar may change")
+	assert.Equal(t, int64(math.MinInt64), handlerMinLevel(newMockHandler(slog.LevelWarn)),
+		"The level of other handlers may change or depend on the context")
+
+	static := newMultiHandler(newJSONHandler(io.Discard, nil), text)
+	assert.Equal(t, int64(slog.LevelInfo), static.(*multiHandler).floor)
+	assert.False(t, static.WithGroup("g").Enabled(ctx, slog.LevelDebug))
+	assert.True(t, static.WithGroup("g").Enabled(ctx, slog.LevelInfo))
+
+	// Lowering a LevelVar takes effect at once, in derived handlers too.
+	multi := newMultiHandler(newJSONHandler(io.Discard, nil), newJSONHandler(io.Discard, &slog.HandlerOptions{Level: &extra}))
+	derived := multi.WithAttrs([]slog.Attr{slog.Int("n", 1)}).WithGroup("g")
+	assert.False(t, derived.Enabled(ctx, slog.LevelDebug))
+	extra.Set(slog.LevelDebug)
+	assert.True(t, derived.Enabled(ctx, slog.LevelDebug))
+
+	// A guard restricting its output while space is low does not raise the
+	// minimum level.
+	free := uint64(0)
+	now := time.Now()
+	guarded := newDiskGuardHandler(newJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug}), "/var/log/app", 1000, "stop")
+	guarded.guard.freeSpace = func(string) (uint64, error) { return free, nil }
+	guarded.guard.now = func() time.Time { return now }
+	guarded.guard.check(ctx)
+	require.False(t, guarded.Enabled(ctx, slog.LevelError))
+	multi = newMultiHandler(guarded, newJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	assert.Equal(t, int64(slog.LevelDebug), multi.(*multiHandler).floor)
+	assert.False(t, multi.Enabled(ctx, slog.LevelInfo))
+	free = 5000
+	now = now.Add(2 * diskCheckInterval)
+	assert.True(t, multi.Enabled(ctx, slog.LevelInfo), "Info is enabled again once space recovers")
+}
+
+func BenchmarkMultiHandlerEnabled(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range []int{1, 3, 10} {
+		handlers := make([]slog.Handler, n)
+		for i := range handlers {
+			handlers[i] = newJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelInfo})
+		}
+		multi := newMultiHandler(handlers...)
+		b.Run(fmt.Sprintf("disabled/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				multi.Enabled(ctx, slog.LevelDebug)
+			}
+		})
+		b.Run(fmt.Sprintf("enabled/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				multi.Enabled(ctx, slog.LevelInfo)
+			}
+		})
+		logger := slog.New(multi)
+		b.Run(fmt.Sprintf("debug/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				logger.Debug("disabled", "n", i)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package echo
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSlowThreshold is the duration after which an operation is logged
+// as slow, unless set with Op.SlowAfter.
+const DefaultSlowThreshold = time.Second
+
+// Op is an operation started by Start, logged when it ends. Operations
+// started with the context of another are its children, so that the
+// operations of a request form a tree in the logs, linked by their IDs.
+type Op struct {
+	logger *slog.Logger
+	ctx    context.Context // Carries the Op, for children
+	name   string
+	id     string
+	parent string
+	start  time.Time
+	args   []any
+	slow   time.Duration
+	ended  atomic.Bool
+}
+
+type opKey struct{}
+
+// Start starts the operation name, to be ended with End. args are added to
+// its record, as for slog.Logger.Info. The record is logged with the
+// default logger at the time Start is called.
+//
+//	op := echo.Start(ctx, "charge", "order", id)
+//	err := charge(op.Context(), order)
+//	op.End(err)
+func Start(ctx context.Context, name string, args ...any) *Op {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	op := &Op{
+		logger: slog.Default(),
+		name:   name,
+		id:     strconv.FormatUint(rand.Uint64(), 16),
+		start:  time.Now(),
+		args:   args,
+		slow:   DefaultSlowThreshold,
+	}
+	if parent, ok := ctx.Value(opKey{}).(*Op); ok {
+		op.parent = parent.id
+	}
+	op.ctx = context.WithValue(ctx, opKey{}, op)
+	return op
+}
+
+// ID returns the ID of op, logged as "op_id" by op and as "parent_op_id" by
+// its children.
+func (op *Op) ID() string {
+	return op.id
+}
+
+// Context returns a context carrying op, for its children.
+func (op *Op) Context() context.Context {
+	return op.ctx
+}
+
+// SlowAfter sets the duration after which op is logged as slow, and returns
+// op.
+func (op *Op) SlowAfter(d time.Duration) *Op {
+	op.slow = d
+	return op
+}
+
+// End logs op with its duration and outcome: at Info if it succeeded, at
+// Warn if it took longer than its slow threshold, and at Error with err if
+// err is not nil. Only the first call logs.
+func (op *Op) End(err error) {
+	if op.ended.Swap(true) {
+		return
+	}
+	d := time.Since(op.start)
+	level, outcome := LevelInfo, "ok"
+	switch {
+	case err != nil:
+		level, outcome = LevelError, "error"
+	case d > op.slow:
+		level, outcome = LevelWarn, "slow"
+	}
+	if !op.logger.Enabled(op.ctx, level) {
+		return
+	}
+
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:]) // Skip runtime.Callers and End
+	r := slog.NewRecord(time.Now(), level, op.name, pcs[0])
+	r.AddAttrs(slog.String("op", op.name), slog.String("op_id", op.id))
+	if op.parent != "" {
+		r.AddAttrs(slog.String("parent_op_id", op.parent))
+	}
+	r.AddAttrs(slog.Duration("duration", d), slog.String("outcome", outcome), ErrAttr(err))
+	r.Add(op.args...)
+	_ = op.logger.Handler().Handle(op.ctx, r)
+}
@@ -0,0 +1,65 @@
+package echo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attrMap returns the top-level attributes of e by key.
+func attrMap(e Entry) map[string]slog.Value {
+	m := map[string]slog.Value{}
+	for _, a := range e.Attrs {
+		m[a.Key] = a.Value
+	}
+	return m
+}
+
+func TestOp(t *testing.T) {
+	var got []Entry
+	h := NewEntryHandler(func(e Entry) error {
+		got = append(got, e)
+		return nil
+	}, &slog.HandlerOptions{AddSource: true})
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(h))
+
+	req := Start(context.Background(), "request", "path", "/x")
+	db := Start(req.Context(), "query").SlowAfter(-1)
+	charge := Start(req.Context(), "charge")
+	db.End(nil)
+	charge.End(errors.New("declined"))
+	charge.End(nil)
+	req.End(nil)
+
+	require.Len(t, got, 3, "Ops are logged once, when they end")
+	query, failed, root := attrMap(got[0]), attrMap(got[1]), attrMap(got[2])
+
+	assert.Equal(t, "query", got[0].Message)
+	assert.Equal(t, LevelWarn, got[0].Level, "Slow ops are escalated to Warn")
+	assert.Equal(t, "slow", query["outcome"].String())
+	assert.Equal(t, req.ID(), query["parent_op_id"].String())
+	assert.Equal(t, db.ID(), query["op_id"].String())
+	assert.NotEqual(t, db.ID(), charge.ID())
+	require.NotNil(t, got[0].Source)
+	assert.True(t, strings.HasSuffix(got[0].Source.File, "op_test.go"), "The source is the caller of End: %s", got[0].Source.File)
+
+	assert.Equal(t, LevelError, got[1].Level, "Failed ops are escalated to Error")
+	assert.Equal(t, "error", failed["outcome"].String())
+	assert.Equal(t, "declined", failed["error"].String())
+	assert.Equal(t, req.ID(), failed["parent_op_id"].String())
+
+	assert.Equal(t, LevelInfo, got[2].Level)
+	assert.Equal(t, "ok", root["outcome"].String())
+	assert.Equal(t, "/x", root["path"].String())
+	assert.NotContains(t, root, "parent_op_id")
+	assert.NotContains(t, root, "error")
+	assert.Equal(t, slog.KindDuration, root["duration"].Kind())
+	assert.Greater(t, root["duration"].Duration(), time.Duration(0))
+}
@@ -0,0 +1,156 @@
+package echo
+
+import (
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+)
+
+// otlpScope is the instrumentation scope name of the "otlp" format's logs.
+const otlpScope = "echo"
+
+// newOTLPHandler returns a handler writing records to w in the OTLP JSON
+// encoding, one ExportLogsServiceRequest per line, as the OpenTelemetry
+// Collector's file exporter writes and its otlpjson receivers read. Levels
+// map to severity numbers as in the OpenTelemetry slog bridge (Info is 9),
+// the source goes in the "code.*" semantic convention attributes, groups
+// become key-value lists, times strings and durations nanoseconds.
+func newOTLPHandler(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	return newEntryWriter(w, appendOTLPEntry, opts)
+}
+
+func appendOTLPEntry(b []byte, e Entry) []byte {
+	b = append(b, `{"resourceLogs":[{"resource":{},"scopeLogs":[{"scope":{"name":`...)
+	b = appendJSONString(b, otlpScope)
+	b = append(b, `},"logRecords":[{`...)
+	if !e.Time.IsZero() {
+		b = append(b, `"timeUnixNano":"`...)
+		b = strconv.AppendInt(b, e.Time.UnixNano(), 10)
+		b = append(b, `",`...)
+	}
+	b = append(b, `"severityNumber":`...)
+	b = strconv.AppendInt(b, int64(otlpSeverity(e.Level)), 10)
+	b = append(b, `,"severityText":`...)
+	b = appendJSONString(b, e.Level.String())
+	b = append(b, `,"body":{"stringValue":`...)
+	b = appendJSONString(b, e.Message)
+	b = append(b, '}')
+
+	attrs := e.Attrs
+	if e.Source != nil {
+		var code []slog.Attr
+		if e.Source.File != "" {
+			code = append(code, slog.String("code.file.path", e.Source.File))
+		}
+		if e.Source.Line != 0 {
+			code = append(code, slog.Int("code.line.number", e.Source.Line))
+		}
+		if e.Source.Function != "" {
+			code = append(code, slog.String("code.function.name", e.Source.Function))
+		}
+		attrs = append(code, attrs...)
+	}
+	if len(attrs) > 0 {
+		b = append(b, `,"attributes":`...)
+		b = appendOTLPKeyValues(b, attrs)
+	}
+	return append(b, "}]}]}]}\n"...)
+}
+
+// otlpSeverity returns the OpenTelemetry severity number of level: 5 for
+// Debug, 9 for Info, 13 for Warn and 17 for Error, clamped to 1-24.
+func otlpSeverity(level slog.Level) int {
+	return min(max(int(level)+9, 1), 24)
+}
+
+// appendOTLPKeyValues appends attrs as an array of OTLP KeyValues.
+func appendOTLPKeyValues(b []byte, attrs []slog.Attr) []byte {
+	b = append(b, '[')
+	for i, a := range attrs {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, `{"key":`...)
+		b = appendJSONString(b, a.Key)
+		b = append(b, `,"value":`...)
+		b = appendOTLPValue(b, a.Value)
+		b = append(b, '}')
+	}
+	return append(b, ']')
+}
+
+// appendOTLPValue appends v as an OTLP AnyValue. 64-bit integers are
+// strings, as in the protobuf JSON mapping; values of kind Any other than
+// slices and nil are strings, errors of their text and others of their JSON
+// encoding.
+func appendOTLPValue(b []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindString:
+		b = append(b, `{"stringValue":`...)
+		b = appendJSONString(b, v.String())
+	case slog.KindInt64:
+		b = append(b, `{"intValue":"`...)
+		b = strconv.AppendInt(b, v.Int64(), 10)
+		b = append(b, '"')
+	case slog.KindUint64:
+		if n := v.Uint64(); n <= math.MaxInt64 {
+			b = append(b, `{"intValue":"`...)
+			b = strconv.AppendUint(b, n, 10)
+			b = append(b, '"')
+		} else {
+			b = append(b, `{"stringValue":"`...)
+			b = strconv.AppendUint(b, n, 10)
+			b = append(b, '"')
+		}
+	case slog.KindFloat64:
+		b = append(b, `{"doubleValue":`...)
+		switch f := v.Float64(); {
+		case math.IsNaN(f):
+			b = append(b, `"NaN"`...)
+		case math.IsInf(f, 1):
+			b = append(b, `"Infinity"`...)
+		case math.IsInf(f, -1):
+			b = append(b, `"-Infinity"`...)
+		default:
+			b = appendJSONFloat(b, f)
+		}
+	case slog.KindBool:
+		b = append(b, `{"boolValue":`...)
+		b = strconv.AppendBool(b, v.Bool())
+	case slog.KindDuration:
+		b = append(b, `{"intValue":"`...)
+		b = strconv.AppendInt(b, int64(v.Duration()), 10)
+		b = append(b, '"')
+	case slog.KindTime:
+		b = append(b, `{"stringValue":`...)
+		b = appendJSONString(b, v.Time().Format(time.RFC3339Nano))
+	case slog.KindGroup:
+		b = append(b, `{"kvlistValue":{"values":`...)
+		b = appendOTLPKeyValues(b, v.Group())
+		b = append(b, '}')
+	default:
+		switch x := v.Any().(type) {
+		case nil:
+			return append(b, '{', '}')
+		case []any:
+			b = append(b, `{"arrayValue":{"values":[`...)
+			for i, elem := range x {
+				if i > 0 {
+					b = append(b, ',')
+				}
+				b = appendOTLPValue(b, slog.AnyValue(elem).Resolve())
+			}
+			b = append(b, ']', '}')
+		default:
+			b = append(b, `{"stringValue":`...)
+			if enc := appendJSONAny(nil, x); len(enc) > 0 && enc[0] == '"' {
+				b = append(b, enc...)
+			} else {
+				b = appendJSONString(b, string(enc))
+			}
+		}
+	}
+	return append(b, '}')
+}
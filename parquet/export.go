@@ -0,0 +1,313 @@
+// Package parquet exports echo log files to Parquet, for analysis with
+// columnar tools such as DuckDB, Spark or pandas. It is pure Go: the
+// writer implements the subset of the format it needs, flat schemas of
+// optional columns in Snappy-compressed data pages.
+//
+// Export reads the files twice. The first pass infers the schema: the
+// attributes found in at least Options.MinFrequency of the entries, as
+// dotted paths such as "http.status", become columns typed after their
+// values, and the others are kept in an attrs column as a JSON object. The
+// second pass writes a file per day, in Hive-style partition directories:
+//
+//	out/date=2024-05-01/logs.parquet
+//	out/date=2024-05-02/logs.parquet
+//
+// which can be queried together, e.g. in DuckDB with
+// read_parquet('out/*/*.parquet', hive_partitioning = true).
+//
+// All files of an export share the same schema. A Writer can also be used
+// directly with a Schema of one's own.
+package parquet
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+)
+
+const (
+	// DefaultMinFrequency is the share of entries an attribute must be
+	// found in to get a column, when Options.MinFrequency is not set.
+	DefaultMinFrequency = 0.5
+	// DefaultMaxColumns bounds the number of attribute columns when
+	// Options.MaxColumns is not set.
+	DefaultMaxColumns = 50
+
+	// FileName is the name of the file written in each partition.
+	FileName = "logs.parquet"
+	// NoDate is the partition of entries without a time, the name Hive
+	// gives to null partition values.
+	NoDate = "__HIVE_DEFAULT_PARTITION__"
+)
+
+// Options configures schema inference and export. The zero value uses the
+// defaults.
+type Options struct {
+	// MinFrequency is the share of entries, between 0 and 1, an attribute
+	// must be found in to get a column. Defaults to DefaultMinFrequency.
+	MinFrequency float64
+	// MaxColumns bounds the number of attribute columns; the most frequent
+	// attributes are kept. Defaults to DefaultMaxColumns.
+	MaxColumns int
+	// RowGroupSize is the number of rows per row group. Defaults to
+	// DefaultRowGroupSize.
+	RowGroupSize int
+	// Location is the time zone of partition dates. Defaults to UTC.
+	Location *time.Location
+	// ReaderOptions are used to read the files, e.g. to decrypt them.
+	ReaderOptions *echo.ReaderOptions
+	// OnParseError, if set, is called for each line that could not be
+	// parsed. Such lines are skipped.
+	OnParseError func(*echo.ParseError)
+}
+
+// Partition is a file written by Export.
+type Partition struct {
+	Date string // YYYY-MM-DD, or NoDate
+	Path string
+	Rows int64
+}
+
+// reserved are the names of the fixed columns, which attributes cannot
+// take.
+var reserved = map[string]bool{"time": true, "level": true, "msg": true, "source": true, "attrs": true}
+
+// attrStats records how often an attribute is found and the kinds of its
+// values.
+type attrStats struct {
+	count int
+	kinds map[slog.Kind]bool
+}
+
+// InferSchema reads the files at paths and returns the schema Export would
+// use for them.
+func InferSchema(paths []string, opts *Options) (*Schema, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	stats := map[string]*attrStats{}
+	entries := 0
+	err := readAll(paths, opts, func(e echo.Entry) error {
+		entries++
+		seen := map[string]bool{}
+		var walk func(prefix string, attrs []slog.Attr)
+		walk = func(prefix string, attrs []slog.Attr) {
+			for _, a := range attrs {
+				path := prefix + a.Key
+				if a.Value.Kind() == slog.KindGroup {
+					walk(path+".", a.Value.Group())
+					continue
+				}
+				if a.Value.Kind() == slog.KindAny && a.Value.Any() == nil {
+					continue // JSON null
+				}
+				s := stats[path]
+				if s == nil {
+					s = &attrStats{kinds: map[slog.Kind]bool{}}
+					stats[path] = s
+				}
+				if !seen[path] {
+					seen[path] = true
+					s.count++
+				}
+				s.kinds[a.Value.Kind()] = true
+			}
+		}
+		walk("", e.Attrs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buildSchema(stats, entries, opts), nil
+}
+
+// buildSchema promotes the frequent attributes of scalar types to columns.
+func buildSchema(stats map[string]*attrStats, entries int, opts *Options) *Schema {
+	minFreq := cmp.Or(opts.MinFrequency, DefaultMinFrequency)
+	maxCols := cmp.Or(opts.MaxColumns, DefaultMaxColumns)
+	var cols []Column
+	counts := map[string]int{}
+	for path, s := range stats {
+		t, ok := columnType(s.kinds)
+		if !ok || reserved[path] || float64(s.count) < minFreq*float64(entries) {
+			continue
+		}
+		cols = append(cols, Column{Name: path, Type: t})
+		counts[path] = s.count
+	}
+	slices.SortFunc(cols, func(a, b Column) int {
+		return cmp.Or(cmp.Compare(counts[b.Name], counts[a.Name]), cmp.Compare(a.Name, b.Name))
+	})
+	cols = cols[:min(len(cols), maxCols)]
+	slices.SortFunc(cols, func(a, b Column) int { return cmp.Compare(a.Name, b.Name) })
+	return &Schema{Attrs: cols}
+}
+
+// columnType returns the type of a column holding values of these kinds.
+// Integers and floats make doubles, and other mixes strings; attributes
+// with values such as arrays have no column.
+func columnType(kinds map[slog.Kind]bool) (Type, bool) {
+	var types []Type
+	for k := range kinds {
+		switch k {
+		case slog.KindString:
+			types = append(types, String)
+		case slog.KindInt64, slog.KindUint64, slog.KindDuration:
+			types = append(types, Int64)
+		case slog.KindFloat64:
+			types = append(types, Double)
+		case slog.KindBool:
+			types = append(types, Bool)
+		case slog.KindTime:
+			types = append(types, Timestamp)
+		default:
+			return 0, false
+		}
+	}
+	slices.Sort(types)
+	types = slices.Compact(types)
+	switch {
+	case len(types) == 1:
+		return types[0], true
+	case slices.Equal(types, []Type{Int64, Double}):
+		return Double, true
+	}
+	return String, true
+}
+
+// partition is a partition being written.
+type partition struct {
+	Partition
+	f *os.File
+	w *Writer
+}
+
+// Export writes the entries of the files at paths to Parquet files under
+// dir, one per day, and returns them sorted by date. Existing files of the
+// same partitions are replaced; each is written to a temporary file first
+// and renamed when complete.
+func Export(dir string, paths []string, opts *Options) ([]Partition, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	quiet := *opts
+	quiet.OnParseError = nil // Reported by the second pass
+	schema, err := InferSchema(paths, &quiet)
+	if err != nil {
+		return nil, err
+	}
+	loc := cmp.Or(opts.Location, time.UTC)
+	parts := map[string]*partition{}
+	defer func() {
+		for _, p := range parts {
+			if p.f != nil {
+				p.f.Close()
+				os.Remove(p.f.Name())
+			}
+		}
+	}()
+
+	err = readAll(paths, opts, func(e echo.Entry) error {
+		date := NoDate
+		if !e.Time.IsZero() {
+			date = e.Time.In(loc).Format(time.DateOnly)
+		}
+		p := parts[date]
+		if p == nil {
+			partDir := filepath.Join(dir, "date="+date)
+			if err := os.MkdirAll(partDir, 0o755); err != nil {
+				return err
+			}
+			f, err := os.CreateTemp(partDir, "."+FileName+"-*")
+			if err != nil {
+				return err
+			}
+			p = &partition{Partition: Partition{Date: date, Path: filepath.Join(partDir, FileName)}, f: f}
+			p.w = NewWriter(f, schema, opts)
+			parts[date] = p
+		}
+		p.Rows++
+		return p.w.Write(e)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Partition
+	for _, p := range parts {
+		if err := p.finish(); err != nil {
+			return nil, err
+		}
+		done = append(done, p.Partition)
+	}
+	slices.SortFunc(done, func(a, b Partition) int { return cmp.Compare(a.Date, b.Date) })
+	return done, nil
+}
+
+// finish completes the file of p and moves it into place.
+func (p *partition) finish() error {
+	err := p.w.Close()
+	if err == nil {
+		err = p.f.Chmod(0o644) // Temporary files are private
+	}
+	if err == nil {
+		err = p.f.Sync()
+	}
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(p.f.Name(), p.Path)
+	}
+	if err != nil {
+		os.Remove(p.f.Name())
+	}
+	p.f = nil
+	return err
+}
+
+// readAll calls fn for every entry of the files at paths, in order.
+func readAll(paths []string, opts *Options, fn func(echo.Entry) error) error {
+	for _, path := range paths {
+		rd, err := echo.OpenFile(path, opts.ReaderOptions)
+		if err != nil {
+			return err
+		}
+		err = drain(rd, opts, fn)
+		rd.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func drain(rd *echo.Reader, opts *Options, fn func(echo.Entry) error) error {
+	for {
+		e, err := rd.Next()
+		var perr *echo.ParseError
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case errors.As(err, &perr):
+			if opts.OnParseError != nil {
+				opts.OnParseError(perr)
+			}
+			continue
+		case err != nil:
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
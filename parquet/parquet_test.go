@@ -0,0 +1,293 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/klauspost/compress/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A minimal reader of the files Writer writes, to check them.
+
+type tstruct map[int16]any
+
+type decoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *decoder) varint() uint64 {
+	v, n := binary.Uvarint(d.b[d.pos:])
+	d.pos += n
+	return v
+}
+
+func (d *decoder) zigzag() int64 {
+	v := d.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *decoder) value(typ byte) any {
+	switch typ {
+	case tI32, tI64:
+		return d.zigzag()
+	case tBinary:
+		n := int(d.varint())
+		d.pos += n
+		return d.b[d.pos-n : d.pos]
+	case tList:
+		hdr := d.b[d.pos]
+		d.pos++
+		n := int(hdr >> 4)
+		if n == 15 {
+			n = int(d.varint())
+		}
+		list := []any{}
+		for i := 0; i < n; i++ {
+			list = append(list, d.value(hdr&0x0f))
+		}
+		return list
+	case tStruct:
+		return d.structure()
+	}
+	panic(fmt.Sprintf("type %d", typ))
+}
+
+func (d *decoder) structure() tstruct {
+	s := tstruct{}
+	var last int16
+	for {
+		hdr := d.b[d.pos]
+		d.pos++
+		if hdr == 0 {
+			return s
+		}
+		typ := hdr & 0x0f
+		if delta := int16(hdr >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(d.zigzag())
+		}
+		switch typ {
+		case tBoolTrue:
+			s[last] = true
+		case tBoolFalse:
+			s[last] = false
+		default:
+			s[last] = d.value(typ)
+		}
+	}
+}
+
+// readFile returns the metadata of the file at path and its rows as maps
+// from column names to values, without the nulls.
+func readFile(t *testing.T, path string) (tstruct, []map[string]any) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, magic, string(data[:4]))
+	require.Equal(t, magic, string(data[len(data)-4:]))
+	n := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	d := &decoder{b: data[len(data)-8-n : len(data)-8]}
+	meta := d.structure()
+	require.Equal(t, n, d.pos)
+
+	var rows []map[string]any
+	for _, g := range meta[4].([]any) {
+		first := len(rows)
+		for i := int64(0); i < g.(tstruct)[3].(int64); i++ {
+			rows = append(rows, map[string]any{})
+		}
+		for _, ch := range g.(tstruct)[1].([]any) {
+			cm := ch.(tstruct)[3].(tstruct)
+			name := string(cm[3].([]any)[0].([]byte))
+			d := &decoder{b: data, pos: int(cm[9].(int64))}
+			hdr := d.structure()
+			body, err := snappy.Decode(nil, data[d.pos:d.pos+int(hdr[3].(int64))])
+			require.NoError(t, err)
+			require.Len(t, body, int(hdr[2].(int64)))
+
+			// Definition levels, as RLE runs.
+			levelsEnd := 4 + int(binary.LittleEndian.Uint32(body))
+			ld := &decoder{b: body[:levelsEnd], pos: 4}
+			var defs []byte
+			for ld.pos < levelsEnd {
+				run := ld.varint()
+				require.Zero(t, run&1, "bit-packed runs are not written")
+				for j := uint64(0); j < run>>1; j++ {
+					defs = append(defs, body[ld.pos])
+				}
+				ld.pos++
+			}
+			values := body[levelsEnd:]
+			bit := 0
+			for j, def := range defs {
+				if def == 0 {
+					continue
+				}
+				var v any
+				switch cm[1].(int64) {
+				case physBoolean:
+					v = values[bit/8]&(1<<(bit%8)) != 0
+					bit++
+				case physInt64:
+					v = int64(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case physDouble:
+					v = math.Float64frombits(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case physByteArray:
+					n := binary.LittleEndian.Uint32(values)
+					v = string(values[4 : 4+n])
+					values = values[4+n:]
+				}
+				rows[first+j][name] = v
+			}
+		}
+	}
+	return meta, rows
+}
+
+func columnNames(meta tstruct) []string {
+	var names []string
+	for _, el := range meta[2].([]any)[1:] {
+		names = append(names, string(el.(tstruct)[4].([]byte)))
+	}
+	return names
+}
+
+func writeJSON(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644))
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "app.log")
+	writeJSON(t, in,
+		`{"time":"2024-05-01T23:59:00Z","level":"INFO","msg":"a","http":{"status":200,"route":"/x"},"dur":1,"ok":true,"user":"ann"}`,
+		`{"time":"2024-05-02T00:00:01.5Z","level":"WARN","msg":"b","http":{"status":503,"route":"/y"},"dur":2.5,"ok":false,"tags":["p","q"]}`,
+		`not json`,
+		`{"time":"2024-05-02T00:01:00Z","level":"ERROR","msg":"c","http":{"status":"n/a"},"dur":3,"ok":true,"tags":[]}`,
+		`{"level":"INFO","msg":"d","time":"2024-05-02T00:02:00Z","http":{"route":"/z"}}`,
+		`{"level":"INFO","msg":"no time"}`,
+	)
+	var perrs int
+	out := filepath.Join(dir, "out")
+	parts, err := Export(out, []string{in}, &Options{OnParseError: func(*echo.ParseError) { perrs++ }})
+	require.NoError(t, err)
+	assert.Equal(t, 1, perrs)
+	assert.Equal(t, []Partition{
+		{Date: "2024-05-01", Path: filepath.Join(out, "date=2024-05-01", FileName), Rows: 1},
+		{Date: "2024-05-02", Path: filepath.Join(out, "date=2024-05-02", FileName), Rows: 3},
+		{Date: NoDate, Path: filepath.Join(out, "date="+NoDate, FileName), Rows: 1},
+	}, parts)
+
+	// Found in at least half of the 5 entries: http.status (int and
+	// string), http.route, ok and dur (int and float); not user or tags.
+	meta, rows := readFile(t, parts[1].Path)
+	assert.Equal(t, []string{"time", "level", "msg", "source", "dur", "http.route", "http.status", "ok", "attrs"}, columnNames(meta))
+	assert.Equal(t, int64(3), meta[3])
+	assert.Equal(t, []map[string]any{
+		{"time": time.Date(2024, 5, 2, 0, 0, 1, 5e8, time.UTC).UnixMicro(), "level": "WARN", "msg": "b",
+			"http.status": "503", "http.route": "/y", "dur": 2.5, "ok": false, "attrs": `{"tags":["p","q"]}`},
+		{"time": time.Date(2024, 5, 2, 0, 1, 0, 0, time.UTC).UnixMicro(), "level": "ERROR", "msg": "c",
+			"http.status": "n/a", "dur": float64(3), "ok": true, "attrs": `{"tags":[]}`},
+		{"time": time.Date(2024, 5, 2, 0, 2, 0, 0, time.UTC).UnixMicro(), "level": "INFO", "msg": "d",
+			"http.route": "/z"},
+	}, rows)
+
+	_, rows = readFile(t, parts[0].Path)
+	assert.Equal(t, float64(1), rows[0]["dur"])
+	assert.Equal(t, `{"user":"ann"}`, rows[0]["attrs"])
+	_, rows = readFile(t, parts[2].Path)
+	assert.Equal(t, []map[string]any{{"level": "INFO", "msg": "no time"}}, rows)
+
+	// The partitions follow the time zone.
+	parts, err = Export(filepath.Join(dir, "tz"), []string{in}, &Options{Location: time.FixedZone("", 3600)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), parts[0].Rows)
+	assert.Equal(t, "2024-05-02", parts[0].Date)
+}
+
+func TestWriterRowGroups(t *testing.T) {
+	schema := &Schema{Attrs: []Column{{"n", Int64}, {"at", Timestamp}}}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, schema, &Options{RowGroupSize: 2})
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		e := echo.Entry{Time: at.Add(time.Duration(i) * time.Second), Level: slog.LevelDebug, Message: fmt.Sprint(i),
+			Attrs: []slog.Attr{slog.Int("n", i), slog.Time("at", at)}}
+		if i == 3 {
+			e.Attrs = []slog.Attr{slog.String("n", "three"), slog.Int("at", 3)}
+		}
+		require.NoError(t, w.Write(e))
+	}
+	require.NoError(t, w.Close())
+	assert.ErrorIs(t, w.Write(echo.Entry{}), errClosed)
+
+	path := filepath.Join(t.TempDir(), "f.parquet")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+	meta, rows := readFile(t, path)
+	groups := meta[4].([]any)
+	require.Len(t, groups, 3)
+	require.Len(t, rows, 5)
+	assert.Equal(t, int64(4), rows[4]["n"])
+	assert.Equal(t, at.UnixMicro(), rows[4]["at"])
+	assert.Equal(t, map[string]any{"time": at.Add(3 * time.Second).UnixMicro(), "level": "DEBUG", "msg": "3",
+		"attrs": `{"n":"three","at":3}`}, rows[3], "Values that do not fit stay in attrs")
+
+	// Statistics of the time column of the second row group.
+	stats := groups[1].(tstruct)[1].([]any)[0].(tstruct)[3].(tstruct)[12].(tstruct)
+	assert.Equal(t, int64(0), stats[3])
+	assert.Equal(t, uint64(at.Add(2*time.Second).UnixMicro()), binary.LittleEndian.Uint64(stats[6].([]byte)))
+	assert.Equal(t, uint64(at.Add(3*time.Second).UnixMicro()), binary.LittleEndian.Uint64(stats[5].([]byte)))
+}
+
+func TestColumnType(t *testing.T) {
+	for _, tt := range []struct {
+		kinds []slog.Kind
+		want  Type
+		ok    bool
+	}{
+		{[]slog.Kind{slog.KindInt64}, Int64, true},
+		{[]slog.Kind{slog.KindInt64, slog.KindDuration}, Int64, true},
+		{[]slog.Kind{slog.KindInt64, slog.KindFloat64}, Double, true},
+		{[]slog.Kind{slog.KindBool, slog.KindFloat64}, String, true},
+		{[]slog.Kind{slog.KindTime}, Timestamp, true},
+		{[]slog.Kind{slog.KindString, slog.KindAny}, 0, false},
+	} {
+		kinds := map[slog.Kind]bool{}
+		for _, k := range tt.kinds {
+			kinds[k] = true
+		}
+		got, ok := columnType(kinds)
+		assert.Equal(t, tt.ok, ok, tt.kinds)
+		assert.Equal(t, tt.want, got, tt.kinds)
+	}
+}
+
+func TestMaxColumns(t *testing.T) {
+	stats := map[string]*attrStats{
+		"a":   {count: 10, kinds: map[slog.Kind]bool{slog.KindInt64: true}},
+		"b":   {count: 6, kinds: map[slog.Kind]bool{slog.KindInt64: true}},
+		"c":   {count: 8, kinds: map[slog.Kind]bool{slog.KindString: true}},
+		"d":   {count: 2, kinds: map[slog.Kind]bool{slog.KindString: true}},
+		"msg": {count: 10, kinds: map[slog.Kind]bool{slog.KindString: true}},
+	}
+	s := buildSchema(stats, 10, &Options{MaxColumns: 2})
+	assert.Equal(t, []Column{{"a", Int64}, {"c", String}}, s.Attrs)
+	s = buildSchema(stats, 10, &Options{MinFrequency: 0.1})
+	assert.Len(t, s.Attrs, 4, "Reserved names get no column")
+}
@@ -0,0 +1,104 @@
+package parquet
+
+import (
+	"encoding/binary"
+)
+
+// Parquet metadata is serialized with Thrift's compact protocol. Only what
+// the writer needs is implemented: structs of integers, booleans, binaries,
+// lists and nested structs.
+
+// Compact protocol types.
+const (
+	tBoolTrue  = 1
+	tBoolFalse = 2
+	tI32       = 5
+	tI64       = 6
+	tBinary    = 8
+	tList      = 9
+	tStruct    = 12
+)
+
+// thriftWriter appends compact protocol encodings to buf. Struct fields
+// must be written in increasing order of their IDs.
+type thriftWriter struct {
+	buf  []byte
+	last []int16 // Last field ID of each open struct
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) begin() { w.last = append(w.last, 0) }
+
+func (w *thriftWriter) end() {
+	w.buf = append(w.buf, 0) // Stop
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, tI32)
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, tI64)
+	w.zigzag(v)
+}
+
+func (w *thriftWriter) bool(id int16, v bool) {
+	if v {
+		w.field(id, tBoolTrue)
+	} else {
+		w.field(id, tBoolFalse)
+	}
+}
+
+func (w *thriftWriter) binary(id int16, b []byte) {
+	w.field(id, tBinary)
+	w.varint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *thriftWriter) string(id int16, s string) { w.binary(id, []byte(s)) }
+
+// structField opens a struct field; fields follow, then end.
+func (w *thriftWriter) structField(id int16) {
+	w.field(id, tStruct)
+	w.begin()
+}
+
+// list writes the header of a list field of n elements of type typ, which
+// follow as values: structs with begin and end, or the values below.
+func (w *thriftWriter) list(id int16, typ byte, n int) {
+	w.field(id, tList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|typ)
+	} else {
+		w.buf = append(w.buf, 0xf0|typ)
+		w.varint(uint64(n))
+	}
+}
+
+func (w *thriftWriter) i32Value(v int32) { w.zigzag(int64(v)) }
+
+func (w *thriftWriter) stringValue(s string) {
+	w.varint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
@@ -0,0 +1,527 @@
+package parquet
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+	"github.com/klauspost/compress/snappy"
+)
+
+// DefaultRowGroupSize is the number of rows per row group when
+// Options.RowGroupSize is not set.
+const DefaultRowGroupSize = 64 << 10
+
+const magic = "PAR1"
+
+// Physical types, repetitions, converted types, encodings and codecs of the
+// Parquet format.
+const (
+	physBoolean   = 0
+	physInt64     = 2
+	physDouble    = 5
+	physByteArray = 6
+
+	repOptional = 1
+
+	convUTF8            = 0
+	convTimestampMicros = 10
+	convJSON            = 19
+
+	encPlain = 0
+	encRLE   = 3
+
+	codecSnappy = 1
+
+	pageData = 0
+)
+
+// Type is the type of a column.
+type Type int
+
+const (
+	String    Type = iota // UTF-8 text
+	Int64                 // 64-bit integers, and durations in nanoseconds
+	Double                // 64-bit floating-point numbers
+	Bool                  // Booleans
+	Timestamp             // Times, in microseconds since the epoch, UTC
+	JSON                  // JSON text
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int64:
+		return "int64"
+	case Double:
+		return "double"
+	case Bool:
+		return "bool"
+	case Timestamp:
+		return "timestamp"
+	case JSON:
+		return "json"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Column is a column of a file. All columns are optional: a row has no
+// value for an attribute the entry does not have.
+type Column struct {
+	// Name is the dotted path of the attribute, such as "http.status", or
+	// one of the fixed columns: time, level, msg, source and attrs.
+	Name string
+	Type Type
+}
+
+// Schema describes the columns of exported files: time, level, msg and
+// source, a column for each of Attrs, and attrs, which holds the other
+// attributes of each entry as a JSON object.
+type Schema struct {
+	Attrs []Column
+}
+
+// Columns returns all the columns, in file order.
+func (s *Schema) Columns() []Column {
+	cols := []Column{{"time", Timestamp}, {"level", String}, {"msg", String}, {"source", String}}
+	cols = append(cols, s.Attrs...)
+	return append(cols, Column{"attrs", JSON})
+}
+
+// column buffers the values of a column for the current row group.
+type column struct {
+	Column
+	defs     []byte // Definition level of each row: 1 if it has a value
+	data     []byte // PLAIN encoding of the values
+	bools    []bool
+	min, max int64 // Of the values of Int64 and Timestamp columns
+	present  int
+}
+
+// chunk is the metadata of a column chunk written.
+type chunk struct {
+	offset             int64
+	values             int
+	uncompressed, size int64
+	stats              []byte // Encoded Statistics, if any
+}
+
+// rowGroup is the metadata of a row group written.
+type rowGroup struct {
+	rows   int
+	chunks []chunk
+}
+
+// Writer writes entries to a Parquet file with a fixed schema. Rows are
+// buffered in memory until a row group is complete; Close writes the last
+// one and the file metadata.
+type Writer struct {
+	w         io.Writer
+	offset    int64
+	schema    *Schema
+	groupSize int
+	cols      []*column
+	attrCols  map[string]int // Column of each promoted attribute
+	rows      int
+	groups    []rowGroup
+	err       error
+
+	rest     []slog.Attr // Attributes not in columns, for the attrs column
+	jsonBuf  bytes.Buffer
+	jsonH    slog.Handler
+	pageBuf  []byte
+	thrift   thriftWriter
+	snappyBf []byte
+}
+
+// NewWriter returns a Writer writing to w. Only Options.RowGroupSize is
+// used; opts may be nil.
+func NewWriter(w io.Writer, schema *Schema, opts *Options) *Writer {
+	wr := &Writer{w: w, schema: schema, groupSize: DefaultRowGroupSize, attrCols: map[string]int{}}
+	if opts != nil && opts.RowGroupSize > 0 {
+		wr.groupSize = opts.RowGroupSize
+	}
+	for i, c := range schema.Columns() {
+		wr.cols = append(wr.cols, &column{Column: c})
+		if i >= 4 && c.Type != JSON {
+			wr.attrCols[c.Name] = i
+		}
+	}
+	// The attrs column is written as slog's JSONHandler writes attributes,
+	// without the built-in keys.
+	wr.jsonH = slog.NewJSONHandler(&wr.jsonBuf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.LevelKey || a.Key == slog.MessageKey) {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	wr.write([]byte(magic))
+	return wr
+}
+
+func (w *Writer) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	w.err = err
+}
+
+// Write adds e as a row. Attribute values that do not fit the type of
+// their column are kept in the attrs column instead.
+func (w *Writer) Write(e echo.Entry) error {
+	if w.err != nil {
+		return w.err
+	}
+	if e.Time.IsZero() {
+		w.cols[0].null()
+	} else {
+		w.cols[0].set(slog.TimeValue(e.Time))
+	}
+	w.cols[1].set(slog.StringValue(e.Level.String()))
+	w.cols[2].set(slog.StringValue(e.Message))
+	if e.Source != nil {
+		w.cols[3].set(slog.StringValue(fmt.Sprintf("%s:%d", e.Source.File, e.Source.Line)))
+	} else {
+		w.cols[3].null()
+	}
+
+	for _, c := range w.cols[4:] {
+		c.defs = append(c.defs, 0) // Set to 1 by split for the values found
+	}
+	w.rest = w.split(w.rest[:0], "", e.Attrs)
+	if len(w.rest) > 0 {
+		w.jsonBuf.Reset()
+		r := slog.NewRecord(time.Time{}, 0, "", 0)
+		r.AddAttrs(w.rest...)
+		if err := w.jsonH.Handle(context.Background(), r); err != nil {
+			return err
+		}
+		c := w.cols[len(w.cols)-1]
+		c.defs[len(c.defs)-1] = 1
+		c.appendBytes(bytes.TrimSuffix(w.jsonBuf.Bytes(), []byte("\n")))
+	}
+
+	w.rows++
+	if w.rows == w.groupSize {
+		w.flush()
+	}
+	return w.err
+}
+
+// split puts the values of attrs that have a column in it, and appends the
+// others to rest, keeping groups that still have attributes.
+func (w *Writer) split(rest []slog.Attr, prefix string, attrs []slog.Attr) []slog.Attr {
+	for _, a := range attrs {
+		path := prefix + a.Key
+		if a.Value.Kind() == slog.KindGroup {
+			if sub := w.split(nil, path+".", a.Value.Group()); len(sub) > 0 {
+				rest = append(rest, slog.Attr{Key: a.Key, Value: slog.GroupValue(sub...)})
+			}
+			continue
+		}
+		if i, ok := w.attrCols[path]; ok && w.cols[i].defs[len(w.cols[i].defs)-1] == 0 && w.cols[i].fill(a.Value) {
+			continue
+		}
+		rest = append(rest, a)
+	}
+	return rest
+}
+
+func (c *column) null() { c.defs = append(c.defs, 0) }
+
+func (c *column) set(v slog.Value) {
+	c.defs = append(c.defs, 0)
+	c.fill(v)
+}
+
+// fill sets the value of the last row to v, and reports whether v fits the
+// type of c.
+func (c *column) fill(v slog.Value) bool {
+	switch c.Type {
+	case String:
+		if v.Kind() == slog.KindAny && v.Any() == nil {
+			return false
+		}
+		c.appendBytes([]byte(cli.ValueString(v)))
+	case Int64, Timestamp:
+		var n int64
+		switch v.Kind() {
+		case slog.KindInt64:
+			n = v.Int64()
+		case slog.KindUint64:
+			if v.Uint64() > math.MaxInt64 {
+				return false
+			}
+			n = int64(v.Uint64())
+		case slog.KindDuration:
+			n = int64(v.Duration())
+		case slog.KindTime:
+			n = v.Time().UnixMicro()
+		default:
+			return false
+		}
+		if (c.Type == Timestamp) != (v.Kind() == slog.KindTime) {
+			return false
+		}
+		if c.present == 0 || n < c.min {
+			c.min = n
+		}
+		if c.present == 0 || n > c.max {
+			c.max = n
+		}
+		c.data = binary.LittleEndian.AppendUint64(c.data, uint64(n))
+	case Double:
+		var f float64
+		switch v.Kind() {
+		case slog.KindFloat64:
+			f = v.Float64()
+		case slog.KindInt64:
+			f = float64(v.Int64())
+		case slog.KindUint64:
+			f = float64(v.Uint64())
+		default:
+			return false
+		}
+		c.data = binary.LittleEndian.AppendUint64(c.data, math.Float64bits(f))
+	case Bool:
+		if v.Kind() != slog.KindBool {
+			return false
+		}
+		c.bools = append(c.bools, v.Bool())
+	default:
+		return false
+	}
+	c.defs[len(c.defs)-1] = 1
+	c.present++
+	return true
+}
+
+func (c *column) appendBytes(b []byte) {
+	c.data = binary.LittleEndian.AppendUint32(c.data, uint32(len(b)))
+	c.data = append(c.data, b...)
+}
+
+// flush writes the buffered rows as a row group, with a single data page
+// per column.
+func (w *Writer) flush() {
+	if w.rows == 0 || w.err != nil {
+		return
+	}
+	g := rowGroup{rows: w.rows}
+	for _, c := range w.cols {
+		// Page body: definition levels, prefixed by their length, then
+		// the values.
+		body := w.pageBuf[:0]
+		body = append(body, 0, 0, 0, 0)
+		body = appendLevels(body, c.defs)
+		binary.LittleEndian.PutUint32(body, uint32(len(body)-4))
+		if c.Type == Bool {
+			body = appendBits(body, c.bools)
+		} else {
+			body = append(body, c.data...)
+		}
+		w.pageBuf = body
+		w.snappyBf = snappy.Encode(w.snappyBf[:cap(w.snappyBf)], body)
+
+		t := &w.thrift
+		t.buf = t.buf[:0]
+		t.begin()
+		t.i32(1, pageData)
+		t.i32(2, int32(len(body)))
+		t.i32(3, int32(len(w.snappyBf)))
+		t.structField(5)
+		t.i32(1, int32(w.rows))
+		t.i32(2, encPlain)
+		t.i32(3, encRLE)
+		t.i32(4, encRLE)
+		t.end()
+		t.end()
+
+		ch := chunk{offset: w.offset, values: w.rows}
+		ch.uncompressed = int64(len(t.buf) + len(body))
+		ch.size = int64(len(t.buf) + len(w.snappyBf))
+		ch.stats = c.stats(w.rows)
+		w.write(t.buf)
+		w.write(w.snappyBf)
+		g.chunks = append(g.chunks, ch)
+
+		c.defs, c.data, c.bools, c.present = c.defs[:0], c.data[:0], c.bools[:0], 0
+	}
+	w.groups = append(w.groups, g)
+	w.rows = 0
+}
+
+// stats returns the encoded Statistics of c: the null count, and the
+// minimum and maximum of integers and timestamps.
+func (c *column) stats(rows int) []byte {
+	var t thriftWriter
+	t.begin()
+	t.i64(3, int64(rows-c.present))
+	if (c.Type == Int64 || c.Type == Timestamp) && c.present > 0 {
+		t.binary(5, binary.LittleEndian.AppendUint64(nil, uint64(c.max)))
+		t.binary(6, binary.LittleEndian.AppendUint64(nil, uint64(c.min)))
+	}
+	t.end()
+	return t.buf
+}
+
+// appendLevels appends the RLE encoding of definition levels, of bit width
+// 1, as runs of equal levels.
+func appendLevels(b []byte, levels []byte) []byte {
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		b = binary.AppendUvarint(b, uint64(j-i)<<1)
+		b = append(b, levels[i])
+		i = j
+	}
+	return b
+}
+
+// appendBits appends the PLAIN encoding of booleans: one bit each, least
+// significant first.
+func appendBits(b []byte, bools []bool) []byte {
+	for i := 0; i < len(bools); i += 8 {
+		var octet byte
+		for j := 0; j < 8 && i+j < len(bools); j++ {
+			if bools[i+j] {
+				octet |= 1 << j
+			}
+		}
+		b = append(b, octet)
+	}
+	return b
+}
+
+// Close writes the remaining rows and the file metadata. It does not close
+// the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.flush()
+
+	var total int64
+	for _, g := range w.groups {
+		total += int64(g.rows)
+	}
+	t := &w.thrift
+	t.buf = t.buf[:0]
+	t.begin()
+	t.i32(1, 1) // Version
+	t.list(2, tStruct, len(w.cols)+1)
+	t.begin()
+	t.string(4, "schema")
+	t.i32(5, int32(len(w.cols)))
+	t.end()
+	for _, c := range w.cols {
+		c.writeSchema(t)
+	}
+	t.i64(3, total)
+	t.list(4, tStruct, len(w.groups))
+	for _, g := range w.groups {
+		t.begin()
+		t.list(1, tStruct, len(g.chunks))
+		var size int64
+		for i, ch := range g.chunks {
+			c := w.cols[i]
+			size += ch.uncompressed
+			t.begin()
+			t.i64(2, ch.offset)
+			t.structField(3)
+			t.i32(1, c.physical())
+			t.list(2, tI32, 2)
+			t.i32Value(encPlain)
+			t.i32Value(encRLE)
+			t.list(3, tBinary, 1)
+			t.stringValue(c.Name)
+			t.i32(4, codecSnappy)
+			t.i64(5, int64(ch.values))
+			t.i64(6, ch.uncompressed)
+			t.i64(7, ch.size)
+			t.i64(9, ch.offset)
+			t.field(12, tStruct)
+			t.buf = append(t.buf, ch.stats...)
+			t.end()
+			t.end()
+		}
+		t.i64(2, size)
+		t.i64(3, int64(g.rows))
+		t.end()
+	}
+	t.string(6, "github.com/altitude-analytics/echo")
+	t.end()
+
+	w.write(t.buf)
+	w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(t.buf))))
+	w.write([]byte(magic))
+	if w.err == nil {
+		w.err = errClosed
+		return nil
+	}
+	return w.err
+}
+
+var errClosed = errors.New("parquet: writer closed")
+
+func (c *column) physical() int32 {
+	switch c.Type {
+	case Int64, Timestamp:
+		return physInt64
+	case Double:
+		return physDouble
+	case Bool:
+		return physBoolean
+	}
+	return physByteArray
+}
+
+// writeSchema writes the SchemaElement of c, with its converted and logical
+// types.
+func (c *column) writeSchema(t *thriftWriter) {
+	t.begin()
+	t.i32(1, c.physical())
+	t.i32(3, repOptional)
+	t.string(4, c.Name)
+	switch c.Type {
+	case String:
+		t.i32(6, convUTF8)
+		t.structField(10)
+		t.structField(1) // STRING
+		t.end()
+		t.end()
+	case Timestamp:
+		t.i32(6, convTimestampMicros)
+		t.structField(10)
+		t.structField(8) // TIMESTAMP
+		t.bool(1, true)  // isAdjustedToUTC
+		t.structField(2) // unit
+		t.structField(2) // MICROS
+		t.end()
+		t.end()
+		t.end()
+		t.end()
+	case JSON:
+		t.i32(6, convJSON)
+		t.structField(10)
+		t.structField(12) // JSON
+		t.end()
+		t.end()
+	}
+	t.end()
+}
@@ -0,0 +1,433 @@
+package echo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultMaxLineSize bounds a single line read by Reader when
+// ReaderOptions.MaxLineSize is not set.
+const defaultMaxLineSize = 1 << 20
+
+// Entry is a log record read back from output written by echo, in a form
+// common to all formats.
+type Entry struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	// Source is the caller location, if the writer had AddSource enabled.
+	Source *slog.Source
+	// Attrs holds the remaining attributes in file order. Groups are
+	// slog.KindGroup values; for the text format they are rebuilt from dotted
+	// keys.
+	Attrs []slog.Attr
+}
+
+// Lookup returns the attribute at a dotted path such as "http.status",
+// descending into groups. A key that itself contains dots matches too.
+func (e Entry) Lookup(path string) (slog.Value, bool) {
+	return lookupAttr(e.Attrs, path)
+}
+
+func lookupAttr(attrs []slog.Attr, path string) (slog.Value, bool) {
+	for _, a := range attrs {
+		if a.Key == path {
+			return a.Value, true
+		}
+		if a.Value.Kind() == slog.KindGroup && strings.HasPrefix(path, a.Key+".") {
+			if v, ok := lookupAttr(a.Value.Group(), path[len(a.Key)+1:]); ok {
+				return v, true
+			}
+		}
+	}
+	return slog.Value{}, false
+}
+
+// Record converts e into a slog.Record, e.g. to pass it to a slog.Handler.
+// The record has no PC; the source, if any, is added as a *slog.Source
+// under slog.SourceKey.
+func (e Entry) Record() slog.Record {
+	r := slog.NewRecord(e.Time, e.Level, e.Message, 0)
+	if e.Source != nil {
+		r.AddAttrs(slog.Any(slog.SourceKey, e.Source))
+	}
+	r.AddAttrs(e.Attrs...)
+	return r
+}
+
+// entryFromRecord converts a record decoded by CBORReader into an Entry.
+func entryFromRecord(r slog.Record) Entry {
+	e := Entry{Time: r.Time, Level: r.Level, Message: r.Message}
+	r.Attrs(func(a slog.Attr) bool {
+		if src, ok := a.Value.Any().(*slog.Source); ok && a.Key == slog.SourceKey {
+			e.Source = src
+		} else {
+			e.Attrs = append(e.Attrs, a)
+		}
+		return true
+	})
+	return e
+}
+
+// ParseError reports a line that could not be parsed. Reader.Next returns it
+// for that line only; the next call continues with the following line.
+type ParseError struct {
+	File string
+	Line int64
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("echo: %s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("echo: line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// ReaderOptions configures a Reader. The zero value detects the format.
+type ReaderOptions struct {
+	// Format is "json", "text", "logfmt" (parsed like "text") or "cbor". Empty
+	// detects the format from the first bytes of each file.
+	Format string
+	// KeyUnwrapper decrypts files written with Config.FileEncryptionKey.
+	KeyUnwrapper KeyUnwrapper
+	// MaxLineSize bounds a single line of a text format; longer lines yield a
+	// ParseError. Defaults to 1 MiB.
+	MaxLineSize int
+}
+
+// Reader streams Entries from log output written by echo in any of its
+// formats, including compressed and encrypted files and rotated segments.
+// It holds at most one record in memory. A record cut short at the end of
+// a file, as left by a crash, is skipped.
+type Reader struct {
+	opts    ReaderOptions
+	paths   []string // Files still to be opened, for OpenLog
+	name    string   // Current file, for errors
+	closers []io.Closer
+	next    func() (Entry, error)
+	offset  func() int64 // Nil unless the current input is plain
+}
+
+// NewReader returns a Reader for a single stream, e.g. stdin. Compression,
+// encryption and the format are detected unless opts.Format is set.
+func NewReader(r io.Reader, opts *ReaderOptions) (*Reader, error) {
+	rd := &Reader{}
+	if opts != nil {
+		rd.opts = *opts
+	}
+	if err := rd.start(r); err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+// OpenFile returns a Reader for the single file at path.
+func OpenFile(path string, opts *ReaderOptions) (*Reader, error) {
+	return openPaths([]string{path}, opts)
+}
+
+// OpenLog returns a Reader for the log at path and its rotated segments,
+// oldest first, as listed by Segments.
+func OpenLog(path string, opts *ReaderOptions) (*Reader, error) {
+	paths, err := Segments(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("echo: no log files found for '%s'", path)
+	}
+	return openPaths(paths, opts)
+}
+
+func openPaths(paths []string, opts *ReaderOptions) (*Reader, error) {
+	rd := &Reader{paths: paths}
+	if opts != nil {
+		rd.opts = *opts
+	}
+	if err := rd.openNext(); err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+// Next returns the next entry, io.EOF once all input is consumed, or a
+// *ParseError for an unparseable line, after which reading can continue.
+func (rd *Reader) Next() (Entry, error) {
+	for {
+		if rd.next == nil {
+			return Entry{}, io.EOF
+		}
+		e, err := rd.next()
+		if err != io.EOF {
+			return e, err
+		}
+		if len(rd.paths) == 0 {
+			rd.next = nil
+			return Entry{}, io.EOF
+		}
+		if err := rd.openNext(); err != nil {
+			return Entry{}, err
+		}
+	}
+}
+
+// Offset returns the number of bytes of the current input consumed up to
+// the end of the last entry returned by Next, so that reading can resume
+// there later with a Reader over the rest of the input. For OpenLog it is
+// relative to the current file. It reports false for compressed or
+// encrypted input, whose byte positions cannot be resumed from.
+func (rd *Reader) Offset() (int64, bool) {
+	if rd.offset == nil {
+		return 0, false
+	}
+	return rd.offset(), true
+}
+
+// Close closes the files opened by the Reader.
+func (rd *Reader) Close() error {
+	err := rd.closeCurrent()
+	rd.paths = nil
+	rd.next = nil
+	return err
+}
+
+func (rd *Reader) closeCurrent() error {
+	var err error
+	for i := len(rd.closers) - 1; i >= 0; i-- {
+		if cerr := rd.closers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	rd.closers = nil
+	return err
+}
+
+// openNext closes the current file and starts reading the next path.
+func (rd *Reader) openNext() error {
+	if err := rd.closeCurrent(); err != nil {
+		return err
+	}
+	path := rd.paths[0]
+	rd.paths = rd.paths[1:]
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("echo: %w", err)
+	}
+	rd.name = path
+	rd.closers = append(rd.closers, f)
+	if err := rd.start(f); err != nil {
+		_ = rd.closeCurrent()
+		return fmt.Errorf("echo: %s: %w", path, err)
+	}
+	return nil
+}
+
+// Magic numbers used to detect how a stream was written.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	cborMagic = []byte{0xd9, 0xd9, 0xf7}
+)
+
+// start peels off compression and encryption layers from r and sets up
+// parsing of the format underneath.
+func (rd *Reader) start(r io.Reader) error {
+	in := &countingReader{r: r}
+	r = in
+	rd.offset = nil
+	for layers := 0; ; layers++ {
+		br := bufio.NewReader(r)
+		head, _ := br.Peek(frameHeaderSize + len(encMagic))
+		if layers > 2 {
+			return fmt.Errorf("too many nested encodings")
+		}
+		switch {
+		case bytes.HasPrefix(head, gzipMagic):
+			gz, err := gzip.NewReader(br)
+			if err != nil {
+				return err
+			}
+			rd.closers = append(rd.closers, gz)
+			r = gz
+		case bytes.HasPrefix(head, zstdMagic):
+			zr, err := zstd.NewReader(br)
+			if err != nil {
+				return err
+			}
+			rd.closers = append(rd.closers, zr.IOReadCloser())
+			r = zr
+		case len(head) == frameHeaderSize+len(encMagic) && head[0] == frameKey &&
+			string(head[frameHeaderSize:]) == encMagic:
+			if rd.opts.KeyUnwrapper == nil {
+				return fmt.Errorf("file is encrypted and no KeyUnwrapper was given")
+			}
+			r = NewDecryptReader(br, rd.opts.KeyUnwrapper)
+		default:
+			if layers == 0 {
+				rd.offset = func() int64 { return in.n - int64(br.Buffered()) }
+			}
+			return rd.startFormat(br, head)
+		}
+	}
+}
+
+// startFormat sets up the parser for the format of br.
+func (rd *Reader) startFormat(br *bufio.Reader, head []byte) error {
+	format := rd.opts.Format
+	if format == "" {
+		switch {
+		case bytes.HasPrefix(head, cborMagic):
+			format = "cbor"
+		case bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n"), []byte("{")):
+			format = "json"
+		default:
+			format = "text"
+		}
+	}
+	switch format {
+	case "cbor":
+		cr := &CBORReader{dec: cborDecoder{r: br}}
+		rd.next = func() (Entry, error) {
+			r, err := cr.Next()
+			if errors.Is(err, ErrTruncated) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return Entry{}, io.EOF
+			}
+			if err != nil {
+				return Entry{}, err
+			}
+			return entryFromRecord(r), nil
+		}
+	case "json":
+		rd.next = rd.lineParser(br, parseJSONEntry)
+	case "text", "logfmt":
+		rd.next = rd.lineParser(br, parseTextEntry)
+	default:
+		return fmt.Errorf("unknown format '%s'", format)
+	}
+	return nil
+}
+
+// lineParser returns a function reading one line at a time from br and
+// parsing it with parse. Blank lines are skipped. A final line without a
+// newline that fails to parse is a truncated record and ends the input.
+func (rd *Reader) lineParser(br *bufio.Reader, parse func([]byte) (Entry, error)) func() (Entry, error) {
+	maxLine := rd.opts.MaxLineSize
+	if maxLine <= 0 {
+		maxLine = defaultMaxLineSize
+	}
+	name := rd.name
+	var lineNo int64
+	var long []byte
+	return func() (Entry, error) {
+		for {
+			line, err := br.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				// Assemble lines longer than the buffer, up to maxLine.
+				long = append(long[:0], line...)
+				for err == bufio.ErrBufferFull && len(long) <= maxLine {
+					line, err = br.ReadSlice('\n')
+					long = append(long, line...)
+				}
+				line = long
+				if len(long) > maxLine {
+					for err == bufio.ErrBufferFull {
+						_, err = br.ReadSlice('\n')
+					}
+					lineNo++
+					if err != nil && err != io.EOF {
+						return Entry{}, endOfInput(err)
+					}
+					return Entry{}, &ParseError{File: name, Line: lineNo, Err: fmt.Errorf("line exceeds %d bytes", maxLine)}
+				}
+			}
+			if err != nil && err != io.EOF {
+				return Entry{}, endOfInput(err)
+			}
+			complete := err == nil
+			if !complete && len(line) == 0 {
+				return Entry{}, io.EOF
+			}
+			lineNo++
+			if len(bytes.TrimSpace(line)) == 0 {
+				if !complete {
+					return Entry{}, io.EOF
+				}
+				continue
+			}
+			e, perr := parse(line)
+			if perr != nil {
+				if !complete {
+					return Entry{}, io.EOF
+				}
+				return Entry{}, &ParseError{File: name, Line: lineNo, Err: perr}
+			}
+			return e, nil
+		}
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// endOfInput maps the error left by an unfinished compressed or encrypted
+// stream, which is what a file still being written looks like, to io.EOF.
+func endOfInput(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrTruncated) {
+		return io.EOF
+	}
+	return err
+}
+
+// segmentPattern matches the names rotatedName produces for a log file.
+func segmentPattern(base string) *regexp.Regexp {
+	stem, ext := splitLogExt(base)
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(stem) + `-\d{8}T\d{6}\.\d{9}` + regexp.QuoteMeta(ext) + `$`)
+}
+
+// Segments lists the rotated segments of the log at path, oldest first,
+// followed by path itself if it exists.
+func Segments(path string) ([]string, error) {
+	dir, base := filepath.Split(path)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return nil, fmt.Errorf("echo: %w", err)
+	}
+	pattern := segmentPattern(base)
+	var segments []string
+	for _, e := range entries {
+		if !e.IsDir() && pattern.MatchString(e.Name()) {
+			segments = append(segments, filepath.Join(dir, e.Name()))
+		}
+	}
+	// The timestamp is fixed width, so names sort chronologically.
+	sort.Strings(segments)
+	if _, err := os.Stat(path); err == nil {
+		segments = append(segments, path)
+	}
+	return segments, nil
+}
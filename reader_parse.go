@@ -0,0 +1,295 @@
+package echo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// textTimeFormat is the time layout of slog's TextHandler.
+const textTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// parseJSONEntry parses a line written by slog's JSONHandler. Object order
+// is kept, nested objects become groups and integral numbers become int64s.
+func parseJSONEntry(line []byte) (Entry, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return Entry{}, fmt.Errorf("not a JSON object")
+	}
+	var e Entry
+	for dec.More() {
+		key, v, err := parseJSONMember(dec)
+		if err != nil {
+			return Entry{}, err
+		}
+		if !setBuiltin(&e, key, v) {
+			e.Attrs = append(e.Attrs, slog.Attr{Key: key, Value: v})
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return Entry{}, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return Entry{}, fmt.Errorf("unexpected data after JSON object")
+	}
+	return e, nil
+}
+
+// parseJSONMember parses one "key": value pair of an object.
+func parseJSONMember(dec *json.Decoder) (string, slog.Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", slog.Value{}, err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", slog.Value{}, fmt.Errorf("invalid JSON object key")
+	}
+	v, err := parseJSONValue(dec)
+	return key, v, err
+}
+
+func parseJSONValue(dec *json.Decoder) (slog.Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return slog.Value{}, err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			var attrs []slog.Attr
+			for dec.More() {
+				key, v, err := parseJSONMember(dec)
+				if err != nil {
+					return slog.Value{}, err
+				}
+				attrs = append(attrs, slog.Attr{Key: key, Value: v})
+			}
+			_, err := dec.Token()
+			return slog.GroupValue(attrs...), err
+		case '[':
+			elems := []any{}
+			for dec.More() {
+				v, err := parseJSONValue(dec)
+				if err != nil {
+					return slog.Value{}, err
+				}
+				elems = append(elems, v.Any())
+			}
+			_, err := dec.Token()
+			return slog.AnyValue(elems), err
+		}
+		return slog.Value{}, fmt.Errorf("unexpected %v", tok)
+	case json.Number:
+		if n, err := tok.Int64(); err == nil {
+			return slog.Int64Value(n), nil
+		}
+		f, err := tok.Float64()
+		return slog.Float64Value(f), err
+	case string:
+		return slog.StringValue(tok), nil
+	case bool:
+		return slog.BoolValue(tok), nil
+	default: // nil
+		return slog.AnyValue(nil), nil
+	}
+}
+
+// setBuiltin stores the built-in keys of slog's handlers in e and reports
+// whether key was one of them. Values of an unexpected type are left as
+// attributes.
+func setBuiltin(e *Entry, key string, v slog.Value) bool {
+	switch key {
+	case slog.TimeKey:
+		if v.Kind() != slog.KindString {
+			return false
+		}
+		t, err := time.Parse(time.RFC3339Nano, v.String())
+		if err != nil {
+			return false
+		}
+		e.Time = t
+	case slog.LevelKey:
+		if v.Kind() != slog.KindString {
+			return false
+		}
+		if err := e.Level.UnmarshalText([]byte(v.String())); err != nil {
+			return false
+		}
+	case slog.MessageKey:
+		if v.Kind() != slog.KindString {
+			return false
+		}
+		e.Message = v.String()
+	case slog.SourceKey:
+		switch v.Kind() {
+		case slog.KindGroup: // JSON: {"function": ..., "file": ..., "line": ...}
+			e.Source = sourceFromGroup(v.Group())
+		case slog.KindString: // Text: file:line
+			s := v.String()
+			i := strings.LastIndexByte(s, ':')
+			line, err := strconv.Atoi(s[i+1:])
+			if i < 0 || err != nil {
+				return false
+			}
+			e.Source = &slog.Source{File: s[:i], Line: line}
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// parseTextEntry parses a line of space-separated key=value pairs, as written
+// by slog's TextHandler and logfmt loggers. Quoted values are always strings;
+// bare values that look like integers, floats or booleans are typed as such.
+// Dotted keys are turned back into groups.
+func parseTextEntry(line []byte) (Entry, error) {
+	s := strings.TrimRight(string(line), "\r\n")
+	var e Entry
+	var root textGroup
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+		key, rest, err := cutTextToken(s, true)
+		if err != nil {
+			return Entry{}, err
+		}
+		if !strings.HasPrefix(rest, "=") {
+			return Entry{}, fmt.Errorf("missing '=' after key %q", key)
+		}
+		rest = rest[1:]
+		quoted := strings.HasPrefix(rest, `"`)
+		val, rest, err := cutTextToken(rest, false)
+		if err != nil {
+			return Entry{}, err
+		}
+		s = rest
+
+		if key == slog.TimeKey && !quoted {
+			if t, err := time.Parse(textTimeFormat, val); err == nil {
+				e.Time = t
+				continue
+			}
+		}
+		v := slog.StringValue(val)
+		if !quoted {
+			v = inferTextValue(val)
+		}
+		if setBuiltin(&e, key, slog.StringValue(val)) {
+			continue
+		}
+		root.add(strings.Split(key, "."), v)
+	}
+	e.Attrs = root.attrs()
+	return e, nil
+}
+
+// cutTextToken splits a key or value off the front of s. Quoted tokens are
+// unquoted; bare keys end at '=', bare values at whitespace.
+func cutTextToken(s string, isKey bool) (tok, rest string, err error) {
+	if strings.HasPrefix(s, `"`) {
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return "", "", fmt.Errorf("unterminated quoted string")
+		}
+		tok, err = strconv.Unquote(s[:end+1])
+		return tok, s[end+1:], err
+	}
+	stop := " \t"
+	if isKey {
+		stop = " \t="
+	}
+	i := strings.IndexAny(s, stop)
+	if i < 0 {
+		i = len(s)
+	}
+	if isKey && i == 0 {
+		return "", "", fmt.Errorf("empty key")
+	}
+	return s[:i], s[i:], nil
+}
+
+// inferTextValue types a bare value from a text line.
+func inferTextValue(s string) slog.Value {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return slog.Int64Value(n)
+	}
+	if looksNumeric(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return slog.Float64Value(f)
+		}
+	}
+	switch s {
+	case "true":
+		return slog.BoolValue(true)
+	case "false":
+		return slog.BoolValue(false)
+	}
+	return slog.StringValue(s)
+}
+
+// looksNumeric rules out words ParseFloat accepts, such as "Inf" and "nan".
+func looksNumeric(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	return s != "" && (s[0] >= '0' && s[0] <= '9' || s[0] == '.')
+}
+
+// textGroup rebuilds nested groups from dotted keys, keeping first-seen order.
+type textGroup struct {
+	members []textMember
+}
+
+type textMember struct {
+	key   string
+	value slog.Value
+	group *textGroup // Non-nil for groups
+}
+
+func (g *textGroup) add(path []string, v slog.Value) {
+	if len(path) == 1 {
+		g.members = append(g.members, textMember{key: path[0], value: v})
+		return
+	}
+	for _, m := range g.members {
+		if m.group != nil && m.key == path[0] {
+			m.group.add(path[1:], v)
+			return
+		}
+	}
+	sub := &textGroup{}
+	sub.add(path[1:], v)
+	g.members = append(g.members, textMember{key: path[0], group: sub})
+}
+
+func (g *textGroup) attrs() []slog.Attr {
+	if len(g.members) == 0 {
+		return nil
+	}
+	attrs := make([]slog.Attr, len(g.members))
+	for i, m := range g.members {
+		if m.group != nil {
+			attrs[i] = slog.Attr{Key: m.key, Value: slog.GroupValue(m.group.attrs()...)}
+		} else {
+			attrs[i] = slog.Attr{Key: m.key, Value: m.value}
+		}
+	}
+	return attrs
+}
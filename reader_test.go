@@ -0,0 +1,253 @@
+package echo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAllEntries drains rd, failing the test on any error.
+func readAllEntries(t *testing.T, rd *Reader) []Entry {
+	t.Helper()
+	var entries []Entry
+	for {
+		e, err := rd.Next()
+		if errors.Is(err, io.EOF) {
+			return entries
+		}
+		require.NoError(t, err)
+		entries = append(entries, e)
+	}
+}
+
+// logSample writes the same two records through h.
+func logSample(h slog.Handler) {
+	logger := slog.New(h).With("service", "api")
+	logger.Info("request handled", slog.Group("http", "status", 503, "route", "/v1/items"), "took", 1.5)
+	logger.Warn("quota low", "remaining", 3, "ok", false, "note", "has spaces")
+}
+
+func TestReaderAllFormats(t *testing.T) {
+	opts := &slog.HandlerOptions{AddSource: true}
+	handlers := map[string]func(w io.Writer) slog.Handler{
+		"json": func(w io.Writer) slog.Handler { return slog.NewJSONHandler(w, opts) },
+		"text": func(w io.Writer) slog.Handler { return slog.NewTextHandler(w, opts) },
+		"cbor": func(w io.Writer) slog.Handler { return newCBORHandler(w, opts) },
+	}
+	for format, newHandler := range handlers {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			logSample(newHandler(&buf))
+
+			rd, err := NewReader(&buf, nil)
+			require.NoError(t, err)
+			entries := readAllEntries(t, rd)
+			require.Len(t, entries, 2)
+
+			first := entries[0]
+			assert.Equal(t, LevelInfo, first.Level)
+			assert.Equal(t, "request handled", first.Message)
+			assert.WithinDuration(t, time.Now(), first.Time, time.Minute)
+			require.NotNil(t, first.Source, "Source should be parsed")
+			assert.True(t, strings.HasSuffix(first.Source.File, "reader_test.go"))
+			assert.Positive(t, first.Source.Line)
+
+			status, ok := first.Lookup("http.status")
+			require.True(t, ok, "http.status should be found inside its group")
+			assert.Equal(t, int64(503), status.Int64())
+			route, _ := first.Lookup("http.route")
+			assert.Equal(t, "/v1/items", route.String())
+			took, _ := first.Lookup("took")
+			assert.Equal(t, 1.5, took.Float64())
+			service, _ := first.Lookup("service")
+			assert.Equal(t, "api", service.String())
+
+			second := entries[1]
+			assert.Equal(t, LevelWarn, second.Level)
+			ok2, _ := second.Lookup("ok")
+			assert.Equal(t, slog.KindBool, ok2.Kind())
+			note, _ := second.Lookup("note")
+			assert.Equal(t, "has spaces", note.String())
+		})
+	}
+}
+
+func TestReaderTruncatedLastLine(t *testing.T) {
+	input := `{"time":"2024-01-01T00:00:00Z","level":"INFO","msg":"complete"}` + "\n" +
+		`{"time":"2024-01-01T00:00:01Z","level":"INFO","msg":"cut sh`
+	rd, err := NewReader(strings.NewReader(input), nil)
+	require.NoError(t, err)
+	entries := readAllEntries(t, rd)
+	require.Len(t, entries, 1, "The partial last line should be skipped")
+	assert.Equal(t, "complete", entries[0].Message)
+}
+
+func TestReaderParseErrorContinues(t *testing.T) {
+	input := `{"level":"INFO","msg":"one"}` + "\n" + "{not json}\n" + `{"level":"INFO","msg":"two"}` + "\n"
+	rd, err := NewReader(strings.NewReader(input), nil)
+	require.NoError(t, err)
+
+	e, err := rd.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "one", e.Message)
+
+	_, err = rd.Next()
+	var perr *ParseError
+	require.True(t, errors.As(err, &perr), "Expected a ParseError, got %v", err)
+	assert.Equal(t, int64(2), perr.Line)
+
+	e, err = rd.Next()
+	require.NoError(t, err, "Reading should continue after a ParseError")
+	assert.Equal(t, "two", e.Message)
+}
+
+func TestReaderTextGroupsAndQuoting(t *testing.T) {
+	line := `time=2024-01-02T03:04:05.678Z level=ERROR msg="disk \"full\"" a.b.c=1 a.b.d=x a.e=-2.5 "odd key"=v` + "\n"
+	rd, err := NewReader(strings.NewReader(line), &ReaderOptions{Format: "logfmt"})
+	require.NoError(t, err)
+	entries := readAllEntries(t, rd)
+	require.Len(t, entries, 1)
+	e := entries[0]
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 678000000, time.UTC), e.Time.UTC())
+	assert.Equal(t, LevelError, e.Level)
+	assert.Equal(t, `disk "full"`, e.Message)
+	require.Len(t, e.Attrs, 2)
+	assert.Equal(t, "a", e.Attrs[0].Key)
+	assert.Equal(t, "[b=[c=1 d=x] e=-2.5]", e.Attrs[0].Value.String())
+	assert.Equal(t, "odd key", e.Attrs[1].Key)
+}
+
+func TestOpenLogRotatedCompressedSegments(t *testing.T) {
+	for _, kind := range []string{"gzip", "zstd"} {
+		t.Run(kind, func(t *testing.T) {
+			dir := t.TempDir()
+			logPath := filepath.Join(dir, "app.log"+compressionExt[kind])
+			encode, err := compressEncoder(kind)
+			require.NoError(t, err)
+			w, err := newFileWriter(logPath, fileWriterOptions{encode: encode, flushEvery: time.Millisecond})
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = w.Close() })
+			h := slog.NewJSONHandler(w, nil)
+
+			for i := 0; i < 3; i++ {
+				require.NoError(t, h.Handle(context.Background(), slog.NewRecord(time.Now(), LevelInfo, "before rotation", 0)))
+				// Force a rotation between records.
+				w.mu.Lock()
+				require.NoError(t, w.rotate())
+				w.mu.Unlock()
+			}
+			slog.New(h).Info("in active file")
+
+			segments, err := Segments(logPath)
+			require.NoError(t, err)
+			require.Len(t, segments, 4)
+			assert.Equal(t, logPath, segments[3], "The active file should come last")
+
+			// The active stream is unfinished; once flushed, its records are readable.
+			var entries []Entry
+			assert.Eventually(t, func() bool {
+				rd, err := OpenLog(logPath, nil)
+				require.NoError(t, err)
+				defer rd.Close()
+				entries = readAllEntries(t, rd)
+				return len(entries) == 4
+			}, time.Second, 5*time.Millisecond)
+			require.Len(t, entries, 4)
+			assert.Equal(t, "in active file", entries[3].Message)
+		})
+	}
+}
+
+func TestOpenFileEncrypted(t *testing.T) {
+	kw, ku := newTestRSAKey(t)
+	logPath := filepath.Join(t.TempDir(), "secret.log")
+	w, err := newFileWriter(logPath, fileWriterOptions{encode: encryptEncoder(kw)})
+	require.NoError(t, err)
+	_ = newCBORHandler(w, nil).Handle(context.Background(), slog.NewRecord(time.Now(), LevelWarn, "encrypted cbor", 0))
+	require.NoError(t, w.Close())
+
+	_, err = OpenFile(logPath, nil)
+	require.Error(t, err, "Encrypted files need a KeyUnwrapper")
+
+	rd, err := OpenFile(logPath, &ReaderOptions{KeyUnwrapper: ku})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = rd.Close() })
+	entries := readAllEntries(t, rd)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "encrypted cbor", entries[0].Message)
+}
+
+func TestEntryRecord(t *testing.T) {
+	e := Entry{
+		Time:    time.Unix(1700000000, 0),
+		Level:   LevelWarn,
+		Message: "converted",
+		Source:  &slog.Source{File: "main.go", Line: 12},
+		Attrs:   []slog.Attr{slog.Int("n", 1)},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, slog.NewTextHandler(&buf, nil).Handle(context.Background(), e.Record()))
+	assert.Contains(t, buf.String(), "level=WARN msg=converted source=main.go:12 n=1")
+}
+
+func TestSegmentsMissing(t *testing.T) {
+	segments, err := Segments(filepath.Join(t.TempDir(), "none.log"))
+	require.NoError(t, err)
+	assert.Empty(t, segments)
+
+	_, err = OpenLog(filepath.Join(t.TempDir(), "none.log"), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no log files found")
+}
+
+func TestReaderOffsetResume(t *testing.T) {
+	for _, format := range []string{"json", "text", "cbor"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			h, err := NewFormatHandler(format, &buf, nil)
+			require.NoError(t, err)
+			logSample(h)
+			data := buf.Bytes()
+
+			rd, err := NewReader(bytes.NewReader(data), nil)
+			require.NoError(t, err)
+			_, err = rd.Next()
+			require.NoError(t, err)
+			off, ok := rd.Offset()
+			require.True(t, ok)
+
+			// A new Reader from the offset continues with the second entry.
+			rest := data[off:]
+			rd, err = NewReader(bytes.NewReader(rest), nil)
+			require.NoError(t, err)
+			entries := readAllEntries(t, rd)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "quota low", entries[0].Message)
+			off, _ = rd.Offset()
+			assert.Equal(t, int64(len(rest)), off, "At the end, everything should be consumed")
+		})
+	}
+
+	var buf bytes.Buffer
+	encode, err := compressEncoder("gzip")
+	require.NoError(t, err)
+	zw, err := encode(&buf)
+	require.NoError(t, err)
+	logSample(slog.NewJSONHandler(zw, nil))
+	require.NoError(t, zw.Close())
+	rd, err := NewReader(&buf, nil)
+	require.NoError(t, err)
+	_, err = rd.Next()
+	require.NoError(t, err)
+	_, ok := rd.Offset()
+	assert.False(t, ok, "Compressed input has no resumable offset")
+}
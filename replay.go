@@ -0,0 +1,104 @@
+package echo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// ReplayOptions controls Replay. The zero value replays as fast as possible.
+type ReplayOptions struct {
+	// Speed replays entries at their original pace, sped up by this factor:
+	// 1 keeps the original gaps between entries, 10 makes them ten times
+	// shorter. Zero replays without waiting.
+	Speed float64
+	// MaxWait caps the wait before any single entry, e.g. to skip the quiet
+	// hours of a night at original pace. Zero means no cap.
+	MaxWait time.Duration
+	// OnParseError, if set, is called for each line that could not be
+	// parsed. Such lines are skipped either way.
+	OnParseError func(*ParseError)
+}
+
+// Replay reads entries from rd and passes them to h as records, as a Logger
+// would: entries below the level h is enabled for are dropped. Records keep
+// their original time, level, message, source and attributes. Replay stops
+// at the end of rd, at the first error from h, or when ctx is done, and
+// returns the number of records handled.
+//
+// Combined with NewHandler it sends real logs through a new configuration:
+//
+//	h, closer, err := echo.NewHandler(cfg)
+//	...
+//	defer closer.Close()
+//	n, err := echo.Replay(ctx, rd, h, &echo.ReplayOptions{Speed: 10})
+func Replay(ctx context.Context, rd *Reader, h slog.Handler, opts *ReplayOptions) (int, error) {
+	if opts == nil {
+		opts = &ReplayOptions{}
+	}
+	var (
+		n    int
+		prev time.Time // Time of the previous entry with a time
+		due  time.Time // When to handle the next entry, when pacing
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		e, err := rd.Next()
+		var perr *ParseError
+		switch {
+		case errors.Is(err, io.EOF):
+			return n, nil
+		case errors.As(err, &perr):
+			if opts.OnParseError != nil {
+				opts.OnParseError(perr)
+			}
+			continue
+		case err != nil:
+			return n, err
+		}
+
+		if opts.Speed > 0 && !e.Time.IsZero() {
+			if prev.IsZero() {
+				due = time.Now()
+			} else if gap := e.Time.Sub(prev); gap > 0 {
+				wait := time.Duration(float64(gap) / opts.Speed)
+				if opts.MaxWait > 0 && wait > opts.MaxWait {
+					wait = opts.MaxWait
+				}
+				due = due.Add(wait)
+			}
+			prev = e.Time
+			if err := sleepUntil(ctx, due); err != nil {
+				return n, err
+			}
+		}
+
+		if !h.Enabled(ctx, e.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, e.Record()); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// sleepUntil waits until t or until ctx is done.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
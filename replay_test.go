@@ -0,0 +1,87 @@
+package echo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const replayInput = `{"time":"2024-01-01T00:00:00Z","level":"INFO","msg":"start","source":{"function":"main.main","file":"main.go","line":3}}
+{"time":"2024-01-01T00:00:00.05Z","level":"DEBUG","msg":"detail"}
+garbage
+{"time":"2024-01-01T00:00:00.1Z","level":"WARN","msg":"slow","took":1.5}
+`
+
+func TestReplayThroughNewHandler(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "replayed.log")
+	h, closer, err := NewHandler(Config{ConsoleOutput: new(bool), FileOutput: true, FilePath: logPath})
+	require.NoError(t, err)
+
+	rd, err := NewReader(strings.NewReader(replayInput), nil)
+	require.NoError(t, err)
+	var parseErrors int
+	n, err := Replay(context.Background(), rd, h, &ReplayOptions{OnParseError: func(*ParseError) { parseErrors++ }})
+	require.NoError(t, err)
+	require.NoError(t, closer.Close())
+	assert.Equal(t, 2, n, "The debug entry is below the default level")
+	assert.Equal(t, 1, parseErrors)
+
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2, "NewHandler should not log an init message")
+
+	var first map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Equal(t, "2024-01-01T00:00:00Z", first["time"], "The original time should be kept")
+	assert.Equal(t, "start", first["msg"])
+	assert.Equal(t, map[string]any{"function": "main.main", "file": "main.go", "line": float64(3)}, first["source"])
+	assert.Contains(t, lines[1], `"took":1.5`)
+}
+
+func TestReplayPacing(t *testing.T) {
+	var buf bytes.Buffer
+	h := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: LevelDebug})
+
+	// 100ms of logs at 2x should take about 50ms.
+	rd, err := NewReader(strings.NewReader(replayInput), nil)
+	require.NoError(t, err)
+	start := time.Now()
+	n, err := Replay(context.Background(), rd, h, &ReplayOptions{Speed: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 45*time.Millisecond)
+	assert.Less(t, elapsed, time.Second)
+
+	// MaxWait caps each gap.
+	rd, err = NewReader(strings.NewReader(replayInput), nil)
+	require.NoError(t, err)
+	start = time.Now()
+	_, err = Replay(context.Background(), rd, h, &ReplayOptions{Speed: 1, MaxWait: time.Millisecond})
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestReplayCanceled(t *testing.T) {
+	input := `{"time":"2024-01-01T00:00:00Z","level":"INFO","msg":"now"}
+{"time":"2024-01-01T01:00:00Z","level":"INFO","msg":"in an hour"}
+`
+	rd, err := NewReader(strings.NewReader(input), nil)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	n, err := Replay(ctx, rd, slog.NewJSONHandler(&buf, nil), &ReplayOptions{Speed: 1})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, n)
+}
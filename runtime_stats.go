@@ -0,0 +1,156 @@
+package echo
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+// runtimeMetrics are the runtime/metrics read by the runtime stats
+// reporter, with the attributes they are logged as. Histograms are logged
+// as quantiles over the interval, under the attribute name and a suffix.
+var runtimeMetrics = []struct {
+	name string
+	attr string
+}{
+	{"/memory/classes/heap/objects:bytes", "heap_bytes"},
+	{"/gc/heap/goal:bytes", "heap_goal_bytes"},
+	{"/memory/classes/total:bytes", "total_bytes"},
+	{"/sched/goroutines:goroutines", "goroutines"},
+	{"/gc/cycles/total:gc-cycles", "gc_cycles"},
+	{"/sched/pauses/total/gc:seconds", "gc_pause"},
+	{"/sched/latencies:seconds", "sched_latency"},
+}
+
+// runtimeStats reads runtime/metrics, keeping the cumulative values of the
+// previous read so that counters and histograms are reported for the
+// interval between reads.
+type runtimeStats struct {
+	samples    []metrics.Sample
+	prevCycles uint64
+	prevCounts [][]uint64 // Histogram counts, by sample
+}
+
+func newRuntimeStats() *runtimeStats {
+	s := &runtimeStats{
+		samples:    make([]metrics.Sample, len(runtimeMetrics)),
+		prevCounts: make([][]uint64, len(runtimeMetrics)),
+	}
+	for i, m := range runtimeMetrics {
+		s.samples[i].Name = m.name
+	}
+	s.read() // Start the first interval now
+	return s
+}
+
+// read reads the metrics and returns their attributes.
+func (s *runtimeStats) read() []slog.Attr {
+	metrics.Read(s.samples)
+	var attrs []slog.Attr
+	for i, sample := range s.samples {
+		name := runtimeMetrics[i].attr
+		switch v := sample.Value; v.Kind() {
+		case metrics.KindUint64:
+			n := v.Uint64()
+			if name == "gc_cycles" {
+				n, s.prevCycles = n-s.prevCycles, n // Cycles in the interval
+			}
+			attrs = append(attrs, slog.Uint64(name, n))
+		case metrics.KindFloat64Histogram:
+			// Read reuses the histogram, so the counts are copied.
+			h := v.Float64Histogram()
+			counts := subCounts(h.Counts, s.prevCounts[i])
+			s.prevCounts[i] = append(s.prevCounts[i][:0], h.Counts...)
+			attrs = append(attrs,
+				slog.Duration(name+"_p50", seconds(histogramQuantile(h.Buckets, counts, 0.5))),
+				slog.Duration(name+"_p99", seconds(histogramQuantile(h.Buckets, counts, 0.99))),
+				slog.Duration(name+"_max", seconds(histogramQuantile(h.Buckets, counts, 1))),
+			)
+		}
+		// Metrics this runtime does not support (KindBad) are skipped.
+	}
+	return attrs
+}
+
+// subCounts returns the counts of the interval between prev and cur.
+func subCounts(cur, prev []uint64) []uint64 {
+	d := make([]uint64, len(cur))
+	for i := range cur {
+		d[i] = cur[i]
+		if i < len(prev) {
+			d[i] -= prev[i]
+		}
+	}
+	return d
+}
+
+// histogramQuantile returns an upper bound of the quantile q of a
+// runtime/metrics histogram, or 0 if it is empty.
+func histogramQuantile(buckets []float64, counts []uint64, q float64) float64 {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	target := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, c := range counts {
+		seen += c
+		if seen >= target && c > 0 {
+			if upper := buckets[i+1]; !math.IsInf(upper, 1) {
+				return upper
+			}
+			return buckets[i]
+		}
+	}
+	return buckets[len(buckets)-1]
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// startRuntimeStats logs runtime statistics to logger every interval until
+// the returned function is called.
+func startRuntimeStats(logger *slog.Logger, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		stats := newRuntimeStats()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				logger.LogAttrs(context.Background(), LevelInfo, "runtime stats", stats.read()...)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+// statsCloser stops the runtime stats reporter before closing the file.
+type statsCloser struct {
+	stop func()
+	next FileCloser
+}
+
+func (c statsCloser) Close() error {
+	c.stop()
+	return c.next.Close()
+}
@@ -0,0 +1,56 @@
+package echo
+
+import (
+	"log/slog"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 1, 2, 4, math.Inf(1)}
+	assert.Zero(t, histogramQuantile(buckets, []uint64{0, 0, 0, 0}, 0.5))
+	counts := []uint64{0, 6, 3, 1}
+	assert.Equal(t, 2.0, histogramQuantile(buckets, counts, 0.5))
+	assert.Equal(t, 4.0, histogramQuantile(buckets, counts, 0.9))
+	assert.Equal(t, 4.0, histogramQuantile(buckets, counts, 1), "The last bucket is unbounded")
+	assert.Equal(t, []uint64{0, 4, 3, 0}, subCounts(counts, []uint64{0, 2, 0, 1}))
+}
+
+func TestRuntimeStatsInterval(t *testing.T) {
+	s := newRuntimeStats()
+	runtime.GC()
+	runtime.GC()
+	attrs := map[string]slog.Value{}
+	for _, a := range s.read() {
+		attrs[a.Key] = a.Value
+	}
+	assert.GreaterOrEqual(t, attrs["gc_cycles"].Uint64(), uint64(2))
+	assert.Less(t, attrs["gc_cycles"].Uint64(), uint64(100), "Cycles are counted over the interval")
+	assert.Positive(t, attrs["gc_pause_max"].Duration())
+	assert.Positive(t, attrs["heap_bytes"].Uint64())
+}
+
+func TestRuntimeStatsStop(t *testing.T) {
+	records := make(chan Entry, 100)
+	h := NewEntryHandler(func(e Entry) error {
+		select {
+		case records <- e:
+		default:
+		}
+		return nil
+	}, nil)
+	stop := startRuntimeStats(slog.New(h), time.Millisecond)
+	e := <-records
+	assert.Equal(t, "runtime stats", e.Message)
+	stop()
+	stop()
+	for len(records) > 0 {
+		<-records
+	}
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, records, "Nothing is logged once stopped")
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+)
+
+// Query selects records from a Store. All conditions must hold; the zero
+// Query selects everything.
+type Query struct {
+	// Since and Until bound the record time to [Since, Until). Records
+	// without a time never match a time bound.
+	Since, Until time.Time
+	// MinLevel, if set, drops records below its level.
+	MinLevel slog.Leveler
+	// Attrs requires attributes, by dotted path, to have the given values
+	// in their text form ("500" for an int, "true" for a bool, RFC 3339 in
+	// UTC for a time and JSON for other values, such as structs). Keys in
+	// Options.IndexKeys are answered from the index; others are checked on
+	// each record that matches the rest of the query.
+	Attrs map[string]string
+	// Newest returns the most recent records first.
+	Newest bool
+	// Limit caps the number of records returned. Zero means no limit.
+	Limit int
+}
+
+// Query returns the records matching q, in the order they were appended,
+// or the reverse with q.Newest.
+func (s *Store) Query(q Query) ([]echo.Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.file == nil {
+		return nil, ErrClosed
+	}
+	segments := s.segments()
+	if q.Newest {
+		slices.Reverse(segments)
+	}
+	var entries []echo.Entry
+	for _, seg := range segments {
+		if q.Limit > 0 && len(entries) >= q.Limit {
+			break
+		}
+		var err error
+		if entries, err = s.querySegment(seg, q, entries); err != nil {
+			return entries, fmt.Errorf("store: %w", err)
+		}
+	}
+	return entries, nil
+}
+
+// querySegment appends the records of seg matching q to entries.
+func (s *Store) querySegment(seg *segment, q Query, entries []echo.Entry) ([]echo.Entry, error) {
+	timed := !q.Since.IsZero() || !q.Until.IsZero()
+	since, until := int64(0), int64(0)
+	if !q.Since.IsZero() {
+		since = q.Since.UnixNano()
+	}
+	if !q.Until.IsZero() {
+		until = q.Until.UnixNano()
+	}
+	if timed && (seg.MaxTime == 0 || seg.MaxTime < since || (until != 0 && seg.MinTime >= until)) {
+		return entries, nil
+	}
+
+	// Candidates from the inverted index, or a range of record numbers.
+	candidates, indexed := seg.lookup(q.Attrs)
+	if !indexed {
+		lo, hi := 0, len(seg.Records)
+		if timed && seg.Sorted {
+			lo = sort.Search(hi, func(i int) bool { return seg.Records[i].Time >= since })
+			if until != 0 {
+				hi = sort.Search(hi, func(i int) bool { return seg.Records[i].Time >= until })
+			}
+		}
+		candidates = make([]int32, 0, max(hi-lo, 0))
+		for i := lo; i < hi; i++ {
+			candidates = append(candidates, int32(i))
+		}
+	}
+	if q.Newest {
+		slices.Reverse(candidates)
+	}
+
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	for _, i := range candidates {
+		if q.Limit > 0 && len(entries) >= q.Limit {
+			break
+		}
+		rec := seg.Records[i]
+		if timed && (rec.Time == 0 || rec.Time < since || (until != 0 && rec.Time >= until)) {
+			continue
+		}
+		if q.MinLevel != nil && rec.Level < q.MinLevel.Level() {
+			continue
+		}
+		if f == nil {
+			var err error
+			if f, err = os.Open(seg.dataPath(s.dir)); err != nil {
+				return entries, err
+			}
+		}
+		e, err := readEntry(f, rec.Offset, seg.end(int(i)))
+		if err != nil {
+			return entries, err
+		}
+		if matchAttrs(e, q.Attrs, seg.Postings) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// lookup intersects the posting lists of the indexed keys in attrs. It
+// reports false if none of the keys is indexed.
+func (seg *segment) lookup(attrs map[string]string) ([]int32, bool) {
+	var result []int32
+	indexed := false
+	for key, value := range attrs {
+		values, ok := seg.Postings[key]
+		if !ok {
+			continue
+		}
+		list := values[value]
+		if !indexed {
+			result, indexed = slices.Clone(list), true
+			continue
+		}
+		result = intersect(result, list)
+	}
+	return result, indexed
+}
+
+// intersect keeps the numbers of a that are also in b; both are sorted.
+func intersect(a, b []int32) []int32 {
+	out := a[:0]
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// matchAttrs checks the attributes of attrs that the index did not answer.
+// A key is only in postings once some record of the segment had it, so an
+// indexed key missing there is checked here too, and fails.
+func matchAttrs(e echo.Entry, attrs map[string]string, postings map[string]map[string][]int32) bool {
+	for key, want := range attrs {
+		if _, ok := postings[key]; ok {
+			continue
+		}
+		v, ok := e.Lookup(key)
+		if !ok || v.Kind() == slog.KindGroup || indexValue(v) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// readEntry decodes the record stored in f between offset and end.
+func readEntry(f *os.File, offset, end int64) (echo.Entry, error) {
+	return decodeEntry(io.NewSectionReader(f, offset, end-offset))
+}
+
+// decodeEntry decodes the single record r holds.
+func decodeEntry(r io.Reader) (echo.Entry, error) {
+	rd, err := echo.NewReader(r, &echo.ReaderOptions{Format: "cbor"})
+	if err != nil {
+		return echo.Entry{}, err
+	}
+	e, err := rd.Next()
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return e, err
+}
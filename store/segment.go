@@ -0,0 +1,192 @@
+package store
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+)
+
+// record locates one record in a segment and holds what the time and level
+// indexes need.
+type record struct {
+	Offset int64
+	Time   int64 // Unix nanoseconds, or 0 without a time
+	Level  slog.Level
+}
+
+// segment is one data file of the store and its index. Sealed segments
+// never change; their index is saved beside them.
+type segment struct {
+	ID      int
+	Size    int64
+	MinTime int64
+	MaxTime int64
+	Sorted  bool // Records are in time order, so time ranges can be bisected
+	Records []record
+	// Postings maps an indexed key and a value to the numbers of the records
+	// having it, in increasing order.
+	Postings map[string]map[string][]int32
+}
+
+func newSegment(id int) *segment {
+	return &segment{ID: id, Sorted: true, Postings: map[string]map[string][]int32{}}
+}
+
+func (s *segment) dataPath(dir string) string {
+	return filepath.Join(dir, fmt.Sprintf("%08d%s", s.ID, dataExt))
+}
+
+func (s *segment) indexPath(dir string) string {
+	return filepath.Join(dir, fmt.Sprintf("%08d%s", s.ID, indexExt))
+}
+
+// add indexes e, encoded at offset with n bytes.
+func (s *segment) add(e echo.Entry, offset, n int64, keys []string) {
+	var t int64
+	if !e.Time.IsZero() {
+		t = e.Time.UnixNano()
+		if s.MinTime == 0 || t < s.MinTime {
+			s.MinTime = t
+		}
+		if t < s.MaxTime {
+			s.Sorted = false
+		}
+		s.MaxTime = max(s.MaxTime, t)
+	} else {
+		s.Sorted = false
+	}
+	num := int32(len(s.Records))
+	s.Records = append(s.Records, record{Offset: offset, Time: t, Level: e.Level})
+	s.Size = offset + n
+	for _, key := range keys {
+		v, ok := e.Lookup(key)
+		if !ok || v.Kind() == slog.KindGroup {
+			continue
+		}
+		values := s.Postings[key]
+		if values == nil {
+			values = map[string][]int32{}
+			s.Postings[key] = values
+		}
+		value := indexValue(v)
+		values[value] = append(values[value], num)
+	}
+}
+
+// indexValue returns the text form of v that the index holds and that
+// Query.Attrs values are compared with. Records are indexed as they decode
+// from a segment, so that a record has the same values when it is appended
+// and when its segment is scanned after a restart; times are written in
+// RFC 3339 in UTC, and values of other types, which decode as JSON, as
+// their JSON text.
+func indexValue(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindTime:
+		return v.Time().UTC().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if raw, ok := v.Any().(json.RawMessage); ok {
+			return string(raw)
+		}
+	}
+	return v.String()
+}
+
+// end is the offset just after record i.
+func (s *segment) end(i int) int64 {
+	if i+1 < len(s.Records) {
+		return s.Records[i+1].Offset
+	}
+	return s.Size
+}
+
+// scanSegment rebuilds the index of the segment file at path by reading it,
+// and returns the size of its intact part: a record cut short by a crash
+// ends the scan.
+func scanSegment(id int, path string, keys []string) (*segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	seg := newSegment(id)
+	rd, err := echo.NewReader(f, &echo.ReaderOptions{Format: "cbor"})
+	if err != nil {
+		return nil, err
+	}
+	var offset int64
+	for {
+		e, err := rd.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// A damaged record: keep what came before it.
+			break
+		}
+		end, _ := rd.Offset()
+		seg.add(e, offset, end-offset, keys)
+		offset = end
+	}
+	seg.Size = offset
+	return seg, nil
+}
+
+// loadIndex reads the saved index of a sealed segment. It is only trusted
+// if it was built for the same indexed keys.
+func loadIndex(path string, keys []string) (*segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var saved struct {
+		Keys    []string
+		Segment *segment
+	}
+	if err := gob.NewDecoder(f).Decode(&saved); err != nil {
+		return nil, err
+	}
+	if !slices.Equal(saved.Keys, keys) {
+		return nil, errors.New("indexed keys changed")
+	}
+	if saved.Segment.Postings == nil {
+		saved.Segment.Postings = map[string]map[string][]int32{}
+	}
+	return saved.Segment, nil
+}
+
+// saveIndex writes the index of a sealed segment, through a temporary file
+// so that a crash never leaves a partial index.
+func (s *segment) saveIndex(path string, keys []string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(struct {
+		Keys    []string
+		Segment *segment
+	}{keys, s})
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,281 @@
+// Package store keeps log records in a local, append-only store that can be
+// searched by time range, level and attribute values, for deployments with
+// no log backend to ship to. It is pure Go.
+//
+// A store is a directory of segments. Records are appended to the active
+// segment in echo's CBOR file format, so a segment file can also be read
+// with echo.OpenFile or echo-view. When the active segment reaches
+// Options.SegmentSize it is sealed: its index is saved beside it
+// ("00000001.seg" and "00000001.idx") and a new segment is started. Sealed
+// segments never change, and the oldest are removed once the store exceeds
+// Options.MaxSize.
+//
+// Indexes are held in memory. Each segment knows the time span and level
+// of its records, and keeps an inverted index from the values of the
+// attributes named in Options.IndexKeys to the records having them. A query
+// consults them first and only reads the records that can match:
+//
+//	s, err := store.Open("/var/lib/app/logs", store.Options{IndexKeys: []string{"request_id", "http.route"}})
+//	...
+//	defer s.Close()
+//	logger := slog.New(store.NewHandler(s, nil))
+//	...
+//	entries, err := s.Query(store.Query{
+//		Since:    time.Now().Add(-time.Hour),
+//		MinLevel: slog.LevelWarn,
+//		Attrs:    map[string]string{"http.route": "/login"},
+//	})
+//
+// With Init, add the handler to Config.Handlers so that records also go to
+// the console and log file.
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/altitude-analytics/echo"
+)
+
+const (
+	dataExt  = ".seg"
+	indexExt = ".idx"
+
+	// DefaultSegmentSize is the size at which segments are sealed when
+	// Options.SegmentSize is not set.
+	DefaultSegmentSize = 64 << 20
+)
+
+// ErrClosed is returned for operations on a closed Store.
+var ErrClosed = errors.New("store: closed")
+
+// Options configures a Store.
+type Options struct {
+	// IndexKeys are the attribute keys, as dotted paths such as
+	// "http.status", whose values are indexed for Query.Attrs. Other keys
+	// can be queried too, by reading the records that match otherwise.
+	// Changing the keys rebuilds the indexes of existing segments on Open.
+	IndexKeys []string
+	// SegmentSize is the size in bytes at which the active segment is
+	// sealed. Defaults to DefaultSegmentSize.
+	SegmentSize int64
+	// MaxSize bounds the size in bytes of all segments together: whenever a
+	// segment is sealed, the oldest are removed to get below it. The store
+	// may thus exceed it by up to SegmentSize. Zero keeps everything.
+	MaxSize int64
+}
+
+// Store is an append-only log store in a directory. It is safe for
+// concurrent use, but only one Store may have a directory open at a time.
+type Store struct {
+	dir    string
+	opts   Options
+	mu     sync.RWMutex
+	sealed []*segment // Oldest first
+	active *segment
+	file   *os.File // Data file of the active segment
+	enc    bytes.Buffer
+	h      slog.Handler // Encodes records into enc
+}
+
+// Open opens the store in dir, creating the directory if needed. The index
+// of the active segment is rebuilt from its data, which also drops a record
+// left incomplete by a crash.
+func Open(dir string, opts Options) (*Store, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	opts.IndexKeys = slices.Compact(slices.Sorted(slices.Values(opts.IndexKeys)))
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("store: %w", err)
+	}
+	s := &Store{dir: dir, opts: opts}
+	s.h, _ = echo.NewFormatHandler("cbor", &s.enc, nil)
+
+	ids, err := segmentIDs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("store: %w", err)
+	}
+	for i, id := range ids {
+		seg := newSegment(id)
+		if i == len(ids)-1 {
+			if seg, err = scanSegment(id, seg.dataPath(dir), opts.IndexKeys); err != nil {
+				return nil, fmt.Errorf("store: %w", err)
+			}
+			s.active = seg
+			break
+		}
+		loaded, err := loadIndex(seg.indexPath(dir), opts.IndexKeys)
+		if err != nil {
+			// Missing, damaged or built for other keys: rebuild it.
+			if loaded, err = scanSegment(id, seg.dataPath(dir), opts.IndexKeys); err == nil {
+				err = loaded.saveIndex(seg.indexPath(dir), opts.IndexKeys)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("store: %w", err)
+			}
+		}
+		s.sealed = append(s.sealed, loaded)
+	}
+	if s.active == nil {
+		s.active = newSegment(1)
+	}
+	if err := s.openActive(); err != nil {
+		return nil, fmt.Errorf("store: %w", err)
+	}
+	return s, nil
+}
+
+// NewHandler returns a slog.Handler appending records to s. Of opts, Level
+// and AddSource are used.
+func NewHandler(s *Store, opts *slog.HandlerOptions) *echo.EntryHandler {
+	return echo.NewEntryHandler(s.Append, opts)
+}
+
+// segmentIDs lists the IDs of the segment files in dir, in increasing order.
+func segmentIDs(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), dataExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		if id, err := strconv.Atoi(name); err == nil && id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// openActive opens the data file of the active segment for appending, cut
+// to the part its index covers.
+func (s *Store) openActive() error {
+	f, err := os.OpenFile(s.active.dataPath(s.dir), os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(s.active.Size); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(s.active.Size, 0); err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	return nil
+}
+
+// Append adds e to the store.
+func (s *Store) Append(e echo.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return ErrClosed
+	}
+	s.enc.Reset()
+	if err := s.h.Handle(context.Background(), e.Record()); err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+	n := int64(s.enc.Len())
+	// Index the record as it will read back, as after a reopen.
+	stored, err := decodeEntry(bytes.NewReader(s.enc.Bytes()))
+	if err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+	if s.active.Size > 0 && s.active.Size+n > s.opts.SegmentSize {
+		if err := s.seal(); err != nil {
+			return fmt.Errorf("store: %w", err)
+		}
+	}
+	offset := s.active.Size
+	if _, err := s.file.Write(s.enc.Bytes()); err != nil {
+		// Drop what part of the record made it, so the segment stays whole.
+		s.file.Truncate(offset)
+		s.file.Seek(offset, 0)
+		return fmt.Errorf("store: %w", err)
+	}
+	s.active.add(stored, offset, n, s.opts.IndexKeys)
+	return nil
+}
+
+// seal saves the active segment's index, starts a new active segment and
+// enforces MaxSize.
+func (s *Store) seal() error {
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	if err := s.active.saveIndex(s.active.indexPath(s.dir), s.opts.IndexKeys); err != nil {
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+	s.sealed = append(s.sealed, s.active)
+	s.active = newSegment(s.active.ID + 1)
+	if err := s.openActive(); err != nil {
+		return err
+	}
+
+	if s.opts.MaxSize > 0 {
+		total := s.active.Size
+		for _, seg := range s.sealed {
+			total += seg.Size
+		}
+		for len(s.sealed) > 0 && total > s.opts.MaxSize {
+			old := s.sealed[0]
+			if err := os.Remove(old.dataPath(s.dir)); err != nil {
+				return err
+			}
+			os.Remove(old.indexPath(s.dir))
+			total -= old.Size
+			s.sealed = s.sealed[1:]
+		}
+	}
+	return nil
+}
+
+// Sync commits the records appended so far to stable storage.
+func (s *Store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return ErrClosed
+	}
+	return s.file.Sync()
+}
+
+// Close syncs and closes the store. The index of the active segment is not
+// saved; Open rebuilds it.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Sync()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file = nil
+	return err
+}
+
+// segments returns all segments, oldest first. The caller holds s.mu.
+func (s *Store) segments() []*segment {
+	return append(slices.Clip(s.sealed), s.active)
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func messages(entries []echo.Entry) []string {
+	var msgs []string
+	for _, e := range entries {
+		msgs = append(msgs, e.Message)
+	}
+	return msgs
+}
+
+// fill appends n entries a minute apart, alternating routes and levels.
+func fill(t *testing.T, s *Store, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		level := slog.LevelInfo
+		if i%3 == 0 {
+			level = slog.LevelWarn
+		}
+		require.NoError(t, s.Append(echo.Entry{
+			Time:    t0.Add(time.Duration(i) * time.Minute),
+			Level:   level,
+			Message: fmt.Sprintf("m%d", i),
+			Attrs: []slog.Attr{
+				slog.Group("http", slog.String("route", []string{"/a", "/b"}[i%2]), slog.Int("status", 200+i%5)),
+				slog.Int("n", i),
+			},
+		}))
+	}
+}
+
+func TestStoreQuery(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{IndexKeys: []string{"http.route"}, SegmentSize: 400})
+	require.NoError(t, err)
+	fill(t, s, 20)
+
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	assert.Greater(t, len(segs), 2, "Small segments should be sealed")
+
+	all, err := s.Query(Query{})
+	require.NoError(t, err)
+	require.Len(t, all, 20)
+	assert.Equal(t, t0.Add(5*time.Minute), all[5].Time.UTC())
+	v, _ := all[5].Lookup("http.status")
+	assert.Equal(t, int64(200), v.Int64(), "Values should keep their types")
+
+	got, err := s.Query(Query{Since: t0.Add(4 * time.Minute), Until: t0.Add(8 * time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m4", "m5", "m6", "m7"}, messages(got))
+
+	got, err = s.Query(Query{MinLevel: slog.LevelWarn, Attrs: map[string]string{"http.route": "/b"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m3", "m9", "m15"}, messages(got))
+
+	got, err = s.Query(Query{Attrs: map[string]string{"http.route": "/a", "http.status": "202"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m2", "m12"}, messages(got), "Unindexed keys are checked on the records")
+
+	got, err = s.Query(Query{Newest: true, Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m19", "m18", "m17"}, messages(got))
+
+	got, err = s.Query(Query{Attrs: map[string]string{"http.route": "/c"}})
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	require.NoError(t, s.Close())
+	_, err = s.Query(Query{})
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{IndexKeys: []string{"http.route"}, SegmentSize: 400})
+	require.NoError(t, err)
+	fill(t, s, 10)
+	require.NoError(t, s.Close())
+
+	// A torn record at the end of the active segment is dropped.
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	active := segs[len(segs)-1]
+	f, err := os.OpenFile(active, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0xd9, 0xd9, 0xf7, 0xbf, 0x64})
+	require.NoError(t, err)
+	f.Close()
+
+	// Changed keys rebuild the sealed indexes.
+	s, err = Open(dir, Options{IndexKeys: []string{"n"}, SegmentSize: 400})
+	require.NoError(t, err)
+	defer s.Close()
+	fill(t, s, 1)
+	got, err := s.Query(Query{Attrs: map[string]string{"n": "7"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m7"}, messages(got))
+	all, err := s.Query(Query{})
+	require.NoError(t, err)
+	assert.Len(t, all, 11)
+	assert.Equal(t, "m0", all[10].Message)
+}
+
+func TestStoreAttrsSurviveReopen(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{IndexKeys: []string{"user", "at"}}
+	s, err := Open(dir, opts)
+	require.NoError(t, err)
+	type user struct{ Name string }
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	for i, name := range []string{"ann", "bob"} {
+		require.NoError(t, s.Append(echo.Entry{
+			Time:    t0,
+			Message: name,
+			Attrs: []slog.Attr{
+				slog.Any("user", user{name}), slog.Time("at", at.Add(time.Duration(i)*time.Hour)),
+				slog.Any("owner", user{name}), slog.Time("seen", at),
+			},
+		}))
+	}
+
+	// Indexed and unindexed keys, in the documented text forms.
+	queries := []map[string]string{
+		{"user": `{"Name":"bob"}`},
+		{"owner": `{"Name":"bob"}`},
+		{"at": "2024-01-02T03:04:05Z"},
+		{"seen": "2024-01-02T02:04:05Z", "user": `{"Name":"bob"}`},
+	}
+	want := [][]string{{"bob"}, {"bob"}, {"bob"}, {"bob"}}
+	check := func() {
+		t.Helper()
+		for i, attrs := range queries {
+			got, err := s.Query(Query{Attrs: attrs})
+			require.NoError(t, err)
+			assert.Equal(t, want[i], messages(got), "%v", attrs)
+		}
+	}
+	check()
+	require.NoError(t, s.Close())
+	s, err = Open(dir, opts)
+	require.NoError(t, err)
+	defer s.Close()
+	check()
+}
+
+func TestStoreMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{SegmentSize: 400, MaxSize: 1000})
+	require.NoError(t, err)
+	defer s.Close()
+	fill(t, s, 40)
+
+	all, err := s.Query(Query{})
+	require.NoError(t, err)
+	assert.Less(t, len(all), 40)
+	assert.Equal(t, "m39", all[len(all)-1].Message, "The newest records are kept")
+	var total int64
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	for _, seg := range segs {
+		fi, err := os.Stat(seg)
+		require.NoError(t, err)
+		total += fi.Size()
+	}
+	assert.LessOrEqual(t, total, int64(1000+400), "Only the active segment may exceed MaxSize")
+
+	// Segments are plain echo CBOR files.
+	rd, err := echo.OpenFile(segs[0], nil)
+	require.NoError(t, err)
+	defer rd.Close()
+	e, err := rd.Next()
+	require.NoError(t, err)
+	assert.Equal(t, all[0].Message, e.Message)
+}
+
+func TestHandler(t *testing.T) {
+	s, err := Open(t.TempDir(), Options{IndexKeys: []string{"req.id"}})
+	require.NoError(t, err)
+	defer s.Close()
+
+	logger := slog.New(NewHandler(s, &slog.HandlerOptions{Level: slog.LevelDebug, AddSource: true}))
+	reqLogger := logger.WithGroup("req").With("id", "r1")
+	reqLogger.Debug("start", "path", "/x")
+	reqLogger.With("user", "bob").Info("done", slog.Group("empty"))
+	logger.Info("other", "req", slog.GroupValue(slog.String("id", "r2")))
+
+	got, err := s.Query(Query{Attrs: map[string]string{"req.id": "r1"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"start", "done"}, messages(got))
+	assert.Equal(t, []slog.Attr{slog.Group("req", slog.String("id", "r1"), slog.String("path", "/x"))}, got[0].Attrs)
+	assert.Equal(t, []slog.Attr{slog.Group("req", slog.String("id", "r1"), slog.String("user", "bob"))}, got[1].Attrs)
+	require.NotNil(t, got[0].Source)
+	assert.Equal(t, "store_test.go", filepath.Base(got[0].Source.File))
+
+	// Added next to the console through Config.Handlers.
+	h, closer, err := echo.NewHandler(echo.Config{ConsoleOutput: new(bool), Handlers: []slog.Handler{NewHandler(s, nil)}})
+	require.NoError(t, err)
+	defer closer.Close()
+	slog.New(h).Warn("via config", "req.id", "r3")
+	got, err = s.Query(Query{MinLevel: slog.LevelWarn})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"via config"}, messages(got))
+}
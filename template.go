@@ -0,0 +1,219 @@
+package echo
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TemplateKey is the key of the attribute holding the message template of
+// records logged through a TemplateLogger.
+const TemplateKey = "msg_template"
+
+// TemplateLogger logs with Serilog-style message templates. The leading
+// arguments fill the named placeholders of the message in order; each is
+// rendered into the message and also added as an attribute named after its
+// placeholder, along with the template itself under TemplateKey, which is
+// the same for every record of a call site and so groups them:
+//
+//	log := echo.NewTemplateLogger(nil)
+//	log.Info("user {user} bought {qty} items", "ann", 3, "cart", id)
+//
+// logs the message "user ann bought 3 items" with the attributes
+// msg_template="user {user} bought {qty} items", user=ann, qty=3 and
+// cart=id. Arguments beyond the placeholders are key-value pairs or Attrs,
+// as for slog.Logger. Placeholder names are made of letters, digits, '_' and
+// '.'; "{{" and "}}" stand for literal braces, and placeholders without an
+// argument are left as is.
+//
+// Templates are parsed once per call site.
+type TemplateLogger struct {
+	l *slog.Logger
+}
+
+// NewTemplateLogger returns a TemplateLogger logging to l, or to the default
+// logger at the time of each call if l is nil.
+func NewTemplateLogger(l *slog.Logger) *TemplateLogger {
+	return &TemplateLogger{l: l}
+}
+
+// Logger returns the slog.Logger t logs to.
+func (t *TemplateLogger) Logger() *slog.Logger {
+	if t.l == nil {
+		return slog.Default()
+	}
+	return t.l
+}
+
+// With returns a TemplateLogger whose records include args, as
+// slog.Logger.With.
+func (t *TemplateLogger) With(args ...any) *TemplateLogger {
+	return &TemplateLogger{l: t.Logger().With(args...)}
+}
+
+// WithGroup returns a TemplateLogger whose attributes, including the
+// placeholders and the template, are in the group name, as
+// slog.Logger.WithGroup.
+func (t *TemplateLogger) WithGroup(name string) *TemplateLogger {
+	return &TemplateLogger{l: t.Logger().WithGroup(name)}
+}
+
+// Debug logs at LevelDebug.
+func (t *TemplateLogger) Debug(msg string, args ...any) {
+	t.log(context.Background(), LevelDebug, msg, args)
+}
+
+// Info logs at LevelInfo.
+func (t *TemplateLogger) Info(msg string, args ...any) {
+	t.log(context.Background(), LevelInfo, msg, args)
+}
+
+// Warn logs at LevelWarn.
+func (t *TemplateLogger) Warn(msg string, args ...any) {
+	t.log(context.Background(), LevelWarn, msg, args)
+}
+
+// Error logs at LevelError.
+func (t *TemplateLogger) Error(msg string, args ...any) {
+	t.log(context.Background(), LevelError, msg, args)
+}
+
+// DebugContext logs at LevelDebug with the context ctx.
+func (t *TemplateLogger) DebugContext(ctx context.Context, msg string, args ...any) {
+	t.log(ctx, LevelDebug, msg, args)
+}
+
+// InfoContext logs at LevelInfo with the context ctx.
+func (t *TemplateLogger) InfoContext(ctx context.Context, msg string, args ...any) {
+	t.log(ctx, LevelInfo, msg, args)
+}
+
+// WarnContext logs at LevelWarn with the context ctx.
+func (t *TemplateLogger) WarnContext(ctx context.Context, msg string, args ...any) {
+	t.log(ctx, LevelWarn, msg, args)
+}
+
+// ErrorContext logs at LevelError with the context ctx.
+func (t *TemplateLogger) ErrorContext(ctx context.Context, msg string, args ...any) {
+	t.log(ctx, LevelError, msg, args)
+}
+
+// Log logs at level, with the context ctx.
+func (t *TemplateLogger) Log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	t.log(ctx, level, msg, args)
+}
+
+// log must be called directly by the exported methods, so that the caller
+// it records is theirs.
+func (t *TemplateLogger) log(ctx context.Context, level slog.Level, msg string, args []any) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	h := t.Logger().Handler()
+	if !h.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // Skip runtime.Callers, log and the exported method
+	tmpl := templateAt(pcs[0], msg)
+
+	n := min(len(tmpl.names), len(args))
+	r := slog.NewRecord(time.Now(), level, tmpl.render(args[:n]), pcs[0])
+	r.AddAttrs(slog.String(TemplateKey, msg))
+	for i, name := range tmpl.names[:n] {
+		r.AddAttrs(slog.Any(name, args[i]))
+	}
+	r.Add(args[n:]...)
+	_ = h.Handle(ctx, r)
+}
+
+// messageTemplate is a parsed message template.
+type messageTemplate struct {
+	text  string
+	parts []templatePart
+	names []string // Of the placeholders, in order
+}
+
+// templatePart is a literal or, if hole, the placeholder of the next
+// argument.
+type templatePart struct {
+	literal string
+	hole    bool
+}
+
+// templates caches parsed templates by call site. A call site logging
+// templates that vary is parsed again whenever its template changes.
+var templates sync.Map // uintptr -> *messageTemplate
+
+// templateAt returns text parsed, from the cache of the call site pc.
+func templateAt(pc uintptr, text string) *messageTemplate {
+	if v, ok := templates.Load(pc); ok {
+		if tmpl := v.(*messageTemplate); tmpl.text == text {
+			return tmpl
+		}
+	}
+	tmpl := parseTemplate(text)
+	templates.Store(pc, tmpl)
+	return tmpl
+}
+
+// parseTemplate splits text into literals and placeholders.
+func parseTemplate(text string) *messageTemplate {
+	tmpl := &messageTemplate{text: text}
+	var lit strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if (c == '{' || c == '}') && i+1 < len(text) && text[i+1] == c {
+			lit.WriteByte(c) // Escaped brace
+			i++
+			continue
+		}
+		if c == '{' {
+			if end := strings.IndexByte(text[i+1:], '}'); end > 0 && isPlaceholderName(text[i+1:i+1+end]) {
+				if lit.Len() > 0 {
+					tmpl.parts = append(tmpl.parts, templatePart{literal: lit.String()})
+					lit.Reset()
+				}
+				// The literal of a hole is the placeholder, for when it
+				// has no argument.
+				tmpl.parts = append(tmpl.parts, templatePart{literal: text[i : i+2+end], hole: true})
+				tmpl.names = append(tmpl.names, text[i+1:i+1+end])
+				i += end + 1
+				continue
+			}
+		}
+		lit.WriteByte(c)
+	}
+	if lit.Len() > 0 {
+		tmpl.parts = append(tmpl.parts, templatePart{literal: lit.String()})
+	}
+	return tmpl
+}
+
+func isPlaceholderName(s string) bool {
+	for _, c := range []byte(s) {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// render returns the message with the placeholders replaced by args, which
+// may be fewer than the placeholders.
+func (tmpl *messageTemplate) render(args []any) string {
+	var b strings.Builder
+	hole := 0
+	for _, p := range tmpl.parts {
+		if p.hole && hole < len(args) {
+			b.WriteString(slog.AnyValue(args[hole]).Resolve().String())
+			hole++
+			continue
+		}
+		b.WriteString(p.literal)
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package echo
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateLogger(t *testing.T) {
+	var got []Entry
+	h := NewEntryHandler(func(e Entry) error {
+		got = append(got, e)
+		return nil
+	}, &slog.HandlerOptions{Level: LevelInfo, AddSource: true})
+	log := NewTemplateLogger(slog.New(h)).With("svc", "api")
+
+	log.Info("user {user} bought {qty} items", "ann", 3, "cart", "c1", slog.Bool("gift", true))
+	log.Debug("disabled {x}", 1)
+	log.Warn("missing {a} and {b}", tokenValuer("secret"))
+
+	require.Len(t, got, 2)
+	assert.Equal(t, "user ann bought 3 items", got[0].Message)
+	assert.Equal(t, []slog.Attr{
+		slog.String("svc", "api"),
+		slog.String(TemplateKey, "user {user} bought {qty} items"),
+		slog.String("user", "ann"),
+		slog.Int("qty", 3),
+		slog.String("cart", "c1"),
+		slog.Bool("gift", true),
+	}, got[0].Attrs)
+	require.NotNil(t, got[0].Source)
+	assert.True(t, strings.HasSuffix(got[0].Source.File, "template_test.go"), "The source is the caller's: %s", got[0].Source.File)
+
+	assert.Equal(t, "missing *** and {b}", got[1].Message, "Placeholders without arguments are kept")
+	assert.Equal(t, LevelWarn, got[1].Level)
+	assert.Equal(t, []slog.Attr{
+		slog.String("svc", "api"),
+		slog.String(TemplateKey, "missing {a} and {b}"),
+		slog.String("a", "***"),
+	}, got[1].Attrs)
+}
+
+func TestParseTemplate(t *testing.T) {
+	for _, tt := range []struct {
+		text  string
+		names []string
+		out   string
+	}{
+		{"no placeholders", nil, "no placeholders"},
+		{"{a}{b.c} {d_1}", []string{"a", "b.c", "d_1"}, "12 3"},
+		{"{{a}} {{{a}}}", []string{"a"}, "{a} {1}"},
+		{"{not a name} {} {a", nil, "{not a name} {} {a"},
+		{"}} {x}}", []string{"x"}, "} 1}"},
+	} {
+		tmpl := parseTemplate(tt.text)
+		assert.Equal(t, tt.names, tmpl.names, tt.text)
+		assert.Equal(t, tt.out, tmpl.render([]any{1, 2, 3}), tt.text)
+	}
+}
+
+func TestTemplateCachedPerCallSite(t *testing.T) {
+	a := templateAt(1, "{a}")
+	assert.Same(t, a, templateAt(1, "{a}"))
+	b := templateAt(1, "{b}")
+	assert.Equal(t, []string{"b"}, b.names, "A new template at the call site is parsed again")
+	assert.Same(t, b, templateAt(1, "{b}"))
+}
@@ -0,0 +1,53 @@
+package webview
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/altitude-analytics/echo"
+)
+
+// Ring keeps the most recent entries logged by the current process in
+// memory, for the viewer to browse and tail. Log to it through Handler,
+// e.g. by adding that to echo.Config.Handlers.
+type Ring struct {
+	mu      sync.Mutex
+	entries []echo.Entry // Circular; entry n is at n % len(entries)
+	next    uint64       // Number of the next entry
+}
+
+// NewRing returns a Ring keeping the last size entries.
+func NewRing(size int) *Ring {
+	return &Ring{entries: make([]echo.Entry, max(size, 1))}
+}
+
+// Handler returns a slog.Handler adding records to r. Of opts, Level and
+// AddSource are used.
+func (r *Ring) Handler(opts *slog.HandlerOptions) *echo.EntryHandler {
+	return echo.NewEntryHandler(r.Add, opts)
+}
+
+// Add adds e, dropping the oldest entry if the ring is full.
+func (r *Ring) Add(e echo.Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next%uint64(len(r.entries))] = e
+	r.next++
+	return nil
+}
+
+// since returns the entries numbered from n on that are still kept, oldest
+// first, and the number of the next entry.
+func (r *Ring) since(n uint64) ([]echo.Entry, uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	size := uint64(len(r.entries))
+	if r.next > size {
+		n = max(n, r.next-size)
+	}
+	var out []echo.Entry
+	for ; n < r.next; n++ {
+		out = append(out, r.entries[n%size])
+	}
+	return out, r.next
+}
@@ -0,0 +1,316 @@
+// Package webview serves a small web UI for browsing, searching and tailing
+// logs, for machines with no log backend: the recent records of the current
+// process, kept in a Ring, and local log files written by echo.
+//
+//	ring := webview.NewRing(10000)
+//	closer, err := echo.Init(echo.Config{Handlers: []slog.Handler{ring.Handler(nil)}})
+//	...
+//	http.Handle("/logs/", http.StripPrefix("/logs", webview.New(webview.Options{
+//		Ring:  ring,
+//		Files: []string{"/var/log/app/app.log"},
+//	})))
+//
+// The page is self-contained, embedded in the binary. Records can be
+// filtered by minimum level, by an echo-query filter expression such as
+// `http.status>=500 and route~"^/api"`, and by text anywhere in the record,
+// and expanded to show all their attributes. Live mode polls for new
+// records.
+//
+// The viewer has no access control of its own and shows everything that is
+// logged: mount it behind authentication.
+package webview
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/altitude-analytics/echo"
+	"github.com/altitude-analytics/echo/internal/cli"
+	"github.com/altitude-analytics/echo/internal/query"
+)
+
+//go:embed static
+var static embed.FS
+
+const (
+	defaultLimit = 1000
+	maxLimit     = 10000
+)
+
+// Options configures the viewer.
+type Options struct {
+	// Ring, if set, holds the records of the current process.
+	Ring *Ring
+	// Files are log files to offer, each read with its rotated segments as
+	// echo.OpenLog does. Live mode is only available for plain files, not
+	// compressed or encrypted ones.
+	Files []string
+	// ReaderOptions are used to read Files, e.g. to decrypt them.
+	ReaderOptions *echo.ReaderOptions
+}
+
+// New returns an http.Handler serving the viewer at "/" and its JSON API
+// under "/api/". It uses relative URLs, so it can be mounted under a prefix
+// with http.StripPrefix.
+func New(opts Options) http.Handler {
+	s := &server{opts: opts}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.index)
+	mux.HandleFunc("GET /api/sources", s.sources)
+	mux.HandleFunc("GET /api/entries", s.entries)
+	return mux
+}
+
+type server struct {
+	opts Options
+}
+
+func (s *server) index(w http.ResponseWriter, r *http.Request) {
+	page, err := static.ReadFile("static/index.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+// source is an entry of the source list.
+type source struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (s *server) sources(w http.ResponseWriter, r *http.Request) {
+	list := []source{}
+	if s.opts.Ring != nil {
+		list = append(list, source{"ring", "This process"})
+	}
+	for i, path := range s.opts.Files {
+		list = append(list, source{"file:" + strconv.Itoa(i), path})
+	}
+	writeJSON(w, list)
+}
+
+// page is the response of /api/entries. Cursor, when set, asks for the
+// entries after these on the next request; it is empty when the source
+// cannot be tailed.
+type page struct {
+	Entries []json.RawMessage `json:"entries"`
+	Cursor  string            `json:"cursor"`
+}
+
+// entries returns the last matching entries of a source, or with a cursor
+// the matching entries that came after it.
+//
+// Parameters: source (from /api/sources), level (minimum), filter (an
+// echo-query filter expression), q (text anywhere in the record), limit
+// and cursor.
+func (s *server) entries(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	c, err := newCollector(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, cursor := params.Get("source"), params.Get("cursor")
+	switch {
+	case id == "ring" && s.opts.Ring != nil:
+		var n uint64
+		if cursor != "" {
+			if n, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+				http.Error(w, "bad cursor", http.StatusBadRequest)
+				return
+			}
+		}
+		entries, next := s.opts.Ring.since(n)
+		for _, e := range entries {
+			c.add(e)
+		}
+		cursor = strconv.FormatUint(next, 10)
+	case strings.HasPrefix(id, "file:"):
+		i, err := strconv.Atoi(strings.TrimPrefix(id, "file:"))
+		if err != nil || i < 0 || i >= len(s.opts.Files) {
+			http.Error(w, "unknown source", http.StatusNotFound)
+			return
+		}
+		if cursor, err = s.readLog(s.opts.Files[i], cursor, c); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "unknown source", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, page{Entries: c.kept, Cursor: cursor})
+}
+
+// collector filters entries and keeps the last limit of them, encoded as
+// slog's JSONHandler writes them.
+type collector struct {
+	minLevel slog.Level
+	match    func(echo.Entry) bool
+	text     []byte
+	limit    int
+	buf      bytes.Buffer
+	h        slog.Handler
+	kept     []json.RawMessage
+}
+
+func newCollector(params map[string][]string) (*collector, error) {
+	get := func(key string) string {
+		if v := params[key]; len(v) > 0 {
+			return strings.TrimSpace(v[0])
+		}
+		return ""
+	}
+	c := &collector{minLevel: slog.Level(math.MinInt), limit: defaultLimit, text: []byte(strings.ToLower(get("q")))}
+	var err error
+	if level := get("level"); level != "" {
+		if c.minLevel, err = cli.ParseLevel(level); err != nil {
+			return nil, err
+		}
+	}
+	if filter := get("filter"); filter != "" {
+		if c.match, err = query.ParseFilter(filter); err != nil {
+			return nil, err
+		}
+	}
+	if limit := get("limit"); limit != "" {
+		if c.limit, err = strconv.Atoi(limit); err != nil || c.limit < 1 {
+			return nil, fmt.Errorf("bad limit %q", limit)
+		}
+		c.limit = min(c.limit, maxLimit)
+	}
+	c.h = slog.NewJSONHandler(&c.buf, nil)
+	return c, nil
+}
+
+// older returns a collector with the same filters for the entries that
+// precede those kept by c, up to the number c still has room for.
+func (c *collector) older() *collector {
+	o := &collector{minLevel: c.minLevel, match: c.match, text: c.text, limit: c.limit - len(c.kept)}
+	o.h = slog.NewJSONHandler(&o.buf, nil)
+	return o
+}
+
+func (c *collector) add(e echo.Entry) {
+	if e.Level < c.minLevel || (c.match != nil && !c.match(e)) {
+		return
+	}
+	c.buf.Reset()
+	if c.h.Handle(context.Background(), e.Record()) != nil {
+		return
+	}
+	line := bytes.TrimSpace(c.buf.Bytes())
+	if len(c.text) > 0 && !bytes.Contains(bytes.ToLower(line), c.text) {
+		return
+	}
+	if len(c.kept) == c.limit {
+		c.kept = c.kept[1:]
+	}
+	c.kept = append(c.kept, bytes.Clone(line))
+}
+
+// readLog collects the entries of the log at path into c: with no cursor
+// the last ones, reading the current file and then rotated segments newest
+// first until c is full, and otherwise those of the current file after the
+// cursor. It returns the cursor for the next call.
+func (s *server) readLog(path, cursor string, c *collector) (string, error) {
+	if cursor != "" {
+		return s.readFrom(path, cursor, c.add)
+	}
+	segments, err := echo.Segments(path)
+	if err != nil {
+		return "", err
+	}
+	if cursor, err = s.readFrom(path, "", c.add); err != nil {
+		return "", err
+	}
+	for i := len(segments) - 1; i >= 0 && len(c.kept) < c.limit; i-- {
+		if segments[i] == path {
+			continue
+		}
+		rd, err := echo.OpenFile(segments[i], s.opts.ReaderOptions)
+		if err != nil {
+			return "", err
+		}
+		o := c.older()
+		err = cli.Drain(rd, io.Discard, func(e echo.Entry) error {
+			o.add(e)
+			return nil
+		})
+		rd.Close()
+		if err != nil {
+			return "", err
+		}
+		c.kept = append(o.kept, c.kept...)
+	}
+	return cursor, nil
+}
+
+// readFrom reads the file at path from cursor, which holds an offset and a
+// hash of the bytes before it. If the file no longer starts with those
+// bytes, it was rotated or truncated and is read from its start.
+func (s *server) readFrom(path, cursor string, add func(echo.Entry)) (string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "0:0", nil // Not yet created
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var offset int64
+	if off, sum, ok := strings.Cut(cursor, ":"); ok {
+		offset, _ = strconv.ParseInt(off, 10, 64)
+		if fi, err := f.Stat(); err != nil || offset < 0 || offset > fi.Size() || prefixHash(f, offset) != sum {
+			offset = 0
+		}
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	rd, err := echo.NewReader(f, s.opts.ReaderOptions)
+	if err != nil {
+		return "", err
+	}
+	defer rd.Close()
+	read, live := rd.Offset()
+	err = cli.Drain(rd, io.Discard, func(e echo.Entry) error {
+		add(e)
+		read, _ = rd.Offset()
+		return nil
+	})
+	if err != nil || !live {
+		return "", err
+	}
+	end := offset + read
+	return strconv.FormatInt(end, 10) + ":" + prefixHash(f, end), nil
+}
+
+// prefixHash identifies a file by its first bytes, up to n of them.
+func prefixHash(f *os.File, n int64) string {
+	h := fnv.New64a()
+	io.Copy(h, io.NewSectionReader(f, 0, min(n, 512)))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
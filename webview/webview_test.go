@@ -0,0 +1,152 @@
+package webview
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type result struct {
+	Entries []map[string]any
+	Cursor  string
+}
+
+func get(t *testing.T, h http.Handler, path string, params url.Values) (int, result, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", path+"?"+params.Encode(), nil))
+	var res result
+	if rec.Code == http.StatusOK && strings.HasPrefix(path, "/api/entries") {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	}
+	return rec.Code, res, rec.Body.String()
+}
+
+func messages(res result) []string {
+	var msgs []string
+	for _, e := range res.Entries {
+		msgs = append(msgs, e["msg"].(string))
+	}
+	return msgs
+}
+
+func TestRing(t *testing.T) {
+	ring := NewRing(3)
+	logger := slog.New(ring.Handler(nil))
+	for i := 0; i < 5; i++ {
+		logger.Info(fmt.Sprint(i))
+	}
+	entries, next := ring.since(0)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "2", entries[0].Message, "The oldest entries are dropped")
+	assert.Equal(t, uint64(5), next)
+	entries, _ = ring.since(4)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "4", entries[0].Message)
+}
+
+func TestRingSource(t *testing.T) {
+	ring := NewRing(100)
+	logger := slog.New(ring.Handler(&slog.HandlerOptions{Level: slog.LevelDebug}))
+	h := New(Options{Ring: ring})
+
+	logger.Debug("debug detail")
+	logger.With(slog.Group("http", slog.Int("status", 500))).Error("request failed", "route", "/api/x")
+	logger.WithGroup("http").Warn("slow request", "status", 200)
+
+	code, res, _ := get(t, h, "/api/entries", url.Values{"source": {"ring"}})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"debug detail", "request failed", "slow request"}, messages(res))
+	assert.Equal(t, map[string]any{"status": float64(200)}, res.Entries[2]["http"])
+
+	_, res, _ = get(t, h, "/api/entries", url.Values{"source": {"ring"}, "level": {"warn"}, "filter": {"http.status >= 300"}})
+	assert.Equal(t, []string{"request failed"}, messages(res))
+	_, res, _ = get(t, h, "/api/entries", url.Values{"source": {"ring"}, "q": {"SLOW"}, "limit": {"1"}})
+	assert.Equal(t, []string{"slow request"}, messages(res))
+	_, res, _ = get(t, h, "/api/entries", url.Values{"source": {"ring"}, "limit": {"2"}})
+	assert.Equal(t, []string{"request failed", "slow request"}, messages(res), "The last records are kept")
+
+	// Tailing from the cursor.
+	logger.Info("later")
+	_, res, _ = get(t, h, "/api/entries", url.Values{"source": {"ring"}, "cursor": {res.Cursor}})
+	assert.Equal(t, []string{"later"}, messages(res))
+
+	code, _, body := get(t, h, "/api/entries", url.Values{"source": {"ring"}, "filter": {"level>= | count"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body, "query:")
+	code, _, _ = get(t, h, "/api/entries", url.Values{"source": {"file:0"}})
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	write := func(name, msg string) {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		require.NoError(t, err)
+		defer f.Close()
+		fmt.Fprintf(f, `{"time":"2024-01-01T00:00:00Z","level":"INFO","msg":%q}`+"\n", msg)
+	}
+	write("app-20240101T000000.000000000.log", "rotated")
+	write("app.log", "current")
+	h := New(Options{Files: []string{path}})
+
+	code, _, body := get(t, h, "/api/sources", nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `[{"id":"file:0","name":"`+path+`"}]`, body)
+
+	_, res, _ := get(t, h, "/api/entries", url.Values{"source": {"file:0"}})
+	assert.Equal(t, []string{"rotated", "current"}, messages(res))
+	require.NotEmpty(t, res.Cursor)
+
+	write("app.log", "appended")
+	_, res, _ = get(t, h, "/api/entries", url.Values{"source": {"file:0"}, "cursor": {res.Cursor}})
+	assert.Equal(t, []string{"appended"}, messages(res))
+
+	// After a rotation the new file is read from its start.
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "app-20240101T000001.000000000.log")))
+	write("app.log", "a new file with a longer first line")
+	_, res, _ = get(t, h, "/api/entries", url.Values{"source": {"file:0"}, "cursor": {res.Cursor}})
+	assert.Equal(t, []string{"a new file with a longer first line"}, messages(res))
+}
+
+func TestFileSourceStopsAtLimit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	write := func(name string, msgs ...string) {
+		f, err := os.Create(filepath.Join(dir, name))
+		require.NoError(t, err)
+		defer f.Close()
+		for _, msg := range msgs {
+			fmt.Fprintf(f, `{"time":"2024-01-01T00:00:00Z","level":"INFO","msg":%q}`+"\n", msg)
+		}
+	}
+	// The oldest segment cannot be opened, so reading it would fail.
+	require.NoError(t, os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "app-20240101T000000.000000000.log")))
+	write("app-20240101T000001.000000000.log", "a", "b", "c")
+	write("app.log", "d")
+	h := New(Options{Files: []string{path}})
+
+	code, res, body := get(t, h, "/api/entries", url.Values{"source": {"file:0"}, "limit": {"3"}})
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, []string{"b", "c", "d"}, messages(res))
+
+	code, _, _ = get(t, h, "/api/entries", url.Values{"source": {"file:0"}, "limit": {"5"}})
+	assert.Equal(t, http.StatusInternalServerError, code, "Older segments are read until the limit is filled")
+}
+
+func TestIndex(t *testing.T) {
+	code, _, body := get(t, New(Options{}), "/", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `fetch("api/entries?"`, "URLs should be relative")
+}